@@ -0,0 +1,35 @@
+package ble
+
+import "context"
+
+// IOCapability is the input and output capabilities of a device, which
+// determine the pairing method [Vol 3, Part H, 2.3.2].
+type IOCapability uint8
+
+// IOCapability is the input and output capabilities of a device [Vol 3, Part H, 2.3.2].
+const (
+	IOCapDisplayOnly     IOCapability = 0x00 // IOCapDisplayOnly means the device can only display a six digit number.
+	IOCapDisplayYesNo    IOCapability = 0x01 // IOCapDisplayYesNo means the device can display a number, and the user can answer yes or no.
+	IOCapKeyboardOnly    IOCapability = 0x02 // IOCapKeyboardOnly means the user can only input a number.
+	IOCapNoInputNoOutput IOCapability = 0x03 // IOCapNoInputNoOutput means the device has no ability to interact with the user.
+	IOCapKeyboardDisplay IOCapability = 0x04 // IOCapKeyboardDisplay means the device can display a number, and the user can input a number.
+)
+
+// An Agent interacts with the user on behalf of the device during pairing.
+// The ctx is canceled when the pairing completes or fails, and peer is the
+// address of the remote device. The methods, except DisplayPasskey, block
+// until the user answers.
+type Agent interface {
+	// DisplayPasskey shows the passkey to the user, who enters it on the remote device.
+	DisplayPasskey(ctx context.Context, peer Addr, passkey uint32) error
+
+	// RequestPasskey asks the user to enter the passkey displayed on the remote device.
+	RequestPasskey(ctx context.Context, peer Addr) (uint32, error)
+
+	// ConfirmNumber asks the user whether the number matches the one displayed on the remote device.
+	ConfirmNumber(ctx context.Context, peer Addr, number uint32) (bool, error)
+
+	// AuthorizeJustWorks asks the user whether to accept the pairing requested
+	// by the remote device, which doesn't provide MITM protection.
+	AuthorizeJustWorks(ctx context.Context, peer Addr) (bool, error)
+}
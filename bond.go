@@ -0,0 +1,154 @@
+package ble
+
+import "errors"
+
+var (
+	// ErrBondNotFound is returned by a BondStore if no bond exists for the address.
+	ErrBondNotFound = errors.New("bond not found")
+
+	// ErrNoSigningKey is returned if the CSRK to sign or verify data isn't distributed.
+	ErrNoSigningKey = errors.New("no signing key")
+
+	// ErrBadSignature is returned if the signature or sign counter of signed data is invalid.
+	ErrBadSignature = errors.New("bad signature")
+)
+
+// LTK is a Long Term Key, and the EDIV and Rand which identify it [Vol 3, Part H, 2.4.2].
+type LTK struct {
+	Key  []byte `json:"key"`
+	EDIV uint16 `json:"ediv"`
+	Rand uint64 `json:"rand"`
+}
+
+// Bond is the security information exchanged with a bonded device [Vol 3, Part H, 2.4.1].
+// The keys are stored in the order they're transmitted over the air, which is
+// least significant octet first.
+type Bond struct {
+	// Addr is the identity address of the remote device.
+	Addr string `json:"addr"`
+
+	// AddrType is the type of the identity address; 0x00 for public, and 0x01 for random static.
+	AddrType uint8 `json:"addrType"`
+
+	// LocalLTK is distributed by the local device, and is used to encrypt the
+	// link when the local device is the slave. PeerLTK is distributed by the
+	// remote device, and is used when the local device is the master. Both are
+	// the same key if LE Secure Connections was used.
+	LocalLTK *LTK `json:"localLTK,omitempty"`
+	PeerLTK  *LTK `json:"peerLTK,omitempty"`
+
+	// IRK is the Identity Resolving Key of the remote device, which resolves
+	// its resolvable private addresses.
+	IRK []byte `json:"irk,omitempty"`
+
+	// LocalCSRK and PeerCSRK are the Connection Signature Resolving Keys
+	// distributed by the local and remote devices.
+	LocalCSRK []byte `json:"localCSRK,omitempty"`
+	PeerCSRK  []byte `json:"peerCSRK,omitempty"`
+
+	// LocalSignCounter is the sign counter of the next data signed with
+	// LocalCSRK. PeerSignCounter is the lowest sign counter accepted in the
+	// next data signed with PeerCSRK. They persist across connections
+	// [Vol 3, Part H, 2.4.5].
+	LocalSignCounter uint32 `json:"localSignCounter"`
+	PeerSignCounter  uint32 `json:"peerSignCounter"`
+
+	// Authenticated reports whether the keys were generated with MITM protection.
+	Authenticated bool `json:"authenticated"`
+
+	// SecureConnections reports whether the keys were generated by LE Secure Connections.
+	SecureConnections bool `json:"secureConnections"`
+
+	// KeySize is the encryption key size in octets.
+	KeySize int `json:"keySize"`
+
+	// CCCDs are the values of the Client Characteristic Configuration
+	// descriptors configured by the remote device, keyed by the handles of the
+	// descriptors. They persist across connections [Vol 3, Part G, 3.3.3.3].
+	CCCDs map[uint16]uint16 `json:"cccds,omitempty"`
+
+	// ServiceChanged is the range of the handles of the services changed
+	// while the remote device was disconnected. It's indicated when the device
+	// reconnects, if it has enabled the indication of Service Changed [Vol 3, Part G, 7.1].
+	ServiceChanged *HandleRange `json:"serviceChanged,omitempty"`
+
+	// ClientFeatures is the value of the Client Supported Features
+	// characteristic written by the remote device, which persists across
+	// connections [Vol 3, Part G, 7.2].
+	ClientFeatures []byte `json:"clientFeatures,omitempty"`
+}
+
+// HandleRange is a range of attribute handles, which includes Start and End.
+type HandleRange struct {
+	Start uint16 `json:"start"`
+	End   uint16 `json:"end"`
+}
+
+// Merge extends the range to include o.
+func (r *HandleRange) Merge(o HandleRange) {
+	if o.Start < r.Start {
+		r.Start = o.Start
+	}
+	if o.End > r.End {
+		r.End = o.End
+	}
+}
+
+// Copy returns a deep copy of the bond.
+func (b *Bond) Copy() *Bond {
+	c := *b
+	copyLTK := func(k *LTK) *LTK {
+		if k == nil {
+			return nil
+		}
+		l := *k
+		l.Key = append([]byte(nil), k.Key...)
+		return &l
+	}
+	c.LocalLTK = copyLTK(b.LocalLTK)
+	c.PeerLTK = copyLTK(b.PeerLTK)
+	c.IRK = append([]byte(nil), b.IRK...)
+	c.LocalCSRK = append([]byte(nil), b.LocalCSRK...)
+	c.PeerCSRK = append([]byte(nil), b.PeerCSRK...)
+	c.ClientFeatures = append([]byte(nil), b.ClientFeatures...)
+	if b.CCCDs != nil {
+		c.CCCDs = make(map[uint16]uint16, len(b.CCCDs))
+		for h, v := range b.CCCDs {
+			c.CCCDs[h] = v
+		}
+	}
+	if b.ServiceChanged != nil {
+		r := *b.ServiceChanged
+		c.ServiceChanged = &r
+	}
+	return &c
+}
+
+// A BondStore keeps the bonds with remote devices, keyed by their identity addresses.
+type BondStore interface {
+	// Load returns the bond with the device of the identity address a.
+	// It returns ErrBondNotFound if the device isn't bonded.
+	Load(a Addr) (*Bond, error)
+
+	// Save stores the bond, and replaces the existing one with the same identity address.
+	Save(b *Bond) error
+
+	// Delete removes the bond with the device of the identity address a.
+	Delete(a Addr) error
+
+	// List returns all the bonds in the store.
+	List() ([]*Bond, error)
+}
+
+// A BondedConn is a Conn that has access to the bond with the remote device.
+type BondedConn interface {
+	Conn
+
+	// Bond returns a copy of the bond with the remote device, or nil if it isn't bonded.
+	Bond() *Bond
+
+	// UpdateBond calls f with the bond with the remote device, and saves the
+	// modified bond to the BondStore. It returns ErrBondNotFound if the remote
+	// device isn't bonded.
+	UpdateBond(f func(b *Bond)) error
+}
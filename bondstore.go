@@ -0,0 +1,144 @@
+package ble
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// FileBondStore is a BondStore which keeps the bonds in a JSON file.
+// The file is readable and writable only by the owner, since it holds keys.
+type FileBondStore struct {
+	sync.Mutex
+	path  string
+	bonds map[string]*Bond
+}
+
+// NewFileBondStore returns a FileBondStore backed by the file at path.
+// The file is created when the first bond is saved.
+func NewFileBondStore(path string) (*FileBondStore, error) {
+	s := &FileBondStore{
+		path:  path,
+		bonds: make(map[string]*Bond),
+	}
+	b, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var bonds []*Bond
+	if err := json.Unmarshal(b, &bonds); err != nil {
+		return nil, fmt.Errorf("can't parse bonds in %s: %s", path, err)
+	}
+	for _, bd := range bonds {
+		s.bonds[strings.ToLower(bd.Addr)] = bd
+	}
+	return s, nil
+}
+
+// Load returns the bond with the device of the identity address a.
+func (s *FileBondStore) Load(a Addr) (*Bond, error) {
+	s.Lock()
+	defer s.Unlock()
+	b, ok := s.bonds[strings.ToLower(a.String())]
+	if !ok {
+		return nil, ErrBondNotFound
+	}
+	return b.Copy(), nil
+}
+
+// Save stores the bond, and writes the store to the file.
+func (s *FileBondStore) Save(b *Bond) error {
+	if b.Addr == "" {
+		return fmt.Errorf("bond without identity address")
+	}
+	s.Lock()
+	defer s.Unlock()
+	k := strings.ToLower(b.Addr)
+	old, ok := s.bonds[k]
+	s.bonds[k] = b.Copy()
+	if err := s.write(); err != nil {
+		if ok {
+			s.bonds[k] = old
+		} else {
+			delete(s.bonds, k)
+		}
+		return err
+	}
+	return nil
+}
+
+// Delete removes the bond with the device of the identity address a, and writes the store to the file.
+func (s *FileBondStore) Delete(a Addr) error {
+	s.Lock()
+	defer s.Unlock()
+	k := strings.ToLower(a.String())
+	old, ok := s.bonds[k]
+	if !ok {
+		return nil
+	}
+	delete(s.bonds, k)
+	if err := s.write(); err != nil {
+		s.bonds[k] = old
+		return err
+	}
+	return nil
+}
+
+// List returns all the bonds in the store.
+func (s *FileBondStore) List() ([]*Bond, error) {
+	s.Lock()
+	defer s.Unlock()
+	bonds := make([]*Bond, 0, len(s.bonds))
+	for _, b := range s.bonds {
+		bonds = append(bonds, b.Copy())
+	}
+	sort.Slice(bonds, func(i, j int) bool { return bonds[i].Addr < bonds[j].Addr })
+	return bonds, nil
+}
+
+// write replaces the file atomically by writing the bonds to a temporary
+// file in the same directory, and renaming it to the file.
+func (s *FileBondStore) write() error {
+	bonds := make([]*Bond, 0, len(s.bonds))
+	for _, b := range s.bonds {
+		bonds = append(bonds, b)
+	}
+	sort.Slice(bonds, func(i, j int) bool { return bonds[i].Addr < bonds[j].Addr })
+	b, err := json.MarshalIndent(bonds, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Dir(s.path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(dir, "."+filepath.Base(s.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if err := f.Chmod(0600); err != nil {
+		f.Close()
+		return err
+	}
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), s.path)
+}
@@ -0,0 +1,58 @@
+package ble
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestFileBondStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bonds.json")
+	s, err := NewFileBondStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b := &Bond{
+		Addr:          "AA:BB:CC:DD:EE:FF",
+		LocalLTK:      &LTK{Key: []byte{1, 2, 3}, EDIV: 0x1234, Rand: 0x0102030405060708},
+		IRK:           []byte{4, 5, 6},
+		Authenticated: true,
+		KeySize:       16,
+		CCCDs:         map[uint16]uint16{0x000c: 0x0001},
+	}
+	if err := s.Save(b); err != nil {
+		t.Fatal(err)
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := fi.Mode().Perm(); perm != 0600 {
+		t.Errorf("file permission = %o, want 600", perm)
+	}
+
+	// Reopen the store, and the bond should be loaded from the file.
+	s, err = NewFileBondStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := s.Load(NewAddr("aa:bb:cc:dd:ee:ff"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, b) {
+		t.Errorf("Load() = %+v, want %+v", got, b)
+	}
+
+	if err := s.Delete(NewAddr(b.Addr)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Load(NewAddr(b.Addr)); err != ErrBondNotFound {
+		t.Errorf("Load() after Delete() = %v, want %v", err, ErrBondNotFound)
+	}
+	if bonds, _ := s.List(); len(bonds) != 0 {
+		t.Errorf("List() after Delete() = %d bonds, want 0", len(bonds))
+	}
+}
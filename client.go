@@ -1,5 +1,7 @@
 package ble
 
+import "context"
+
 // A Client is a GATT client.
 type Client interface {
 	// Addr returns platform specific unique ID of the remote peripheral, e.g. MAC on Linux, Client UUID on OS X.
@@ -69,4 +71,12 @@ type Client interface {
 
 	// Conn returns the client's current connection.
 	Conn() Conn
+
+	// OpenL2CAPChannel connects an LE credit based connection-oriented channel to the LE_PSM of the remote device. [Vol 3, Part A, 4.22]
+	// The mtu is the maximum size of the SDUs that the local device accepts on the channel.
+	OpenL2CAPChannel(ctx context.Context, psm uint16, mtu int) (Conn, error)
+
+	// EnableEATT connects up to n Enhanced ATT bearers, which serve the requests of the client concurrently. [Vol 3, Part G, 5.3.2]
+	// It returns the number of the bearers connected.
+	EnableEATT(ctx context.Context, n int) (int, error)
 }
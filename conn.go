@@ -36,3 +36,35 @@ type Conn interface {
 	// Disconnected returns a receiving channel, which is closed when the connection disconnects.
 	Disconnected() <-chan struct{}
 }
+
+// A ChannelConn is a Conn which can open LE credit based connection-oriented
+// channels to the remote device [Vol 3, Part A, 3.4].
+type ChannelConn interface {
+	Conn
+
+	// OpenL2CAPChannel connects a channel to the LE_PSM of the remote device.
+	// The mtu is the maximum size of the SDUs that the local device accepts.
+	OpenL2CAPChannel(ctx context.Context, psm uint16, mtu int) (Conn, error)
+
+	// OpenEnhancedL2CAPChannels connects up to 5 channels in Enhanced Credit
+	// Based Flow Control mode to the SPSM of the remote device. It returns the
+	// channels accepted by the remote device.
+	OpenEnhancedL2CAPChannels(ctx context.Context, psm uint16, mtu int, n int) ([]Conn, error)
+}
+
+// A LinkedConn is a Conn on the ACL link of a device, such as an L2CAP channel,
+// or an ATT bearer passed to the handlers.
+type LinkedConn interface {
+	Conn
+
+	// Link returns the connection of the ACL link, which identifies the device.
+	Link() Conn
+}
+
+// linkOf returns the connection of the ACL link, which conn is on.
+func linkOf(conn Conn) Conn {
+	if lc, ok := conn.(LinkedConn); ok {
+		return lc.Link()
+	}
+	return conn
+}
@@ -7,6 +7,9 @@ const DefaultMTU = 23
 // The maximum length of an attribute value shall be 512 octets [Vol 3, Part F, 3.2.9]
 const MaxMTU = 512 + 3
 
+// PSMEATT is the SPSM of the Enhanced ATT bearers [Vol 3, Part G, 5.3.2].
+const PSMEATT = 0x0027
+
 // UUIDs ...
 var (
 	GAPUUID         = UUID16(0x1800) // Generic Access
@@ -21,8 +24,13 @@ var (
 	IncludeUUID          = UUID16(0x2802)
 	CharacteristicUUID   = UUID16(0x2803)
 
-	ClientCharacteristicConfigUUID = UUID16(0x2902)
-	ServerCharacteristicConfigUUID = UUID16(0x2903)
+	CharacteristicExtendedPropertiesUUID = UUID16(0x2900)
+	CharacteristicUserDescriptionUUID    = UUID16(0x2901)
+	ClientCharacteristicConfigUUID       = UUID16(0x2902)
+	ServerCharacteristicConfigUUID       = UUID16(0x2903)
+	CharacteristicPresentationFormatUUID = UUID16(0x2904)
+	CharacteristicAggregateFormatUUID    = UUID16(0x2905)
+	ValidRangeUUID                       = UUID16(0x2906)
 
 	DeviceNameUUID        = UUID16(0x2A00)
 	AppearanceUUID        = UUID16(0x2A01)
@@ -30,4 +38,15 @@ var (
 	ReconnectionAddrUUID  = UUID16(0x2A03)
 	PeferredParamsUUID    = UUID16(0x2A04)
 	ServiceChangedUUID    = UUID16(0x2A05)
+
+	ClientSupportedFeaturesUUID = UUID16(0x2B29)
+	DatabaseHashUUID            = UUID16(0x2B2A)
+	ServerSupportedFeaturesUUID = UUID16(0x2B3A)
+)
+
+// Client Supported Features [Vol 3, Part G, 7.2].
+const (
+	ClientFeatureRobustCaching     = 0x01 // Robust Caching
+	ClientFeatureEATT              = 0x02 // Enhanced ATT bearer
+	ClientFeatureMultipleHandleNtf = 0x04 // Multiple Handle Value Notifications
 )
@@ -1,6 +1,8 @@
 package darwin
 
 import (
+	"context"
+	"errors"
 	"fmt"
 
 	"github.com/runtimeco/ble"
@@ -324,6 +326,16 @@ func (cln *Client) Conn() ble.Conn {
 	return cln.conn
 }
 
+// OpenL2CAPChannel connects an LE credit based connection-oriented channel to the LE_PSM of the remote device.
+func (cln *Client) OpenL2CAPChannel(ctx context.Context, psm uint16, mtu int) (ble.Conn, error) {
+	return nil, errors.New("Not supported")
+}
+
+// EnableEATT connects up to n Enhanced ATT bearers, which serve the requests of the client concurrently.
+func (cln *Client) EnableEATT(ctx context.Context, n int) (int, error) {
+	return 0, errors.New("Not supported")
+}
+
 type sub struct {
 	fn   ble.NotificationHandler
 	char *ble.Characteristic
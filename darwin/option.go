@@ -4,6 +4,7 @@ import (
 	"errors"
 	"time"
 
+	"github.com/runtimeco/ble"
 	"github.com/runtimeco/ble/linux/hci/cmd"
 	"github.com/runtimeco/ble/linux/hci/evt"
 )
@@ -57,3 +58,64 @@ func (d *Device) SetScanParams(param cmd.LESetScanParameters) error {
 func (d *Device) SetAdvParams(param cmd.LESetAdvertisingParameters) error {
 	return errors.New("Not supported")
 }
+
+// SetBondStore sets the store which keeps the keys of bonded devices.
+func (d *Device) SetBondStore(s ble.BondStore) error {
+	return errors.New("Not supported")
+}
+
+// SetIRK sets the Identity Resolving Key of the device.
+func (d *Device) SetIRK(irk []byte) error {
+	return errors.New("Not supported")
+}
+
+// SetIOCapability sets the input and output capabilities of the device used in pairing.
+func (d *Device) SetIOCapability(c ble.IOCapability) error {
+	return errors.New("Not supported")
+}
+
+// SetAuthRequirements sets the bonding and MITM requirements of pairing.
+func (d *Device) SetAuthRequirements(bonding, mitm bool) error {
+	return errors.New("Not supported")
+}
+
+// SetAgent sets the agent, which interacts with the user during pairing.
+func (d *Device) SetAgent(a ble.Agent) error {
+	return errors.New("Not supported")
+}
+
+// SetSecurityRequest sets whether the device sends a Security Request when a request is rejected for insufficient security.
+func (d *Device) SetSecurityRequest(enable bool) error {
+	return errors.New("Not supported")
+}
+
+// SetPrepareQueueSize sets the number of the prepared writes queued for each connection.
+func (d *Device) SetPrepareQueueSize(n int) error {
+	return errors.New("Not supported")
+}
+
+// SetNotifyQueue sets the number of the notifications queued for each connection.
+func (d *Device) SetNotifyQueue(n int, policy ble.NotifyQueuePolicy) error {
+	return errors.New("Not supported")
+}
+
+// SetTransactionTimeout sets how long the ATT client and server wait for a
+// response or a confirmation.
+func (d *Device) SetTransactionTimeout(dur time.Duration) error {
+	return errors.New("Not supported")
+}
+
+// SetAuthorizer sets the authorizer of the accesses to the attributes.
+func (d *Device) SetAuthorizer(a ble.Authorizer) error {
+	return errors.New("Not supported")
+}
+
+// SetResponseTimeout sets how long the server waits for a deferred response.
+func (d *Device) SetResponseTimeout(dur time.Duration) error {
+	return errors.New("Not supported")
+}
+
+// SetEATT sets whether the device serves the Enhanced ATT bearers.
+func (d *Device) SetEATT(enable bool) error {
+	return errors.New("Not supported")
+}
@@ -0,0 +1,199 @@
+package ble
+
+import (
+	"encoding/binary"
+	"fmt"
+	"unicode/utf8"
+)
+
+// ExtendedProperties are the Characteristic Extended Properties [Vol 3, Part G, 3.3.3.1].
+type ExtendedProperties uint16
+
+// Characteristic extended properties flags
+const (
+	ExtReliableWrite       ExtendedProperties = 0x0001 // may be written with reliable writes
+	ExtWritableAuxiliaries ExtendedProperties = 0x0002 // the user description may be written
+)
+
+// ParseExtendedProperties parses the value of a Characteristic Extended
+// Properties descriptor.
+func ParseExtendedProperties(b []byte) (ExtendedProperties, error) {
+	if len(b) != 2 {
+		return 0, fmt.Errorf("invalid extended properties length %d", len(b))
+	}
+	return ExtendedProperties(binary.LittleEndian.Uint16(b)), nil
+}
+
+// Bytes returns the value of the Characteristic Extended Properties descriptor.
+func (p ExtendedProperties) Bytes() []byte {
+	return []byte{byte(p), byte(p >> 8)}
+}
+
+// Formats of the Characteristic Presentation Format [Assigned Numbers, 2.4.1].
+const (
+	FormatBoolean = 0x01
+	FormatUint8   = 0x04
+	FormatUint16  = 0x06
+	FormatUint24  = 0x07
+	FormatUint32  = 0x08
+	FormatUint64  = 0x0A
+	FormatSint8   = 0x0C
+	FormatSint16  = 0x0E
+	FormatSint24  = 0x0F
+	FormatSint32  = 0x10
+	FormatSint64  = 0x12
+	FormatFloat32 = 0x14
+	FormatFloat64 = 0x15
+	FormatSFloat  = 0x16
+	FormatFloat   = 0x17
+	FormatUTF8    = 0x19
+	FormatUTF16   = 0x1A
+	FormatStruct  = 0x1B
+)
+
+// NamespaceBluetoothSIG is the namespace of the descriptions defined by the
+// Bluetooth SIG [Assigned Numbers, 2.4.2].
+const NamespaceBluetoothSIG = 0x01
+
+// PresentationFormat is the value of a Characteristic Presentation Format
+// descriptor, which defines the format of the characteristic value
+// [Vol 3, Part G, 3.3.3.5]. The value is represented as value * 10^Exponent
+// in the Unit, which is a 16-bit UUID.
+type PresentationFormat struct {
+	Format      uint8
+	Exponent    int8
+	Unit        uint16
+	Namespace   uint8
+	Description uint16
+}
+
+// ParsePresentationFormat parses the value of a Characteristic Presentation
+// Format descriptor.
+func ParsePresentationFormat(b []byte) (PresentationFormat, error) {
+	if len(b) != 7 {
+		return PresentationFormat{}, fmt.Errorf("invalid presentation format length %d", len(b))
+	}
+	return PresentationFormat{
+		Format:      b[0],
+		Exponent:    int8(b[1]),
+		Unit:        binary.LittleEndian.Uint16(b[2:]),
+		Namespace:   b[4],
+		Description: binary.LittleEndian.Uint16(b[5:]),
+	}, nil
+}
+
+// Bytes returns the value of the Characteristic Presentation Format descriptor.
+func (f PresentationFormat) Bytes() []byte {
+	b := make([]byte, 7)
+	b[0] = f.Format
+	b[1] = byte(f.Exponent)
+	binary.LittleEndian.PutUint16(b[2:], f.Unit)
+	b[4] = f.Namespace
+	binary.LittleEndian.PutUint16(b[5:], f.Description)
+	return b
+}
+
+// ParseAggregateFormat parses the value of a Characteristic Aggregate Format
+// descriptor, which is the list of the handles of the Presentation Format
+// descriptors [Vol 3, Part G, 3.3.3.6].
+func ParseAggregateFormat(b []byte) ([]uint16, error) {
+	if len(b) == 0 || len(b)%2 != 0 {
+		return nil, fmt.Errorf("invalid aggregate format length %d", len(b))
+	}
+	hh := make([]uint16, 0, len(b)/2)
+	for ; len(b) != 0; b = b[2:] {
+		hh = append(hh, binary.LittleEndian.Uint16(b))
+	}
+	return hh, nil
+}
+
+// ValidRange is the value of a Valid Range descriptor, which is the inclusive
+// bounds of the characteristic value. The bounds are in the format of the
+// value [Core Specification Supplement, Part B, 1.2].
+type ValidRange struct {
+	Lower []byte
+	Upper []byte
+}
+
+// ParseValidRange parses the value of a Valid Range descriptor.
+func ParseValidRange(b []byte) (*ValidRange, error) {
+	if len(b) == 0 || len(b)%2 != 0 {
+		return nil, fmt.Errorf("invalid valid range length %d", len(b))
+	}
+	n := len(b) / 2
+	return &ValidRange{
+		Lower: append([]byte(nil), b[:n]...),
+		Upper: append([]byte(nil), b[n:]...),
+	}, nil
+}
+
+// Bytes returns the value of the Valid Range descriptor.
+func (r *ValidRange) Bytes() []byte {
+	return append(append([]byte(nil), r.Lower...), r.Upper...)
+}
+
+// SetExtendedProperties sets the Characteristic Extended Properties, and the
+// CharExtended property. The descriptor is generated by the server.
+// SetExtendedProperties must be called before the containing service is added to a server.
+func (c *Characteristic) SetExtendedProperties(p ExtendedProperties) {
+	c.ExtendedProperties = p
+	c.Property |= CharExtended
+}
+
+// SetUserDescription sets the Characteristic User Description. If writable is
+// set, the clients may write the description, which is allowed by the Writable
+// Auxiliaries extended property. The descriptor is generated by the server.
+// SetUserDescription must be called before the containing service is added to a server.
+func (c *Characteristic) SetUserDescription(s string, writable bool) {
+	c.UserDescription = s
+	if writable {
+		c.SetExtendedProperties(c.ExtendedProperties | ExtWritableAuxiliaries)
+	}
+}
+
+// Description returns the Characteristic User Description, which may have
+// been written by the clients since it was set.
+func (c *Characteristic) Description() string {
+	c.userDescMu.Lock()
+	defer c.userDescMu.Unlock()
+	return c.UserDescription
+}
+
+// WriteUserDescription writes b at the offset of the Characteristic User
+// Description on behalf of a client, and truncates the description after it.
+// The description shall remain valid UTF-8.
+func (c *Characteristic) WriteUserDescription(offset int, b []byte) ATTError {
+	c.userDescMu.Lock()
+	defer c.userDescMu.Unlock()
+	v := c.UserDescription
+	if offset > len(v) {
+		return ErrInvalidOffset
+	}
+	v = v[:offset] + string(b)
+	if !utf8.ValidString(v) {
+		return ErrValueNotAllowed
+	}
+	c.UserDescription = v
+	return ErrSuccess
+}
+
+// AddPresentationFormat adds a Characteristic Presentation Format. If more
+// than one format is added, the value is an aggregate of them in the order
+// added, and the server generates the Characteristic Aggregate Format.
+// AddPresentationFormat must be called before the containing service is added to a server.
+func (c *Characteristic) AddPresentationFormat(f PresentationFormat) {
+	c.PresentationFormats = append(c.PresentationFormats, f)
+}
+
+// SetValidRange sets the inclusive bounds of the characteristic value, which
+// shall have the same length. The descriptor is generated by the server.
+// SetValidRange must be called before the containing service is added to a server.
+func (c *Characteristic) SetValidRange(lower, upper []byte) {
+	if len(lower) != len(upper) {
+		panic("bounds of the valid range have different lengths")
+	}
+	c.ValidRange = &ValidRange{
+		Lower: append([]byte(nil), lower...),
+		Upper: append([]byte(nil), upper...),
+	}
+}
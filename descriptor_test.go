@@ -0,0 +1,75 @@
+package ble
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestParseDescriptors(t *testing.T) {
+	if p, err := ParseExtendedProperties([]byte{0x03, 0x00}); err != nil || p != ExtReliableWrite|ExtWritableAuxiliaries {
+		t.Errorf("ParseExtendedProperties() = %v, %v", p, err)
+	}
+	if b := (ExtWritableAuxiliaries).Bytes(); !bytes.Equal(b, []byte{0x02, 0x00}) {
+		t.Errorf("extended properties % X, want 02 00", b)
+	}
+
+	f := PresentationFormat{Format: FormatSint16, Exponent: -2, Unit: 0x272F, Namespace: NamespaceBluetoothSIG, Description: 0x0106}
+	b := f.Bytes()
+	if want := []byte{0x0E, 0xFE, 0x2F, 0x27, 0x01, 0x06, 0x01}; !bytes.Equal(b, want) {
+		t.Errorf("presentation format % X, want % X", b, want)
+	}
+	if g, err := ParsePresentationFormat(b); err != nil || g != f {
+		t.Errorf("ParsePresentationFormat() = %+v, %v, want %+v", g, err, f)
+	}
+
+	if hh, err := ParseAggregateFormat([]byte{0x05, 0x00, 0x06, 0x01}); err != nil || !reflect.DeepEqual(hh, []uint16{0x0005, 0x0106}) {
+		t.Errorf("ParseAggregateFormat() = %v, %v", hh, err)
+	}
+
+	r := &ValidRange{Lower: []byte{0x01, 0x00}, Upper: []byte{0x64, 0x00}}
+	if got, err := ParseValidRange(r.Bytes()); err != nil || !reflect.DeepEqual(got, r) {
+		t.Errorf("ParseValidRange() = %+v, %v, want %+v", got, err, r)
+	}
+
+	// The values of invalid lengths are refused.
+	if _, err := ParseExtendedProperties([]byte{0x01}); err == nil {
+		t.Error("extended properties of 1 octet parsed")
+	}
+	if _, err := ParsePresentationFormat(b[:6]); err == nil {
+		t.Error("presentation format of 6 octets parsed")
+	}
+	for _, v := range [][]byte{nil, {0x05, 0x00, 0x06}} {
+		if _, err := ParseAggregateFormat(v); err == nil {
+			t.Errorf("aggregate format % X parsed", v)
+		}
+		if _, err := ParseValidRange(v); err == nil {
+			t.Errorf("valid range % X parsed", v)
+		}
+	}
+}
+
+func TestWriteUserDescription(t *testing.T) {
+	c := &Characteristic{}
+	c.SetUserDescription("Temperature", true)
+
+	tests := []struct {
+		offset int
+		b      []byte
+		err    ATTError
+		want   string
+	}{
+		{4, []byte("o"), ErrSuccess, "Tempo"},
+		{6, []byte("x"), ErrInvalidOffset, "Tempo"},
+		{5, []byte{0xC3}, ErrValueNotAllowed, "Tempo"},
+		{0, []byte("Température"), ErrSuccess, "Température"},
+	}
+	for _, tt := range tests {
+		if err := c.WriteUserDescription(tt.offset, tt.b); err != tt.err {
+			t.Errorf("WriteUserDescription(%d, % X) = %v, want %v", tt.offset, tt.b, err, tt.err)
+		}
+		if d := c.Description(); d != tt.want {
+			t.Errorf("description %q, want %q", d, tt.want)
+		}
+	}
+}
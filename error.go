@@ -12,6 +12,19 @@ var ErrEIRPacketTooLong = errors.New("max packet length is 31")
 // ErrNotImplemented means the functionality is not implemented.
 var ErrNotImplemented = errors.New("not implemented")
 
+// ErrValueTooLong means the value of a notification or an indication exceeds
+// the capacity of the Notifier, which is ATT_MTU-3.
+var ErrValueTooLong = errors.New("value exceeds ATT_MTU-3")
+
+// ErrNotifyQueueFull means the queue of notifications is full, and the
+// notification is dropped.
+var ErrNotifyQueueFull = errors.New("notification queue full")
+
+// ErrTransactionTimeout means an ATT transaction hasn't completed within the
+// transaction timeout. The bearer is closed, and no more operations can be
+// performed on it [Vol 3, Part F, 3.3.3].
+var ErrTransactionTimeout = errors.New("ATT transaction timeout")
+
 // ATTError is the error code of Attribute Protocol [Vol 3, Part F, 3.4.1.1].
 type ATTError byte
 
@@ -35,13 +48,20 @@ const (
 	ErrInsuffEnc         ATTError = 0x0f // ErrInsuffEnc means the attribute requires encryption before it can be read or written.
 	ErrUnsuppGrpType     ATTError = 0x10 // ErrUnsuppGrpType means the attribute type is not a supported grouping attribute as defined by a higher layer specification.
 	ErrInsuffResources   ATTError = 0x11 // ErrInsuffResources means insufficient resources to complete the request.
+	ErrDBOutOfSync       ATTError = 0x12 // ErrDBOutOfSync means the server requests the client to rediscover the database.
+	ErrValueNotAllowed   ATTError = 0x13 // ErrValueNotAllowed means the attribute parameter value was not allowed.
+)
+
+// Common profile and service error codes [Core Specification Supplement, Part B, 1.2].
+const (
+	ErrOutOfRange ATTError = 0xFF // ErrOutOfRange means the attribute value is out of range as defined by a profile or service specification.
 )
 
 func (e ATTError) Error() string {
 	switch i := int(e); {
-	case i < 0x11:
+	case i <= 0x13:
 		return errName[e]
-	case i >= 0x12 && i <= 0x7F: // Reserved for future use.
+	case i >= 0x14 && i <= 0x7F: // Reserved for future use.
 		return fmt.Sprintf("reserved error code (0x%02X)", i)
 	case i >= 0x80 && i <= 0x9F: // Application error, defined by higher level.
 		return fmt.Sprintf("application error code (0x%02X)", i)
@@ -72,4 +92,6 @@ var errName = map[ATTError]string{
 	ErrInsuffEnc:         "insufficient encryption",
 	ErrUnsuppGrpType:     "unsupported group type",
 	ErrInsuffResources:   "insufficient resources",
+	ErrDBOutOfSync:       "database out of sync",
+	ErrValueNotAllowed:   "value not allowed",
 }
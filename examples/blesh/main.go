@@ -24,6 +24,8 @@ var curr struct {
 	uuid    ble.UUID
 	addr    ble.Addr
 	profile *ble.Profile
+	agent   *lib.ConsoleAgent
+	lines   chan string
 }
 
 var (
@@ -137,6 +139,14 @@ func main() {
 			Action: cmdUnsub,
 			Flags:  []cli.Flag{flgUUID, flgInd, flgAddr},
 		},
+		{
+			Name:    "pair",
+			Aliases: []string{"p"},
+			Usage:   "Pair with a connected device",
+			Before:  setup,
+			Action:  cmdPair,
+			Flags:   []cli.Flag{flgTimeout, flgAddr},
+		},
 		{
 			Name:    "shell",
 			Aliases: []string{"sh"},
@@ -155,7 +165,10 @@ func setup(c *cli.Context) error {
 		return nil
 	}
 	fmt.Printf("Initializing device ...\n")
-	d, err := dev.NewDevice("default")
+	curr.agent = lib.NewConsoleAgent(os.Stdout)
+	curr.lines = make(chan string, 1)
+	go readLines()
+	d, err := dev.NewDevice("default", ble.OptAgent(curr.agent), ble.OptIOCapability(ble.IOCapKeyboardDisplay))
 	if err != nil {
 		return errors.Wrap(err, "can't new device")
 	}
@@ -169,6 +182,27 @@ func setup(c *cli.Context) error {
 
 	return nil
 }
+
+// readLines reads the console, and passes the lines to the pending prompt
+// of the agent, if any, or to the shell.
+func readLines() {
+	reader := bufio.NewReader(os.Stdin)
+	for {
+		text, err := reader.ReadString('\n')
+		if err != nil {
+			close(curr.lines)
+			return
+		}
+		if curr.agent.Answer(text) {
+			continue
+		}
+		select {
+		case curr.lines <- text:
+		default:
+		}
+	}
+}
+
 func cmdStatus(c *cli.Context) error {
 	m := map[bool]string{true: "yes", false: "no"}
 	fmt.Printf("Current status:\n")
@@ -396,9 +430,27 @@ func cmdUnsub(c *cli.Context) error {
 	return errNoUUID
 }
 
+func cmdPair(c *cli.Context) error {
+	if err := doConnect(c); err != nil {
+		return err
+	}
+	p, ok := curr.client.Conn().(interface {
+		Pair(ctx context.Context) error
+	})
+	if !ok {
+		return errors.New("pairing is not supported")
+	}
+	fmt.Printf("Pairing with %s...\n", curr.client.Addr())
+	ctx := ble.WithSigHandler(context.WithTimeout(context.Background(), c.Duration("tmo")))
+	if err := p.Pair(ctx); err != nil {
+		return errors.Wrap(err, "can't pair")
+	}
+	fmt.Printf("Paired with %s\n", curr.client.Addr())
+	return nil
+}
+
 func cmdShell(app *cli.App) {
 	cli.OsExiter = func(c int) {}
-	reader := bufio.NewReader(os.Stdin)
 	sigs := make(chan os.Signal, 1)
 	go func() {
 		for range sigs {
@@ -409,7 +461,10 @@ func cmdShell(app *cli.App) {
 	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
 	for {
 		fmt.Print("blesh > ")
-		text, _ := reader.ReadString('\n')
+		text, ok := <-curr.lines
+		if !ok {
+			break
+		}
 		text = strings.TrimSpace(text)
 		if text == "" {
 			continue
@@ -0,0 +1,86 @@
+package lib
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/runtimeco/ble"
+)
+
+// ConsoleAgent is a ble.Agent which prompts the user on the console.
+// The answers are fed by the caller, which reads the console, with Answer.
+type ConsoleAgent struct {
+	w     io.Writer
+	lines chan string
+}
+
+// NewConsoleAgent returns a ConsoleAgent which prints the prompts to w.
+func NewConsoleAgent(w io.Writer) *ConsoleAgent {
+	return &ConsoleAgent{w: w, lines: make(chan string)}
+}
+
+// Answer passes the line to the pending prompt, if any.
+// It reports whether the line was taken by the agent.
+func (a *ConsoleAgent) Answer(line string) bool {
+	select {
+	case a.lines <- line:
+		return true
+	default:
+		return false
+	}
+}
+
+func (a *ConsoleAgent) ask(ctx context.Context, prompt string) (string, error) {
+	fmt.Fprint(a.w, prompt)
+	select {
+	case l := <-a.lines:
+		return strings.TrimSpace(l), nil
+	case <-ctx.Done():
+		fmt.Fprintf(a.w, "\n(Pairing completed or canceled)\n")
+		return "", ctx.Err()
+	}
+}
+
+// DisplayPasskey prints the passkey to be entered on the peer.
+func (a *ConsoleAgent) DisplayPasskey(ctx context.Context, peer ble.Addr, passkey uint32) error {
+	fmt.Fprintf(a.w, "\nEnter passkey %06d on %s\n", passkey, peer)
+	return nil
+}
+
+// RequestPasskey reads the passkey displayed on the peer from the console.
+func (a *ConsoleAgent) RequestPasskey(ctx context.Context, peer ble.Addr) (uint32, error) {
+	l, err := a.ask(ctx, fmt.Sprintf("\nEnter passkey displayed on %s: ", peer))
+	if err != nil {
+		return 0, err
+	}
+	pk, err := strconv.ParseUint(l, 10, 32)
+	if err != nil || pk > 999999 {
+		return 0, fmt.Errorf("invalid passkey %q", l)
+	}
+	return uint32(pk), nil
+}
+
+// ConfirmNumber asks the user whether the peer displays the same number.
+func (a *ConsoleAgent) ConfirmNumber(ctx context.Context, peer ble.Addr, number uint32) (bool, error) {
+	return a.confirm(ctx, fmt.Sprintf("\nDoes %s display %06d? (y/n): ", peer, number))
+}
+
+// AuthorizeJustWorks asks the user to accept the pairing without authentication.
+func (a *ConsoleAgent) AuthorizeJustWorks(ctx context.Context, peer ble.Addr) (bool, error) {
+	return a.confirm(ctx, fmt.Sprintf("\nAccept pairing with %s? (y/n): ", peer))
+}
+
+func (a *ConsoleAgent) confirm(ctx context.Context, prompt string) (bool, error) {
+	l, err := a.ask(ctx, prompt)
+	if err != nil {
+		return false, err
+	}
+	switch strings.ToLower(l) {
+	case "y", "yes":
+		return true, nil
+	}
+	return false, nil
+}
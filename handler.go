@@ -50,23 +50,72 @@ type Request interface {
 	Conn() Conn
 	Data() []byte
 	Offset() int
+
+	// Context returns the context of the request, which is canceled when
+	// the connection disconnects.
+	Context() context.Context
+
+	// Op returns the operation of the request, which tells, for example, a
+	// Write Request from a Write Command.
+	Op() Operation
+
+	// Handle returns the handle of the attribute requested.
+	Handle() uint16
+
+	// Addr returns the address of the remote device.
+	Addr() Addr
+
+	// Security returns the security state of the link, when the request
+	// is received.
+	Security() Security
 }
 
-// NewRequest returns a default implementation of Request.
+// NewRequest returns a default implementation of Request, which is a Read
+// Request of an unspecified handle. Requests of the other operations are
+// returned by NewRequestWithContext.
 func NewRequest(conn Conn, data []byte, offset int) Request {
-	return &request{conn: conn, data: data, offset: offset}
+	ctx := context.Background()
+	if conn != nil {
+		ctx = conn.Context()
+	}
+	return NewRequestWithContext(ctx, conn, OpRead, 0, data, offset)
+}
+
+// NewRequestWithContext returns a default implementation of Request, which
+// has the context, the operation, and the handle of the attribute requested.
+func NewRequestWithContext(ctx context.Context, conn Conn, op Operation, h uint16, data []byte, offset int) Request {
+	r := &request{ctx: ctx, conn: conn, op: op, h: h, data: data, offset: offset}
+	if sc, ok := conn.(interface{ Security() Security }); ok {
+		r.sec = sc.Security()
+	}
+	return r
 }
 
 // Default implementation of request.
 type request struct {
+	ctx    context.Context
 	conn   Conn
+	op     Operation
+	h      uint16
+	sec    Security
 	data   []byte
 	offset int
 }
 
-func (r *request) Conn() Conn   { return r.conn }
-func (r *request) Data() []byte { return r.data }
-func (r *request) Offset() int  { return r.offset }
+func (r *request) Conn() Conn               { return r.conn }
+func (r *request) Data() []byte             { return r.data }
+func (r *request) Offset() int              { return r.offset }
+func (r *request) Context() context.Context { return r.ctx }
+func (r *request) Op() Operation            { return r.op }
+func (r *request) Handle() uint16           { return r.h }
+func (r *request) Security() Security       { return r.sec }
+
+func (r *request) Addr() Addr {
+	if r.conn == nil {
+		return nil
+	}
+	return r.conn.RemoteAddr()
+}
 
 // ResponseWriter ...
 type ResponseWriter interface {
@@ -86,6 +135,18 @@ type ResponseWriter interface {
 	Cap() int
 }
 
+// A DeferrableResponseWriter is a ResponseWriter, of which the handler can
+// take the ownership, and complete the response after it returns.
+type DeferrableResponseWriter interface {
+	ResponseWriter
+
+	// Defer takes the ownership of the response, which is sent after the
+	// returned function is called, possibly from another goroutine after the
+	// handler returns. If it isn't completed within the response timeout of
+	// the server, ErrUnlikely is responded, and the following writes fail.
+	Defer() (done func())
+}
+
 // NewResponseWriter ...
 func NewResponseWriter(buf *bytes.Buffer) ResponseWriter {
 	return &responseWriter{buf: buf}
@@ -155,17 +216,23 @@ type Notifier interface {
 
 type notifier struct {
 	ctx    context.Context
-	maxlen int
+	maxlen func() int
 	cancel func()
 	send   func([]byte) (int, error)
 }
 
 // NewNotifier ...
 func NewNotifier(send func([]byte) (int, error)) Notifier {
+	return NewNotifierWithCap(send, func() int { return 0 })
+}
+
+// NewNotifierWithCap returns a Notifier, which sends data with send, and
+// reports the maximum number of bytes of the data returned by maxlen.
+func NewNotifierWithCap(send func([]byte) (int, error), maxlen func() int) Notifier {
 	n := &notifier{}
 	n.ctx, n.cancel = context.WithCancel(context.Background())
 	n.send = send
-	// n.maxlen = cap
+	n.maxlen = maxlen
 	return n
 }
 
@@ -183,5 +250,5 @@ func (n *notifier) Close() error {
 }
 
 func (n *notifier) Cap() int {
-	return n.maxlen
+	return n.maxlen()
 }
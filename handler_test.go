@@ -0,0 +1,20 @@
+package ble
+
+import (
+	"context"
+	"testing"
+)
+
+func TestNewRequestWithoutConn(t *testing.T) {
+	r := NewRequest(nil, []byte{0x01}, 0)
+
+	if r.Op() != OpRead {
+		t.Errorf("operation %v, want OpRead", r.Op())
+	}
+	if r.Addr() != nil {
+		t.Errorf("address %v, want nil", r.Addr())
+	}
+	if r.Context() != context.Background() {
+		t.Error("context should be the background context")
+	}
+}
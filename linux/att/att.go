@@ -1,6 +1,11 @@
 package att
 
-import "errors"
+import (
+	"errors"
+	"time"
+
+	"github.com/runtimeco/ble"
+)
 
 var (
 	// ErrInvalidArgument means one or more of the arguments are invalid.
@@ -9,11 +14,16 @@ var (
 	// ErrInvalidResponse means one or more of the response fields are invalid.
 	ErrInvalidResponse = errors.New("invalid response")
 
-	// ErrSeqProtoTimeout means the request hasn't been acknowledged in 30 seconds.
+	// ErrSeqProtoTimeout means the request or the indication hasn't been
+	// acknowledged within the transaction timeout, and the bearer is closed.
 	// [Vol 3, Part F, 3.3.3]
-	ErrSeqProtoTimeout = errors.New("req timeout")
+	ErrSeqProtoTimeout = ble.ErrTransactionTimeout
 )
 
+// DefaultTransactionTimeout is the time a transaction has to complete, before
+// the bearer is closed [Vol 3, Part F, 3.3.3].
+const DefaultTransactionTimeout = 30 * time.Second
+
 var rspOfReq = map[byte]byte{
 	ExchangeMTURequestCode:     ExchangeMTUResponseCode,
 	FindInformationRequestCode: FindInformationResponseCode,
@@ -27,4 +37,6 @@ var rspOfReq = map[byte]byte{
 	PrepareWriteRequestCode:    PrepareWriteResponseCode,
 	ExecuteWriteRequestCode:    ExecuteWriteResponseCode,
 	HandleValueIndicationCode:  HandleValueConfirmationCode,
+
+	ReadMultipleVariableRequestCode: ReadMultipleVariableResponseCode,
 }
@@ -471,20 +471,20 @@ func (r SignedWriteCommand) AttributeHandle() uint16 { return binary.LittleEndia
 func (r SignedWriteCommand) SetAttributeHandle(v uint16) { binary.LittleEndian.PutUint16(r[1:], v) }
 
 // AttributeValue ...
-func (r SignedWriteCommand) AttributeValue() []byte { return r[3:] }
+func (r SignedWriteCommand) AttributeValue() []byte { return r[3 : len(r)-12] }
 
 // SetAttributeValue ...
-func (r SignedWriteCommand) SetAttributeValue(v []byte) { copy(r[3:], v) }
+func (r SignedWriteCommand) SetAttributeValue(v []byte) { copy(r[3:len(r)-12], v) }
 
 // AuthenticationSignature ...
 func (r SignedWriteCommand) AuthenticationSignature() [12]byte {
 	b := [12]byte{}
-	copy(b[:], r[3:])
+	copy(b[:], r[len(r)-12:])
 	return b
 }
 
 // SetAuthenticationSignature ...
-func (r SignedWriteCommand) SetAuthenticationSignature(v [12]byte) { copy(r[3:3+12], v[:]) }
+func (r SignedWriteCommand) SetAuthenticationSignature(v [12]byte) { copy(r[len(r)-12:], v[:]) }
 
 // PrepareWriteRequestCode ...
 const PrepareWriteRequestCode = 0x16
@@ -637,3 +637,39 @@ func (r HandleValueConfirmation) AttributeOpcode() uint8 { return r[0] }
 
 // SetAttributeOpcode ...
 func (r HandleValueConfirmation) SetAttributeOpcode() { r[0] = 0x1E }
+
+// ReadMultipleVariableRequestCode ...
+const ReadMultipleVariableRequestCode = 0x20
+
+// ReadMultipleVariableRequest implements Read Multiple Variable Request (0x20) [Vol 3, Part F, 3.4.4.11].
+type ReadMultipleVariableRequest []byte
+
+// AttributeOpcode ...
+func (r ReadMultipleVariableRequest) AttributeOpcode() uint8 { return r[0] }
+
+// SetAttributeOpcode ...
+func (r ReadMultipleVariableRequest) SetAttributeOpcode() { r[0] = 0x20 }
+
+// SetOfHandles ...
+func (r ReadMultipleVariableRequest) SetOfHandles() []byte { return r[1:] }
+
+// SetSetOfHandles ...
+func (r ReadMultipleVariableRequest) SetSetOfHandles(v []byte) { copy(r[1:], v) }
+
+// ReadMultipleVariableResponseCode ...
+const ReadMultipleVariableResponseCode = 0x21
+
+// ReadMultipleVariableResponse implements Read Multiple Variable Response (0x21) [Vol 3, Part F, 3.4.4.12].
+type ReadMultipleVariableResponse []byte
+
+// AttributeOpcode ...
+func (r ReadMultipleVariableResponse) AttributeOpcode() uint8 { return r[0] }
+
+// SetAttributeOpcode ...
+func (r ReadMultipleVariableResponse) SetAttributeOpcode() { r[0] = 0x21 }
+
+// LengthValueTupleList ...
+func (r ReadMultipleVariableResponse) LengthValueTupleList() []byte { return r[1:] }
+
+// SetLengthValueTupleList ...
+func (r ReadMultipleVariableResponse) SetLengthValueTupleList(v []byte) { copy(r[1:], v) }
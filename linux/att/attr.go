@@ -11,4 +11,37 @@ type attr struct {
 	v  []byte
 	rh ble.ReadHandler
 	wh ble.WriteHandler
+
+	// perm is the security required to access the value, and
+	// keySize is the minimum encryption key size required by perm.
+	perm    ble.Permission
+	keySize int
+
+	// signed is set if the value accepts Signed Write Command.
+	signed bool
+
+	// snapshot is set if the long reads of the value are served from the
+	// value read by the Read Request.
+	snapshot bool
+
+	// c is the characteristic the value or the descriptor belongs to, and d
+	// is the descriptor. Both are nil for the declarations.
+	c *ble.Characteristic
+	d *ble.Descriptor
+}
+
+// validate checks the value written at the offset with the validation of the
+// descriptor, or the characteristic value.
+func (a *attr) validate(offset int, b []byte) ble.ATTError {
+	var v *ble.Validation
+	switch {
+	case a.d != nil:
+		v = a.d.Validation
+	case a.c != nil:
+		v = a.c.Validation
+	}
+	if v == nil {
+		return ble.ErrSuccess
+	}
+	return v.Validate(offset, b)
 }
@@ -3,6 +3,7 @@ package att
 import (
 	"encoding/binary"
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/runtimeco/ble"
@@ -23,6 +24,13 @@ type Client struct {
 	chTxBuf chan []byte
 	chErr   chan error
 	handler NotificationHandler
+
+	// timeout is the time a request has to be responded. Once it times out,
+	// err is set, failed is closed, and the bearer is closed [Vol 3, Part F, 3.3.3].
+	timeout  time.Duration
+	failOnce sync.Once
+	failed   chan struct{}
+	err      error
 }
 
 // NewClient returns an Attribute Protocol Client.
@@ -34,11 +42,39 @@ func NewClient(l2c ble.Conn, h NotificationHandler) *Client {
 		rxBuf:   make([]byte, ble.MaxMTU),
 		chErr:   make(chan error, 1),
 		handler: h,
+		timeout: DefaultTransactionTimeout,
+		failed:  make(chan struct{}),
 	}
 	c.chTxBuf <- make([]byte, l2c.TxMTU(), l2c.TxMTU())
 	return c
 }
 
+// SetTransactionTimeout sets the time a request has to be responded, before
+// the bearer is closed. It must be called before sending any request.
+func (c *Client) SetTransactionTimeout(d time.Duration) {
+	c.timeout = d
+}
+
+// fail closes the bearer after a transaction timed out. The pending and the
+// following requests and commands fail with err, and no more PDUs are sent.
+func (c *Client) fail(err error) {
+	c.failOnce.Do(func() {
+		c.err = err
+		close(c.failed)
+		_ = c.l2c.Close()
+	})
+}
+
+// closed returns the error, with which the bearer has been closed, or nil.
+func (c *Client) closed() error {
+	select {
+	case <-c.failed:
+		return errors.Wrap(c.err, "ATT bearer closed")
+	default:
+		return nil
+	}
+}
+
 // ExchangeMTU informs the server of the client’s maximum receive MTU size and
 // request the server to respond with its maximum receive MTU size. [Vol 3, Part F, 3.4.2.1]
 func (c *Client) ExchangeMTU(clientRxMTU int) (serverRxMTU int, err error) {
@@ -291,6 +327,57 @@ func (c *Client) ReadMultiple(handles []uint16) ([]byte, error) {
 	return rsp.SetOfValues(), nil
 }
 
+// ReadMultipleVariable requests the server to read two or more values of a set
+// of attributes that have a variable or unknown value length, and return their
+// values in a Read Multiple Variable Response. If the response is truncated to
+// the ATT_MTU, only the values included are returned, and the last one may be
+// partial. [Vol 3, Part F, 3.4.4.11 & 3.4.4.12]
+func (c *Client) ReadMultipleVariable(handles []uint16) ([][]byte, error) {
+	// Should request to read two or more values.
+	if len(handles) < 2 || len(handles)*2 > c.l2c.TxMTU()-1 {
+		return nil, ErrInvalidArgument
+	}
+
+	// Acquire and reuse the txBuf, and release it after usage.
+	txBuf := <-c.chTxBuf
+	defer func() { c.chTxBuf <- txBuf }()
+
+	req := ReadMultipleVariableRequest(txBuf[:1+len(handles)*2])
+	req.SetAttributeOpcode()
+	p := req.SetOfHandles()
+	for _, h := range handles {
+		binary.LittleEndian.PutUint16(p, h)
+		p = p[2:]
+	}
+
+	b, err := c.sendReq(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Convert and validate the response.
+	rsp := ReadMultipleVariableResponse(b)
+	switch {
+	case rsp[0] == ErrorResponseCode && len(rsp) == 5:
+		return nil, ble.ATTError(rsp[4])
+	case rsp[0] == ErrorResponseCode && len(rsp) != 5:
+		fallthrough
+	case rsp[0] != rsp.AttributeOpcode():
+		return nil, ErrInvalidResponse
+	}
+	var vals [][]byte
+	for l := rsp.LengthValueTupleList(); len(l) >= 2 && len(vals) < len(handles); {
+		n := int(binary.LittleEndian.Uint16(l))
+		l = l[2:]
+		if n > len(l) {
+			n = len(l)
+		}
+		vals = append(vals, l[:n])
+		l = l[n:]
+	}
+	return vals, nil
+}
+
 // ReadByGroupType obtains the values of attributes where the attribute type is known,
 // the type of a grouping attribute as defined by a higher layer specification, but
 // the handle is not known. [Vol 3, Part F, 3.4.4.9 & 3.4.4.10]
@@ -387,10 +474,16 @@ func (c *Client) WriteCommand(handle uint16, value []byte) error {
 
 // SignedWrite requests the server to write the value of an attribute with an authentication
 // signature, typically into a control-point attribute. [Vol 3, Part F, 3.4.5.4]
-func (c *Client) SignedWrite(handle uint16, value []byte, signature [12]byte) error {
+// The signature is generated with the CSRK distributed to the server and the
+// next sign counter [Vol 3, Part H, 2.4.5].
+func (c *Client) SignedWrite(handle uint16, value []byte) error {
 	if len(value) > c.l2c.TxMTU()-15 {
 		return ErrInvalidArgument
 	}
+	sc, ok := c.l2c.(ble.SigningConn)
+	if !ok {
+		return ble.ErrNoSigningKey
+	}
 
 	// Acquire and reuse the txBuf, and release it after usage.
 	txBuf := <-c.chTxBuf
@@ -400,7 +493,11 @@ func (c *Client) SignedWrite(handle uint16, value []byte, signature [12]byte) er
 	req.SetAttributeOpcode()
 	req.SetAttributeHandle(handle)
 	req.SetAttributeValue(value)
-	req.SetAuthenticationSignature(signature)
+	sig, err := sc.Sign(req[:3+len(value)])
+	if err != nil {
+		return err
+	}
+	req.SetAuthenticationSignature(sig)
 
 	return c.sendCmd(req)
 }
@@ -475,15 +572,22 @@ func (c *Client) ExecuteWrite(flags uint8) error {
 }
 
 func (c *Client) sendCmd(b []byte) error {
+	if err := c.closed(); err != nil {
+		return err
+	}
 	_, err := c.l2c.Write(b)
 	return err
 }
 
 func (c *Client) sendReq(b []byte) (rsp []byte, err error) {
 	logger.Debug("client", "req", fmt.Sprintf("% X", b))
+	if err := c.closed(); err != nil {
+		return nil, err
+	}
 	if _, err := c.l2c.Write(b); err != nil {
 		return nil, errors.Wrap(err, "send ATT request failed")
 	}
+	tmo := time.After(c.timeout)
 	for {
 		select {
 		case rsp := <-c.rspc:
@@ -502,7 +606,8 @@ func (c *Client) sendReq(b []byte) (rsp []byte, err error) {
 			}
 		case err := <-c.chErr:
 			return nil, errors.Wrap(err, "ATT request failed")
-		case <-time.After(30 * time.Second):
+		case <-tmo:
+			c.fail(ErrSeqProtoTimeout)
 			return nil, errors.Wrap(ErrSeqProtoTimeout, "ATT request timeout")
 		}
 	}
@@ -539,7 +644,12 @@ func (c *Client) Loop() {
 		copy(b, c.rxBuf)
 
 		if (b[0] != HandleValueNotificationCode) && (b[0] != HandleValueIndicationCode) {
-			c.rspc <- b
+			select {
+			case c.rspc <- b:
+			case <-c.failed:
+				// The bearer is closed, and the late response is dropped.
+				return
+			}
 			continue
 		}
 
@@ -0,0 +1,98 @@
+package att
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/runtimeco/ble"
+)
+
+// pipeConn is an L2CAP connection of a client, which receives the PDUs from
+// in, and sends the PDUs to out.
+type pipeConn struct {
+	*fakeConn
+	in, out chan []byte
+}
+
+func newPipeConn() *pipeConn {
+	return &pipeConn{fakeConn: newFakeConn(), in: make(chan []byte), out: make(chan []byte, 1)}
+}
+
+func (c *pipeConn) Read(b []byte) (int, error) {
+	select {
+	case p := <-c.in:
+		return copy(b, p), nil
+	case <-c.disconnected:
+		return 0, io.EOF
+	}
+}
+
+func (c *pipeConn) Write(b []byte) (int, error) {
+	c.out <- append([]byte(nil), b...)
+	return len(b), nil
+}
+
+// receive returns the next PDU sent by the client.
+func (c *pipeConn) receive(t *testing.T) []byte {
+	select {
+	case b := <-c.out:
+		return b
+	case <-time.After(time.Second):
+		t.Fatal("no PDU sent")
+		return nil
+	}
+}
+
+func TestClientReadMultipleVariable(t *testing.T) {
+	l2c := newPipeConn()
+	defer close(l2c.disconnected)
+	c := NewClient(l2c, nil)
+	go c.Loop()
+
+	tests := []struct {
+		name string
+		rsp  []byte
+		want [][]byte
+		err  error
+	}{
+		{
+			"values", []byte{ReadMultipleVariableResponseCode, 0x01, 0x00, 0x11, 0x00, 0x00, 0x02, 0x00, 0x33, 0x34},
+			[][]byte{{0x11}, {}, {0x33, 0x34}}, nil,
+		},
+		{
+			"last value truncated", []byte{ReadMultipleVariableResponseCode, 0x01, 0x00, 0x11, 0x14, 0x00, 0x22, 0x23},
+			[][]byte{{0x11}, {0x22, 0x23}}, nil,
+		},
+		{
+			"error", errorResponse(ReadMultipleVariableRequestCode, 0x0002, ble.ErrReadNotPerm),
+			nil, ble.ErrReadNotPerm,
+		},
+	}
+	for _, tt := range tests {
+		type result struct {
+			vals [][]byte
+			err  error
+		}
+		done := make(chan result, 1)
+		go func() {
+			vals, err := c.ReadMultipleVariable([]uint16{0x0001, 0x0002, 0x0003})
+			done <- result{vals, err}
+		}()
+		if req, want := l2c.receive(t), []byte{ReadMultipleVariableRequestCode, 0x01, 0x00, 0x02, 0x00, 0x03, 0x00}; !bytes.Equal(req, want) {
+			t.Fatalf("%s: sent % X, want % X", tt.name, req, want)
+		}
+		l2c.in <- tt.rsp
+		r := <-done
+		if r.err != tt.err || !reflect.DeepEqual(r.vals, tt.want) {
+			t.Errorf("%s: ReadMultipleVariable() = % X, %v, want % X, %v", tt.name, r.vals, r.err, tt.want, tt.err)
+		}
+	}
+
+	// At least two values are read.
+	if _, err := c.ReadMultipleVariable([]uint16{0x0001}); err != ErrInvalidArgument {
+		t.Errorf("ReadMultipleVariable() of one value = %v, want ErrInvalidArgument", err)
+	}
+}
@@ -1,40 +1,30 @@
 package att
 
 import (
+	"bytes"
 	"encoding/binary"
 	"fmt"
+	"sort"
 
 	"github.com/runtimeco/ble"
+	"github.com/runtimeco/ble/linux/internal/cmac"
 )
 
-// A DB is a contiguous range of attributes.
+// A DB is a range of attributes, which are sorted by their handles.
 type DB struct {
 	attrs []*attr
-	base  uint16 // handle for first attr in attrs
+	hash  []byte
 }
 
-const (
-	tooSmall = -1
-	tooLarge = -2
-)
-
-// idx returns the idx into attrs corresponding to attr a.
-// If h is too small, idx returns tooSmall (-1).
-// If h is too large, idx returns tooLarge (-2).
-func (r *DB) idx(h int) int {
-	if h < int(r.base) {
-		return tooSmall
-	}
-	if h >= int(r.base)+len(r.attrs) {
-		return tooLarge
-	}
-	return h - int(r.base)
+// search returns the index of the first attribute with the handle not less than h.
+func (r *DB) search(h uint16) int {
+	return sort.Search(len(r.attrs), func(i int) bool { return r.attrs[i].h >= h })
 }
 
 // at returns attr a.
 func (r *DB) at(h uint16) (a *attr, ok bool) {
-	i := r.idx(int(h))
-	if i < 0 {
+	i := r.search(h)
+	if i == len(r.attrs) || r.attrs[i].h != h {
 		return nil, false
 	}
 	return r.attrs[i], true
@@ -43,66 +33,206 @@ func (r *DB) at(h uint16) (a *attr, ok bool) {
 // subrange returns attributes in range [start, end]; it may return an empty slice.
 // subrange does not panic for out-of-range start or end.
 func (r *DB) subrange(start, end uint16) []*attr {
-	startidx := r.idx(int(start))
-	switch startidx {
-	case tooSmall:
-		startidx = 0
-	case tooLarge:
+	i := r.search(start)
+	j := len(r.attrs)
+	if end < 0xFFFF {
+		j = r.search(end + 1) // [start, end] includes its upper bound!
+	}
+	if i >= j {
 		return []*attr{}
 	}
+	return r.attrs[i:j]
+}
 
-	endidx := r.idx(int(end) + 1) // [start, end] includes its upper bound!
-	switch endidx {
-	case tooSmall:
-		return []*attr{}
-	case tooLarge:
-		endidx = len(r.attrs)
+// Hash returns the Database Hash, which is in the order of the value of
+// the Database Hash characteristic (least significant octet first).
+func (r *DB) Hash() []byte {
+	return r.hash
+}
+
+// View returns the database, which only contains the attributes of the services
+// in r, which are declared at the handles. The attributes keep their handles,
+// and the Database Hash is calculated over them. The include declarations of
+// the services not in the view are dropped.
+func (r *DB) View(handles []uint16) *DB {
+	visible := make(map[uint16]bool, len(handles))
+	for _, h := range handles {
+		visible[h] = true
+	}
+	attrs := []*attr{}
+	keep := false
+	for _, a := range r.attrs {
+		if a.typ.Equal(ble.PrimaryServiceUUID) || a.typ.Equal(ble.SecondaryServiceUUID) {
+			keep = visible[a.h]
+		}
+		if !keep {
+			continue
+		}
+		if a.typ.Equal(ble.IncludeUUID) && !visible[binary.LittleEndian.Uint16(a.v)] {
+			continue
+		}
+		attrs = append(attrs, a)
+	}
+	return &DB{attrs: attrs, hash: dbHash(attrs)}
+}
+
+// Changed returns the range of the handles, of which the attributes are added,
+// removed or modified in r since old. ok is false if the attributes are the same.
+// The values of the attributes are compared only for the declarations, which
+// describe the structure of the services.
+func (r *DB) Changed(old *DB) (start, end uint16, ok bool) {
+	n, m := len(r.attrs), len(old.attrs)
+	i := 0
+	for i < n && i < m && sameAttr(r.attrs[i], old.attrs[i]) {
+		i++
+	}
+	switch {
+	case i == n && i == m:
+		return 0, 0, false
+	case i == n:
+		start = old.attrs[i].h
+	case i == m || r.attrs[i].h < old.attrs[i].h:
+		start = r.attrs[i].h
+	default:
+		start = old.attrs[i].h
+	}
+
+	// The services following the added or removed attributes are moved.
+	if n != m {
+		return start, 0xFFFF, true
+	}
+	j := n - 1
+	for sameAttr(r.attrs[j], old.attrs[j]) {
+		j--
+	}
+	end = r.attrs[j].h
+	if old.attrs[j].h > end {
+		end = old.attrs[j].h
 	}
-	return r.attrs[startidx:endidx]
+	return start, end, true
 }
 
-// NewDB ...
-func NewDB(ss []*ble.Service, base uint16) *DB {
-	h := base
+// sameAttr reports whether a and b are the same attributes in the structure
+// of the database.
+func sameAttr(a, b *attr) bool {
+	if a.h != b.h || a.endh != b.endh || !a.typ.Equal(b.typ) {
+		return false
+	}
+	switch {
+	case a.typ.Equal(ble.PrimaryServiceUUID),
+		a.typ.Equal(ble.SecondaryServiceUUID),
+		a.typ.Equal(ble.IncludeUUID),
+		a.typ.Equal(ble.CharacteristicUUID):
+		return bytes.Equal(a.v, b.v)
+	}
+	return true
+}
+
+// NewDB returns the database of the services, of which the attributes start
+// at handle base, unless the services or the characteristics have fixed handles.
+func NewDB(ss []*ble.Service, base uint16) (*DB, error) {
+	h := int(base)
 	var attrs []*attr
 	var aa []*attr
+	var err error
+	decls := make(map[*ble.Service]int) // Indexes of the service declarations.
 	for i, s := range ss {
-		h, aa = genSvcAttr(s, h)
+		decls[s] = len(attrs)
+		if h, aa, err = genSvcAttr(s, h); err != nil {
+			return nil, err
+		}
 		if i == len(ss)-1 {
 			aa[0].endh = 0xFFFF
 		}
 		attrs = append(attrs, aa...)
 	}
+	if h > 0xFFFF+1 {
+		return nil, fmt.Errorf("too many attributes")
+	}
+
+	// The include declarations follow the service declaration, and refer to
+	// the services, of which the handles are generated [Vol 3, Part G, 3.2].
+	for _, s := range ss {
+		for i, inc := range s.Includes {
+			j, ok := decls[inc]
+			if !ok {
+				return nil, fmt.Errorf("service %s: included service %s is not in the database", s.UUID, inc.UUID)
+			}
+			a := attrs[decls[s]+1+i]
+			a.v = []byte{byte(attrs[j].h), byte(attrs[j].h >> 8), byte(inc.EndHandle), byte(inc.EndHandle >> 8)}
+			if inc.UUID.Len() == 2 {
+				// A 128-bit UUID is read from the service declaration.
+				a.v = append(a.v, inc.UUID...)
+			}
+		}
+	}
 	DumpAttributes(attrs)
-	return &DB{attrs: attrs, base: base}
+	return &DB{attrs: attrs, hash: dbHash(attrs)}, nil
 }
 
-func genSvcAttr(s *ble.Service, h uint16) (uint16, []*attr) {
+// fixHandle returns the fixed handle, if it's not zero, or the next handle h.
+func fixHandle(fixed uint16, h int, what string, u ble.UUID) (int, error) {
+	switch {
+	case fixed == 0:
+		return h, nil
+	case int(fixed) < h:
+		return 0, fmt.Errorf("%s %s: handle 0x%04X is in use", what, u, fixed)
+	}
+	return int(fixed), nil
+}
+
+func genSvcAttr(s *ble.Service, h int) (int, []*attr, error) {
+	h, err := fixHandle(s.FixedHandle, h, "service", s.UUID)
+	if err != nil {
+		return 0, nil, err
+	}
 	a := &attr{
-		h:   h,
+		h:   uint16(h),
 		typ: ble.PrimaryServiceUUID,
 		v:   s.UUID,
 	}
+	if s.Secondary {
+		a.typ = ble.SecondaryServiceUUID
+	}
 	h++
 	attrs := []*attr{a}
 	var aa []*attr
 
+	// The values of the include declarations are set after the handles of
+	// all the services are generated.
+	for range s.Includes {
+		attrs = append(attrs, &attr{h: uint16(h), typ: ble.IncludeUUID})
+		h++
+	}
+
 	for _, c := range s.Characteristics {
-		h, aa = genCharAttr(c, h)
+		if h, aa, err = genCharAttr(c, h); err != nil {
+			return 0, nil, err
+		}
 		attrs = append(attrs, aa...)
 	}
 
-	a.endh = h - 1
-	return h, attrs
+	a.endh = uint16(h - 1)
+	s.Handle = a.h
+	s.EndHandle = a.endh
+	return h, attrs, nil
 }
 
-func genCharAttr(c *ble.Characteristic, h uint16) (uint16, []*attr) {
-	vh := h + 1
+func genCharAttr(c *ble.Characteristic, h int) (int, []*attr, error) {
+	h, err := fixHandle(c.FixedHandle, h, "characteristic", c.UUID)
+	if err != nil {
+		return 0, nil, err
+	}
+	vh := uint16(h + 1)
 
+	prop := c.Property
+	if c.ExtendedProperties != 0 {
+		prop |= ble.CharExtended
+	}
 	a := &attr{
-		h:   h,
+		h:   uint16(h),
 		typ: ble.CharacteristicUUID,
-		v:   append([]byte{byte(c.Property), byte(vh), byte((vh) >> 8)}, c.UUID...),
+		v:   append([]byte{byte(prop), byte(vh), byte((vh) >> 8)}, c.UUID...),
 	}
 
 	va := &attr{
@@ -111,11 +241,19 @@ func genCharAttr(c *ble.Characteristic, h uint16) (uint16, []*attr) {
 		v:   c.Value,
 		rh:  c.ReadHandler,
 		wh:  c.WriteHandler,
+
+		perm:    c.Secure,
+		keySize: c.MinKeySize,
+		signed:  c.Property&ble.CharSignedWrite != 0,
+
+		snapshot: c.SnapshotRead,
+
+		c: c,
 	}
 
-	c.Handle = h
+	c.Handle = a.h
 	c.ValueHandle = vh
-	if c.NotifyHandler != nil || c.IndicateHandler != nil {
+	if c.CCCD == nil && c.Property&(ble.CharNotify|ble.CharIndicate) != 0 {
 		c.CCCD = newCCCD(c)
 		c.Descriptors = append(c.Descriptors, c.CCCD)
 	}
@@ -123,22 +261,135 @@ func genCharAttr(c *ble.Characteristic, h uint16) (uint16, []*attr) {
 	h += 2
 
 	attrs := []*attr{a, va}
+	for _, sa := range genStdDescAttrs(c, uint16(h)) {
+		attrs = append(attrs, sa)
+		h++
+	}
 	for _, d := range c.Descriptors {
-		attrs = append(attrs, genDescAttr(d, h))
+		attrs = append(attrs, genDescAttr(c, d, uint16(h)))
 		h++
 	}
 
-	a.endh = h - 1
-	return h, attrs
+	a.endh = uint16(h - 1)
+	c.EndHandle = a.endh
+	return h, attrs, nil
 }
 
-func genDescAttr(d *ble.Descriptor, h uint16) *attr {
+// dbHash returns the Database Hash, which is the AES-CMAC with a zero key over
+// the attributes describing the structure of the database [Vol 3, Part G, 7.3.1].
+// The handles, types and values are concatenated in the order of transmission,
+// and the hash is returned in the same order (least significant octet first).
+func dbHash(attrs []*attr) []byte {
+	var m []byte
+	for _, a := range attrs {
+		switch {
+		case a.typ.Equal(ble.PrimaryServiceUUID),
+			a.typ.Equal(ble.SecondaryServiceUUID),
+			a.typ.Equal(ble.IncludeUUID),
+			a.typ.Equal(ble.CharacteristicUUID),
+			a.typ.Equal(ble.CharacteristicExtendedPropertiesUUID):
+			m = append(m, byte(a.h), byte(a.h>>8))
+			m = append(m, a.typ...)
+			m = append(m, a.v...)
+		case a.typ.Equal(ble.CharacteristicUserDescriptionUUID),
+			a.typ.Equal(ble.ClientCharacteristicConfigUUID),
+			a.typ.Equal(ble.ServerCharacteristicConfigUUID),
+			a.typ.Equal(ble.CharacteristicPresentationFormatUUID),
+			a.typ.Equal(ble.CharacteristicAggregateFormatUUID):
+			m = append(m, byte(a.h), byte(a.h>>8))
+			m = append(m, a.typ...)
+		}
+	}
+	sum := cmac.Sum(make([]byte, 16), m)
+	for i, j := 0, len(sum)-1; i < j; i, j = i+1, j-1 {
+		sum[i], sum[j] = sum[j], sum[i]
+	}
+	return sum
+}
+
+// genStdDescAttrs generates the standard descriptors declared by the typed
+// fields of the characteristic, starting at handle h. A descriptor added to
+// the characteristic with the same UUID takes precedence.
+func genStdDescAttrs(c *ble.Characteristic, h uint16) []*attr {
+	has := func(u ble.UUID) bool {
+		for _, d := range c.Descriptors {
+			if d.UUID.Equal(u) {
+				return true
+			}
+		}
+		return false
+	}
+	var attrs []*attr
+	add := func(u ble.UUID, v []byte) *attr {
+		dh := h + uint16(len(attrs))
+		a := &attr{h: dh, typ: u, v: v, c: c, d: &ble.Descriptor{UUID: u, Handle: dh}}
+		attrs = append(attrs, a)
+		return a
+	}
+
+	if (c.ExtendedProperties != 0 || c.Property&ble.CharExtended != 0) &&
+		!has(ble.CharacteristicExtendedPropertiesUUID) {
+		add(ble.CharacteristicExtendedPropertiesUUID, c.ExtendedProperties.Bytes())
+	}
+	writable := c.ExtendedProperties&ble.ExtWritableAuxiliaries != 0
+	if desc := c.Description(); (desc != "" || writable) && !has(ble.CharacteristicUserDescriptionUUID) {
+		a := add(ble.CharacteristicUserDescriptionUUID, []byte(desc))
+		if writable {
+			a.v = nil
+			a.rh, a.wh = userDescHandlers(c)
+		}
+	}
+	if !has(ble.CharacteristicPresentationFormatUUID) {
+		var fhs []uint16
+		for _, f := range c.PresentationFormats {
+			fhs = append(fhs, add(ble.CharacteristicPresentationFormatUUID, f.Bytes()).h)
+		}
+		// The value is an aggregate of the formats [Vol 3, Part G, 3.3.3.6].
+		if len(fhs) > 1 && !has(ble.CharacteristicAggregateFormatUUID) {
+			v := make([]byte, 0, 2*len(fhs))
+			for _, fh := range fhs {
+				v = append(v, byte(fh), byte(fh>>8))
+			}
+			add(ble.CharacteristicAggregateFormatUUID, v)
+		}
+	}
+	if c.ValidRange != nil && !has(ble.ValidRangeUUID) {
+		add(ble.ValidRangeUUID, c.ValidRange.Bytes())
+	}
+	return attrs
+}
+
+// userDescHandlers returns the handlers of the writable User Description of
+// the characteristic, which is shared by the clients.
+func userDescHandlers(c *ble.Characteristic) (ble.ReadHandler, ble.WriteHandler) {
+	rh := ble.ReadHandlerFunc(func(req ble.Request, rsp ble.ResponseWriter) {
+		v := c.Description()
+		if req.Offset() > len(v) {
+			rsp.SetStatus(ble.ErrInvalidOffset)
+			return
+		}
+		rsp.Write([]byte(v[req.Offset():]))
+	})
+	wh := ble.WriteHandlerFunc(func(req ble.Request, rsp ble.ResponseWriter) {
+		rsp.SetStatus(c.WriteUserDescription(req.Offset(), req.Data()))
+	})
+	return rh, wh
+}
+
+func genDescAttr(c *ble.Characteristic, d *ble.Descriptor, h uint16) *attr {
+	d.Handle = h
 	return &attr{
 		h:   h,
 		typ: d.UUID,
 		v:   d.Value,
 		rh:  d.ReadHandler,
 		wh:  d.WriteHandler,
+
+		perm:    d.Secure,
+		keySize: d.MinKeySize,
+
+		c: c,
+		d: d,
 	}
 }
 
@@ -164,14 +415,21 @@ func newCCCD(c *ble.Characteristic) *ble.Descriptor {
 	d := ble.NewDescriptor(ble.ClientCharacteristicConfigUUID)
 
 	d.HandleRead(ble.ReadHandlerFunc(func(req ble.Request, rsp ble.ResponseWriter) {
-		cccs := req.Conn().(*conn).cccs
-		ccc := cccs[c.Handle]
+		cl := req.Conn().(*conn).client
+		cl.mu.Lock()
+		ccc := cl.cccs[c.Handle]
+		cl.mu.Unlock()
 		binary.Write(rsp, binary.LittleEndian, ccc)
 	}))
 
+	// The CCCD is shared by the bearers of the device, and the notifications
+	// and the indications are sent on its unenhanced bearer.
 	d.HandleWrite(ble.WriteHandlerFunc(func(req ble.Request, rsp ble.ResponseWriter) {
-		cn := req.Conn().(*conn)
-		old := cn.cccs[c.Handle]
+		cl := req.Conn().(*conn).client
+		svr := cl.conn.svr
+		cl.mu.Lock()
+		defer cl.mu.Unlock()
+		old := cl.cccs[c.Handle]
 		ccc := binary.LittleEndian.Uint16(req.Data())
 
 		oldNotify := old&cccNotify != 0
@@ -184,12 +442,15 @@ func newCCCD(c *ble.Characteristic) *ble.Descriptor {
 				rsp.SetStatus(ble.ErrUnlikely)
 				return
 			}
-			send := func(b []byte) (int, error) { return cn.svr.notify(c.ValueHandle, b) }
-			cn.nn[c.Handle] = ble.NewNotifier(send)
-			go c.NotifyHandler.ServeNotify(req, cn.nn[c.Handle])
+			send := func(b []byte) (int, error) { return svr.notify(c.ValueHandle, b) }
+			cl.nn[c.Handle] = ble.NewNotifierWithCap(send, svr.notifyCap)
+			c.Subscribe(cl.conn, cl.nn[c.Handle], false)
+			if c.NotifyHandler != nil {
+				go c.NotifyHandler.ServeNotify(req, cl.nn[c.Handle])
+			}
 		}
 		if !newNotify && oldNotify {
-			cn.nn[c.Handle].Close()
+			cl.nn[c.Handle].Close()
 		}
 
 		if newIndicate && !oldIndicate {
@@ -197,14 +458,65 @@ func newCCCD(c *ble.Characteristic) *ble.Descriptor {
 				rsp.SetStatus(ble.ErrUnlikely)
 				return
 			}
-			send := func(b []byte) (int, error) { return cn.svr.indicate(c.ValueHandle, b) }
-			cn.in[c.Handle] = ble.NewNotifier(send)
-			go c.IndicateHandler.ServeNotify(req, cn.in[c.Handle])
+			send := func(b []byte) (int, error) { return svr.indicate(c.ValueHandle, b) }
+			cl.in[c.Handle] = ble.NewNotifierWithCap(send, svr.notifyCap)
+			c.Subscribe(cl.conn, cl.in[c.Handle], true)
+			if c.IndicateHandler != nil {
+				go c.IndicateHandler.ServeNotify(req, cl.in[c.Handle])
+			}
 		}
 		if !newIndicate && oldIndicate {
-			cn.in[c.Handle].Close()
+			cl.in[c.Handle].Close()
+		}
+		cl.cccs[c.Handle] = ccc
+		if ccc != old {
+			cl.saveCCC(d.Handle, ccc)
 		}
-		cn.cccs[c.Handle] = ccc
 	}))
 	return d
 }
+
+// HandleClientSupportedFeatures makes the characteristic serve the Client
+// Supported Features configured by each client [Vol 3, Part G, 7.2]. The
+// features enabled can't be disabled by the client, and persist across
+// connections if the client is bonded.
+func HandleClientSupportedFeatures(c *ble.Characteristic) {
+	c.HandleRead(ble.ReadHandlerFunc(func(req ble.Request, rsp ble.ResponseWriter) {
+		cl := req.Conn().(*conn).client
+		cl.mu.Lock()
+		defer cl.mu.Unlock()
+		rsp.Write(cl.features)
+	}))
+	c.HandleWrite(ble.WriteHandlerFunc(func(req ble.Request, rsp ble.ResponseWriter) {
+		cl := req.Conn().(*conn).client
+		cl.mu.Lock()
+		defer cl.mu.Unlock()
+		v := req.Data()
+		if len(v) == 0 {
+			rsp.SetStatus(ble.ErrInvalAttrValueLen)
+			return
+		}
+		for i, f := range cl.features {
+			if i >= len(v) || v[i]&f != f {
+				rsp.SetStatus(ble.ErrValueNotAllowed)
+				return
+			}
+		}
+		if bytes.Equal(v, cl.features) {
+			return
+		}
+		cl.features = append([]byte(nil), v...)
+		cl.saveFeatures(cl.features)
+	}))
+}
+
+// HandleDatabaseHash makes the characteristic serve the Database Hash of the
+// database served to each client [Vol 3, Part G, 7.3]. Reading it makes the
+// client change-aware.
+func HandleDatabaseHash(c *ble.Characteristic) {
+	c.HandleRead(ble.ReadHandlerFunc(func(req ble.Request, rsp ble.ResponseWriter) {
+		svr := req.Conn().(*conn).svr
+		svr.setAware()
+		rsp.Write(svr.db.Hash())
+	}))
+}
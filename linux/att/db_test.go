@@ -0,0 +1,75 @@
+package att
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	"github.com/runtimeco/ble"
+)
+
+// Sample data of the Database Hash [Vol 3, Part G, Appendix B].
+func TestDBHash(t *testing.T) {
+	a := func(h uint16, typ ble.UUID, v ...byte) *attr {
+		return &attr{h: h, typ: typ, v: v}
+	}
+	attrs := []*attr{
+		a(0x0001, ble.PrimaryServiceUUID, 0x00, 0x18),
+		a(0x0002, ble.CharacteristicUUID, 0x0A, 0x03, 0x00, 0x00, 0x2A),
+		a(0x0003, ble.DeviceNameUUID),
+		a(0x0004, ble.CharacteristicUUID, 0x02, 0x05, 0x00, 0x01, 0x2A),
+		a(0x0005, ble.AppearanceUUID),
+		a(0x0006, ble.PrimaryServiceUUID, 0x01, 0x18),
+		a(0x0007, ble.CharacteristicUUID, 0x20, 0x08, 0x00, 0x05, 0x2A),
+		a(0x0008, ble.ServiceChangedUUID),
+		a(0x0009, ble.ClientCharacteristicConfigUUID),
+		a(0x000A, ble.CharacteristicUUID, 0x0A, 0x0B, 0x00, 0x29, 0x2B),
+		a(0x000B, ble.ClientSupportedFeaturesUUID),
+		a(0x000C, ble.CharacteristicUUID, 0x02, 0x0D, 0x00, 0x2A, 0x2B),
+		a(0x000D, ble.DatabaseHashUUID),
+		a(0x000E, ble.PrimaryServiceUUID, 0x08, 0x18),
+		a(0x000F, ble.IncludeUUID, 0x14, 0x00, 0x16, 0x00, 0x0F, 0x18),
+		a(0x0010, ble.CharacteristicUUID, 0xA2, 0x11, 0x00, 0x18, 0x2A),
+		a(0x0011, ble.UUID16(0x2A18)),
+		a(0x0012, ble.ClientCharacteristicConfigUUID),
+		a(0x0013, ble.CharacteristicExtendedPropertiesUUID, 0x00, 0x00),
+		a(0x0014, ble.SecondaryServiceUUID, 0x0F, 0x18),
+		a(0x0015, ble.CharacteristicUUID, 0x02, 0x16, 0x00, 0x19, 0x2A),
+		a(0x0016, ble.UUID16(0x2A19)),
+	}
+
+	// The hash is written with the most significant octet first in the spec.
+	want, _ := hex.DecodeString("F1CA2D48ECF58BAC8A8830BBB9FBA990")
+	got := dbHash(attrs)
+	for i, j := 0, len(got)-1; i < j; i, j = i+1, j-1 {
+		got[i], got[j] = got[j], got[i]
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("Database Hash = %X, want %X", got, want)
+	}
+}
+
+func TestDBViewDropsHiddenIncludes(t *testing.T) {
+	inc := ble.NewService(ble.UUID16(0x180F))
+	inc.Secondary = true
+	inc.NewCharacteristic(ble.UUID16(0x2A19)).SetValue([]byte{100})
+	svc := ble.NewService(ble.UUID16(0x1808)).AddInclude(inc)
+	svc.NewCharacteristic(ble.UUID16(0x2A18)).SetValue([]byte{0})
+	db, err := NewDB([]*ble.Service{svc, inc}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v := db.View([]uint16{svc.Handle})
+	for _, a := range v.attrs {
+		if a.h > svc.EndHandle {
+			t.Errorf("attribute 0x%04X of a hidden service in the view", a.h)
+		}
+		if a.typ.Equal(ble.IncludeUUID) {
+			t.Errorf("include declaration 0x%04X of a hidden service in the view", a.h)
+		}
+	}
+	if _, ok := db.View([]uint16{svc.Handle, inc.Handle}).at(svc.Handle + 1); !ok {
+		t.Error("include declaration of a visible service dropped")
+	}
+}
@@ -0,0 +1,103 @@
+package att
+
+import (
+	"io"
+	"sync"
+	"time"
+
+	"github.com/runtimeco/ble"
+)
+
+// DefaultResponseTimeout is the time a deferred response has to be completed,
+// before the server responds ErrUnlikely. It's less than the transaction
+// timeout, so the client doesn't close the bearer [Vol 3, Part F, 3.3.3].
+const DefaultResponseTimeout = 20 * time.Second
+
+// deferrable is a ResponseWriter, which the handler may complete after it
+// returns. Once the server stops waiting, the response is closed, and the
+// following writes of the handler fail.
+type deferrable struct {
+	rsp ble.ResponseWriter
+
+	mu       sync.Mutex
+	deferred bool
+	closed   bool
+	done     chan struct{}
+	once     sync.Once
+}
+
+func newDeferrable(rsp ble.ResponseWriter) *deferrable {
+	return &deferrable{rsp: rsp, done: make(chan struct{})}
+}
+
+// Defer takes the ownership of the response, which is completed by done.
+func (d *deferrable) Defer() func() {
+	d.mu.Lock()
+	d.deferred = true
+	d.mu.Unlock()
+	return func() { d.once.Do(func() { close(d.done) }) }
+}
+
+func (d *deferrable) Write(b []byte) (int, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.closed {
+		return 0, io.ErrClosedPipe
+	}
+	return d.rsp.Write(b)
+}
+
+func (d *deferrable) Status() ble.ATTError {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.rsp.Status()
+}
+
+func (d *deferrable) SetStatus(status ble.ATTError) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !d.closed {
+		d.rsp.SetStatus(status)
+	}
+}
+
+func (d *deferrable) Len() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.rsp.Len()
+}
+
+func (d *deferrable) Cap() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.rsp.Cap()
+}
+
+// wait waits for the deferred response to be completed within the timeout,
+// or the bearer to be closed, and closes the response. It returns the status
+// of the response, or ErrUnlikely if it isn't completed.
+func (d *deferrable) wait(timeout time.Duration, closed <-chan struct{}) ble.ATTError {
+	d.mu.Lock()
+	deferred := d.deferred
+	d.mu.Unlock()
+
+	e := ble.ErrSuccess
+	if deferred {
+		select {
+		case <-d.done:
+		case <-time.After(timeout):
+			logger.Error("server", "deferred response timeout", nil)
+			e = ble.ErrUnlikely
+		case <-closed:
+			e = ble.ErrUnlikely
+		}
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.closed = true
+	if e != ble.ErrSuccess {
+		return e
+	}
+	return d.rsp.Status()
+}
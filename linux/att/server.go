@@ -2,20 +2,38 @@ package att
 
 import (
 	"bytes"
+	"context"
 	"encoding/binary"
 	"fmt"
 	"io"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/runtimeco/ble"
 )
 
+// conn is the connection of a bearer, which is passed to the handlers.
 type conn struct {
 	ble.Conn
-	svr  *Server
+	svr *Server
+	*client
+}
+
+// client is the state of a connected device, which is shared by all its ATT
+// bearers [Vol 3, Part G, 5.3.2].
+type client struct {
+	// conn is the connection of the unenhanced bearer, which the subscriptions
+	// are bound to, and the notifications and indications are sent on.
+	conn *conn
+
+	mu   sync.Mutex
 	cccs map[uint16]uint16
 	nn   map[uint16]ble.Notifier
 	in   map[uint16]ble.Notifier
+
+	// features is the value of Client Supported Features [Vol 3, Part G, 7.2].
+	features []byte
 }
 
 // Server implements an ATT (Attribute Protocol) server.
@@ -23,19 +41,90 @@ type Server struct {
 	conn *conn
 	db   *DB
 
+	// mu guards nextDB, the database replacing db before handling the next
+	// request, and the change awareness of the client [Vol 3, Part G, 2.5.2.1].
+	mu        sync.Mutex
+	nextDB    *DB
+	scHandle  uint16 // handle of the Service Changed value in db.
+	unaware   bool   // the client has enabled Robust Caching, and db is changed.
+	outOfSync bool   // the unaware client has been responded with ErrDBOutOfSync.
+
 	// Refer to [Vol 3, Part F, 3.3.2 & 3.3.3] for the requirement of
 	// sequential request-response protocol, and transactions.
 	rxMTU     int
 	txBuf     []byte
-	chNotBuf  chan []byte
 	chIndBuf  chan []byte
 	chConfirm chan bool
 
+	// mtu is the ATT_MTU, which is read by the notifiers on other goroutines.
+	// nextMTU is applied after the Exchange MTU Response has been sent.
+	mtu     int32
+	nextMTU int
+
+	// chNotify is the queue of the notifications, which are sent in order by
+	// the server, and notifyPolicy is what to do when it's full. done is
+	// closed when the connection is closed.
+	chNotify     chan []byte
+	notifyPolicy ble.NotifyQueuePolicy
+	done         chan struct{}
+
+	// timeout is the time an indication has to be confirmed. Once it times
+	// out, err is set, failed is closed, and the bearer is closed
+	// [Vol 3, Part F, 3.3.3].
+	timeout  time.Duration
+	failOnce sync.Once
+	failed   chan struct{}
+	err      error
+
 	dummyRspWriter ble.ResponseWriter
 
-	// Store a write handler for defer execute once receiving ExecuteWriteRequest
-	prepareWriteRequestAttr *attr
-	prepareWriteRequestData bytes.Buffer
+	// enhanced is set if the server runs on an Enhanced ATT bearer.
+	enhanced bool
+
+	// prepQueue holds the prepared writes until receiving ExecuteWriteRequest,
+	// and prepQueueSize is its capacity. exec is the value being written by the
+	// ExecuteWriteRequest.
+	prepQueue     []prepWrite
+	prepQueueSize int
+	exec          prepWrite
+
+	// ctx is the context of the requests, which is canceled when the bearer
+	// is closed.
+	ctx    context.Context
+	cancel func()
+
+	// snap is the snapshot of the value of the long read in progress.
+	snap *snapshot
+
+	// rspTimeout is the time a deferred response has to be completed.
+	rspTimeout time.Duration
+
+	// authorizer, if not nil, authorizes the accesses to the characteristic
+	// values and the descriptors.
+	authorizer ble.Authorizer
+}
+
+// DefaultPrepareQueueSize is the default number of the prepared writes queued
+// for each connection.
+const DefaultPrepareQueueSize = 64
+
+// DefaultNotifyQueueSize is the default number of the notifications queued for
+// each connection.
+const DefaultNotifyQueueSize = 16
+
+// snapshot is the value of an attribute read by a Read Request, which serves
+// the following Read Blob Requests of a long read consistently.
+type snapshot struct {
+	h uint16
+	v []byte
+}
+
+// prepWrite is a prepared write, or the value reassembled from the prepared
+// writes of an attribute [Vol 3, Part F, 3.4.6].
+type prepWrite struct {
+	h      uint16
+	offset int
+	value  []byte
 }
 
 // NewServer returns an ATT (Attribute Protocol) server.
@@ -48,62 +137,408 @@ func NewServer(db *DB, l2c ble.Conn) (*Server, error) {
 	// not discovered, and only the default ATT_MTU (23 bytes) of it shall
 	// be used until remote central request ExchangeMTU.
 	s := &Server{
-		conn: &conn{
-			Conn: l2c,
-			cccs: make(map[uint16]uint16),
-			in:   make(map[uint16]ble.Notifier),
-			nn:   make(map[uint16]ble.Notifier),
-		},
-		db: db,
+		conn: &conn{Conn: l2c},
+		db:   db,
 
 		rxMTU:     mtu,
 		txBuf:     make([]byte, ble.DefaultMTU, ble.DefaultMTU),
-		chNotBuf:  make(chan []byte, 1),
 		chIndBuf:  make(chan []byte, 1),
-		chConfirm: make(chan bool),
+		chConfirm: make(chan bool, 1),
+
+		mtu:      ble.DefaultMTU,
+		chNotify: make(chan []byte, DefaultNotifyQueueSize),
+		done:     make(chan struct{}),
+
+		timeout: DefaultTransactionTimeout,
+		failed:  make(chan struct{}),
+
+		rspTimeout: DefaultResponseTimeout,
 
 		dummyRspWriter: ble.NewResponseWriter(nil),
+
+		prepQueueSize: DefaultPrepareQueueSize,
 	}
 	s.conn.svr = s
-	s.chNotBuf <- make([]byte, ble.DefaultMTU, ble.DefaultMTU)
+	s.conn.client = &client{
+		conn: s.conn,
+		cccs: make(map[uint16]uint16),
+		in:   make(map[uint16]ble.Notifier),
+		nn:   make(map[uint16]ble.Notifier),
+	}
+	s.ctx, s.cancel = context.WithCancel(l2c.Context())
 	s.chIndBuf <- make([]byte, ble.DefaultMTU, ble.DefaultMTU)
 	return s, nil
 }
 
-// notify sends notification to remote central.
+// NewEnhancedServer returns an ATT server on an Enhanced ATT bearer, which is
+// an L2CAP channel in Enhanced Credit Based Flow Control mode [Vol 3, Part G, 5.3.2].
+// The ATT_MTU of the bearer is the MTU of the channel, and isn't exchanged.
+// us is the server of the unenhanced bearer of the same device, with which the
+// CCCDs, the subscriptions and the Client Supported Features are shared. The
+// notifications and the indications are sent on the unenhanced bearer.
+func NewEnhancedServer(db *DB, l2c ble.Conn, us *Server) (*Server, error) {
+	s, err := NewServer(db, l2c)
+	if err != nil {
+		return nil, err
+	}
+	s.enhanced = true
+	s.conn.client = us.conn.client
+	mtu := l2c.TxMTU()
+	if mtu > s.rxMTU {
+		mtu = s.rxMTU
+	}
+	s.setMTU(mtu)
+	return s, nil
+}
+
+// setMTU applies the ATT_MTU to the buffers, and the capacity of the notifiers.
+func (s *Server) setMTU(mtu int) {
+	s.txBuf = make([]byte, mtu, mtu)
+	<-s.chIndBuf
+	s.chIndBuf <- make([]byte, mtu, mtu)
+	atomic.StoreInt32(&s.mtu, int32(mtu))
+}
+
+// notifyCap returns the maximum length of the value of a notification or an
+// indication, which is ATT_MTU-3.
+func (s *Server) notifyCap() int {
+	return int(atomic.LoadInt32(&s.mtu)) - 3
+}
+
+// SetNotifyQueue sets the number of the notifications can be queued, and
+// what to do when the queue is full. It must be called before Loop.
+func (s *Server) SetNotifyQueue(n int, policy ble.NotifyQueuePolicy) {
+	s.chNotify = make(chan []byte, n)
+	s.notifyPolicy = policy
+}
+
+// SetPrepareQueueSize sets the number of the prepared writes can be queued.
+// If the queue is full, the Prepare Write Request is rejected with
+// ErrPrepQueueFull.
+func (s *Server) SetPrepareQueueSize(n int) {
+	s.prepQueueSize = n
+}
+
+// SetTransactionTimeout sets the time an indication has to be confirmed,
+// before the bearer is closed. It must be called before Loop.
+func (s *Server) SetTransactionTimeout(d time.Duration) {
+	s.timeout = d
+}
+
+// fail closes the bearer after a transaction timed out. The pending and the
+// following notifications and indications fail with err, and no more PDUs
+// are sent.
+func (s *Server) fail(err error) {
+	s.failOnce.Do(func() {
+		s.err = err
+		close(s.failed)
+		_ = s.conn.Close()
+	})
+}
+
+// closed returns the error, with which the bearer has been closed, or nil.
+func (s *Server) closed() error {
+	select {
+	case <-s.failed:
+		return s.err
+	default:
+		return nil
+	}
+}
+
+// SetResponseTimeout sets the time a deferred response has to be completed,
+// before ErrUnlikely is responded. It must be called before Loop.
+func (s *Server) SetResponseTimeout(d time.Duration) {
+	s.rspTimeout = d
+}
+
+// SetAuthorizer sets the authorizer of the accesses to the characteristic
+// values and the descriptors. It must be called before Loop.
+func (s *Server) SetAuthorizer(a ble.Authorizer) {
+	s.authorizer = a
+}
+
+// SetDB replaces the database served. The requests in progress are served
+// with the current database, and the following ones with the new one.
+func (s *Server) SetDB(db *DB) {
+	s.mu.Lock()
+	s.nextDB = db
+	s.mu.Unlock()
+}
+
+// applyDB replaces the database, if it's changed by SetDB. A client, which
+// has enabled Robust Caching, becomes change-unaware if the database is
+// changed [Vol 3, Part G, 2.5.2.1].
+func (s *Server) applyDB() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.nextDB == nil {
+		return
+	}
+	if s.db != nil && !bytes.Equal(s.db.Hash(), s.nextDB.Hash()) && s.conn.robustCaching() {
+		s.unaware, s.outOfSync = true, false
+	}
+	s.db, s.nextDB = s.nextDB, nil
+	s.snap = nil
+	s.scHandle = 0
+	for _, a := range s.db.attrs {
+		if a.typ.Equal(ble.ServiceChangedUUID) {
+			s.scHandle = a.h
+			break
+		}
+	}
+}
+
+// setAware makes the client change-aware.
+func (s *Server) setAware() {
+	s.mu.Lock()
+	s.unaware = false
+	s.mu.Unlock()
+}
+
+// checkAware checks if the request is served to a change-unaware client. If
+// it isn't, the error response is returned, or nil for a command
+// [Vol 3, Part G, 2.5.2.1].
+func (s *Server) checkAware(b []byte) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch {
+	case !s.unaware:
+		return nil, true
+	case s.outOfSync:
+		// The client has been responded with the error, and becomes change-aware.
+		s.unaware = false
+		return nil, true
+	case b[0] == ReadByTypeRequestCode && len(b) == 7 &&
+		ble.UUID(ReadByTypeRequest(b).AttributeType()).Equal(ble.DatabaseHashUUID):
+		// Reading the Database Hash makes the client change-aware.
+		return nil, true
+	case b[0]&0x40 != 0:
+		// Commands are ignored.
+		return nil, false
+	}
+	s.outOfSync = true
+	return newErrorResponse(b[0], 0x0000, ble.ErrDBOutOfSync), false
+}
+
+// Conn returns the connection of the bearer.
+func (s *Server) Conn() ble.Conn {
+	return s.conn.Conn
+}
+
+// Bearer returns the connection, which the requests of the bearer are bound to.
+func (s *Server) Bearer() ble.Conn {
+	return s.conn
+}
+
+// Enhanced reports whether the server runs on an Enhanced ATT bearer.
+func (s *Server) Enhanced() bool {
+	return s.enhanced
+}
+
+// Link returns the connection of the ACL link, which the bearers of the device
+// share the CCCDs and the subscriptions of.
+func (c *conn) Link() ble.Conn {
+	return c.client.conn.Conn
+}
+
+// saveCCC saves the value of the CCCD, if the remote device is bonded.
+// The CCCDs of a bonded device persist across connections [Vol 3, Part G, 3.3.3.3].
+func (c *client) saveCCC(h uint16, ccc uint16) {
+	bc, ok := c.conn.Conn.(ble.BondedConn)
+	if !ok {
+		return
+	}
+	if b := bc.Bond(); b == nil || b.CCCDs[h] == ccc {
+		return
+	}
+	err := bc.UpdateBond(func(b *ble.Bond) {
+		if b.CCCDs == nil {
+			b.CCCDs = make(map[uint16]uint16)
+		}
+		if ccc == 0 {
+			delete(b.CCCDs, h)
+			return
+		}
+		b.CCCDs[h] = ccc
+	})
+	if err != nil && err != ble.ErrBondNotFound {
+		logger.Error("server", "can't save CCCD", err)
+	}
+}
+
+// Security returns the security state of the link, which is reported to the
+// handlers by the requests.
+func (c *conn) Security() ble.Security {
+	if sc, ok := c.Conn.(ble.SecureConn); ok {
+		return sc.Security()
+	}
+	return ble.Security{}
+}
+
+// robustCaching reports whether the client has enabled Robust Caching.
+func (c *client) robustCaching() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.features) > 0 && c.features[0]&ble.ClientFeatureRobustCaching != 0
+}
+
+// saveFeatures saves the Client Supported Features f, if the remote device is
+// bonded. They persist across connections [Vol 3, Part G, 7.2].
+func (c *client) saveFeatures(f []byte) {
+	bc, ok := c.conn.Conn.(ble.BondedConn)
+	if !ok {
+		return
+	}
+	err := bc.UpdateBond(func(b *ble.Bond) {
+		b.ClientFeatures = append([]byte(nil), f...)
+	})
+	if err != nil && err != ble.ErrBondNotFound {
+		logger.Error("server", "can't save client features", err)
+	}
+}
+
+// restoreBond restores the CCCDs and the Client Supported Features configured
+// by the remote device in the previous connections, if it's bonded.
+func (s *Server) restoreBond() {
+	bc, ok := s.conn.Conn.(ble.BondedConn)
+	if !ok {
+		return
+	}
+	b := bc.Bond()
+	if b == nil {
+		return
+	}
+	s.conn.mu.Lock()
+	s.conn.features = append([]byte(nil), b.ClientFeatures...)
+	s.conn.mu.Unlock()
+	for h, ccc := range b.CCCDs {
+		a, ok := s.db.at(h)
+		if !ok || a.wh == nil || !a.typ.Equal(ble.ClientCharacteristicConfigUUID) {
+			continue
+		}
+		v := make([]byte, 2)
+		binary.LittleEndian.PutUint16(v, ccc)
+		req := ble.NewRequestWithContext(s.ctx, s.conn, ble.OpWrite, a.h, v, 0)
+		a.wh.ServeWrite(req, ble.NewResponseWriter(nil))
+	}
+	if b.ServiceChanged != nil {
+		if s.conn.robustCaching() {
+			s.mu.Lock()
+			s.unaware = true
+			s.mu.Unlock()
+		}
+		s.indicatePendingChange(bc, b.ServiceChanged)
+	}
+}
+
+// indicatePendingChange indicates the services changed while the bonded
+// device was disconnected, if it has enabled the indication of Service
+// Changed [Vol 3, Part G, 7.1].
+func (s *Server) indicatePendingChange(bc ble.BondedConn, r *ble.HandleRange) {
+	clear := func() {
+		err := bc.UpdateBond(func(b *ble.Bond) { b.ServiceChanged = nil })
+		if err != nil && err != ble.ErrBondNotFound {
+			logger.Error("server", "can't save bond", err)
+		}
+	}
+	var n ble.Notifier
+	if s.scHandle != 0 {
+		s.conn.mu.Lock()
+		n = s.conn.in[s.scHandle-1] // Keyed by the handle of the characteristic.
+		s.conn.mu.Unlock()
+	}
+	if n == nil {
+		clear()
+		return
+	}
+	v := make([]byte, 4)
+	binary.LittleEndian.PutUint16(v, r.Start)
+	binary.LittleEndian.PutUint16(v[2:], r.End)
+
+	// The confirmation is received after the server starts reading requests.
+	go func() {
+		if _, err := n.Write(v); err != nil {
+			return
+		}
+		clear()
+	}()
+}
+
+// notify queues a notification to remote central.
 func (s *Server) notify(h uint16, data []byte) (int, error) {
-	// Acquire and reuse notifyBuffer. Release it after usage.
-	nBuf := <-s.chNotBuf
-	defer func() { s.chNotBuf <- nBuf }()
+	if err := s.closed(); err != nil {
+		return 0, err
+	}
+	if len(data) > s.notifyCap() {
+		return 0, ble.ErrValueTooLong
+	}
+	ntf := HandleValueNotification(make([]byte, 3+len(data)))
+	ntf.SetAttributeOpcode()
+	ntf.SetAttributeHandle(h)
+	copy(ntf.AttributeValue(), data)
+
+	if s.notifyPolicy == ble.NotifyQueueDrop {
+		select {
+		case <-s.done:
+			return 0, io.ErrClosedPipe
+		case <-s.failed:
+			return 0, s.err
+		case s.chNotify <- ntf:
+			return len(data), nil
+		default:
+			return 0, ble.ErrNotifyQueueFull
+		}
+	}
+	select {
+	case <-s.done:
+		return 0, io.ErrClosedPipe
+	case <-s.failed:
+		return 0, s.err
+	case s.chNotify <- ntf:
+		return len(data), nil
+	}
+}
 
-	rsp := HandleValueNotification(nBuf)
-	rsp.SetAttributeOpcode()
-	rsp.SetAttributeHandle(h)
-	buf := bytes.NewBuffer(rsp.AttributeValue())
-	buf.Reset()
-	if len(data) > buf.Cap() {
-		data = data[:buf.Cap()]
+// sendNotifications sends the queued notifications until the connection is closed.
+func (s *Server) sendNotifications() {
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-s.failed:
+			return
+		case ntf := <-s.chNotify:
+			if _, err := s.conn.Write(ntf); err != nil {
+				logger.Error("server", "can't send notification", err)
+			}
+		}
 	}
-	buf.Write(data)
-	return s.conn.Write(rsp[:3+buf.Len()])
 }
 
-// indicate sends indication to remote central.
 func (s *Server) indicate(h uint16, data []byte) (int, error) {
 	// Acquire and reuse indicateBuffer. Release it after usage.
 	iBuf := <-s.chIndBuf
 	defer func() { s.chIndBuf <- iBuf }()
 
+	if err := s.closed(); err != nil {
+		return 0, err
+	}
+	if len(data) > len(iBuf)-3 {
+		return 0, ble.ErrValueTooLong
+	}
 	rsp := HandleValueIndication(iBuf)
 	rsp.SetAttributeOpcode()
 	rsp.SetAttributeHandle(h)
-	buf := bytes.NewBuffer(rsp.AttributeValue())
-	buf.Reset()
-	if len(data) > buf.Cap() {
-		data = data[:buf.Cap()]
+	n := copy(rsp.AttributeValue(), data)
+
+	// The confirmation is buffered, since it may arrive before the select.
+	// Discard a spurious one, which has arrived before the indication.
+	select {
+	case <-s.chConfirm:
+	default:
 	}
-	buf.Write(data)
-	n, err := s.conn.Write(rsp[:3+buf.Len()])
+	_, err := s.conn.Write(rsp[:3+n])
 	if err != nil {
 		return n, err
 	}
@@ -112,8 +547,15 @@ func (s *Server) indicate(h uint16, data []byte) (int, error) {
 		if !ok {
 			return 0, io.ErrClosedPipe
 		}
+		// Confirming Service Changed makes the client change-aware.
+		s.mu.Lock()
+		if h == s.scHandle {
+			s.unaware = false
+		}
+		s.mu.Unlock()
 		return n, nil
-	case <-time.After(time.Second * 30):
+	case <-time.After(s.timeout):
+		s.fail(ErrSeqProtoTimeout)
 		return 0, ErrSeqProtoTimeout
 	}
 }
@@ -128,6 +570,12 @@ func (s *Server) Loop() {
 	pool <- &sbuf{buf: make([]byte, s.rxMTU)}
 	pool <- &sbuf{buf: make([]byte, s.rxMTU)}
 
+	go s.sendNotifications()
+	s.applyDB()
+	if !s.enhanced {
+		s.restoreBond()
+	}
+
 	seq := make(chan *sbuf)
 	go func() {
 		b := <-pool
@@ -153,22 +601,40 @@ func (s *Server) Loop() {
 		}
 	}()
 	for req := range seq {
+		s.applyDB()
 		if rsp := s.handleRequest(req.buf[:req.len]); rsp != nil {
-			if len(rsp) != 0 {
+			if len(rsp) != 0 && s.closed() == nil {
 				s.conn.Write(rsp)
 			}
 		}
+		if s.nextMTU != 0 {
+			s.setMTU(s.nextMTU)
+			s.nextMTU = 0
+		}
 		pool <- req
 	}
-	for h, ccc := range s.conn.cccs {
+	// The subscriptions of the device are closed with the unenhanced bearer,
+	// which is closed when the device disconnects.
+	if !s.enhanced {
+		s.conn.closeSubscriptions()
+	}
+	close(s.done)
+	s.cancel()
+}
+
+// closeSubscriptions closes the notifiers of the device.
+func (c *client) closeSubscriptions() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for h, ccc := range c.cccs {
 		if ccc != 0 {
 			logger.Info("cleanup", ble.ContextKeyCCC, fmt.Sprintf("0x%02X", ccc))
 		}
 		if ccc&cccIndicate != 0 {
-			s.conn.in[h].Close()
+			c.in[h].Close()
 		}
 		if ccc&cccNotify != 0 {
-			s.conn.nn[h].Close()
+			c.nn[h].Close()
 		}
 	}
 }
@@ -176,6 +642,9 @@ func (s *Server) Loop() {
 func (s *Server) handleRequest(b []byte) []byte {
 	var resp []byte
 	logger.Debug("server", "req", fmt.Sprintf("% X", b))
+	if rsp, ok := s.checkAware(b); !ok {
+		return rsp
+	}
 	switch reqType := b[0]; reqType {
 	case ExchangeMTURequestCode:
 		resp = s.handleExchangeMTURequest(b)
@@ -199,9 +668,12 @@ func (s *Server) handleRequest(b []byte) []byte {
 		resp = s.handlePrepareWriteRequest(b)
 	case ExecuteWriteRequestCode:
 		resp = s.handleExecuteWriteRequest(b)
-	case ReadMultipleRequestCode,
-		SignedWriteCommandCode:
-		fallthrough
+	case SignedWriteCommandCode:
+		s.handleSignedWriteCommand(b)
+	case ReadMultipleRequestCode:
+		resp = s.handleReadMultipleRequest(b)
+	case ReadMultipleVariableRequestCode:
+		resp = s.handleReadMultipleVariableRequest(b)
 	default:
 		resp = newErrorResponse(reqType, 0x0000, ble.ErrReqNotSupp)
 	}
@@ -213,6 +685,9 @@ func (s *Server) handleRequest(b []byte) []byte {
 func (s *Server) handleExchangeMTURequest(r ExchangeMTURequest) []byte {
 	// Validate the request.
 	switch {
+	case s.enhanced:
+		// The MTU of an Enhanced ATT bearer isn't exchanged [Vol 3, Part F, 3.4.2.1].
+		return newErrorResponse(r.AttributeOpcode(), 0x0000, ble.ErrReqNotSupp)
 	case len(r) != 3:
 		fallthrough
 	case r.ClientRxMTU() < 23:
@@ -222,16 +697,15 @@ func (s *Server) handleExchangeMTURequest(r ExchangeMTURequest) []byte {
 	txMTU := int(r.ClientRxMTU())
 	s.conn.SetTxMTU(txMTU)
 
-	if txMTU != len(s.txBuf) {
-		// Apply the txMTU afer this response has been sent and before
+	// The ATT_MTU is the minimum of the MTUs of the client and the server.
+	mtu := txMTU
+	if mtu > s.rxMTU {
+		mtu = s.rxMTU
+	}
+	if mtu != len(s.txBuf) {
+		// Apply the ATT_MTU afer this response has been sent and before
 		// any other attribute protocol PDU is sent.
-		defer func() {
-			s.txBuf = make([]byte, txMTU, txMTU)
-			<-s.chNotBuf
-			s.chNotBuf <- make([]byte, txMTU, txMTU)
-			<-s.chIndBuf
-			s.chIndBuf <- make([]byte, txMTU, txMTU)
-		}()
+		s.nextMTU = mtu
 	}
 
 	rsp := ExchangeMTUResponse(s.txBuf)
@@ -356,7 +830,14 @@ func (s *Server) handleReadByTypeRequest(r ReadByTypeRequest) []byte {
 			continue
 		}
 		v := a.v
-		if v == nil {
+		if v != nil {
+			if e := s.checkAccess(a, opOf(r[0])); e != ble.ErrSuccess {
+				if dlen == 0 {
+					return newErrorResponse(r.AttributeOpcode(), a.h, e)
+				}
+				break
+			}
+		} else {
 			buf2 := bytes.NewBuffer(make([]byte, 0, len(s.txBuf)-2))
 			if e := handleATT(a, s, r, ble.NewResponseWriter(buf2)); e != ble.ErrSuccess {
 				// Return if the first value read cause an error.
@@ -407,15 +888,35 @@ func (s *Server) handleReadRequest(r ReadRequest) []byte {
 	buf := bytes.NewBuffer(rsp.AttributeValue())
 	buf.Reset()
 
+	// A new read drops the snapshot of the previous long read.
+	s.snap = nil
+
 	a, ok := s.db.at(r.AttributeHandle())
 	if !ok {
 		return newErrorResponse(r.AttributeOpcode(), r.AttributeHandle(), ble.ErrInvalidHandle)
 	}
 
-	// Simple case. Read-only, no-authorization, no-authentication.
+	// Simple case. Read-only, no-authorization.
 	if a.v != nil {
-		binary.Write(buf, binary.LittleEndian, a.v)
-		return rsp[:1+buf.Len()]
+		if e := s.checkAccess(a, opOf(r[0])); e != ble.ErrSuccess {
+			return newErrorResponse(r.AttributeOpcode(), r.AttributeHandle(), e)
+		}
+		n := copy(rsp.AttributeValue(), a.v)
+		return rsp[:1+n]
+	}
+
+	// The whole value is read, and kept for the Read Blob Requests following,
+	// if it's longer than the response.
+	if a.snapshot {
+		v, e := s.readValue(a.h, r)
+		if e != ble.ErrSuccess {
+			return newErrorResponse(r.AttributeOpcode(), r.AttributeHandle(), e)
+		}
+		n := copy(rsp.AttributeValue(), v)
+		if n < len(v) {
+			s.snap = &snapshot{h: a.h, v: v}
+		}
+		return rsp[:1+n]
 	}
 
 	// Pass the request to upper layer with the ResponseWriter, which caps
@@ -426,6 +927,80 @@ func (s *Server) handleReadRequest(r ReadRequest) []byte {
 	return rsp[:1+buf.Len()]
 }
 
+// handle Read Multiple request. [Vol 3, Part F, 3.4.4.7 & 3.4.4.8]
+func (s *Server) handleReadMultipleRequest(r ReadMultipleRequest) []byte {
+	// Validate the request.
+	switch {
+	case len(r) < 5 || len(r)%2 != 1:
+		return newErrorResponse(r.AttributeOpcode(), 0x0000, ble.ErrInvalidPDU)
+	}
+
+	var vals bytes.Buffer
+	hs := r.SetOfHandles()
+	for ; len(hs) > 0; hs = hs[2:] {
+		h := binary.LittleEndian.Uint16(hs)
+		v, e := s.readValue(h, r)
+		if e != ble.ErrSuccess {
+			return newErrorResponse(r.AttributeOpcode(), h, e)
+		}
+		vals.Write(v)
+	}
+
+	// The values are truncated to ATT_MTU-1 octets.
+	rsp := ReadMultipleResponse(s.txBuf)
+	rsp.SetAttributeOpcode()
+	n := copy(rsp.SetOfValues(), vals.Bytes())
+	return rsp[:1+n]
+}
+
+// handle Read Multiple Variable request. [Vol 3, Part F, 3.4.4.11 & 3.4.4.12]
+func (s *Server) handleReadMultipleVariableRequest(r ReadMultipleVariableRequest) []byte {
+	// Validate the request.
+	switch {
+	case len(r) < 5 || len(r)%2 != 1:
+		return newErrorResponse(r.AttributeOpcode(), 0x0000, ble.ErrInvalidPDU)
+	}
+
+	var tuples bytes.Buffer
+	hs := r.SetOfHandles()
+	for ; len(hs) > 0; hs = hs[2:] {
+		h := binary.LittleEndian.Uint16(hs)
+		v, e := s.readValue(h, r)
+		if e != ble.ErrSuccess {
+			return newErrorResponse(r.AttributeOpcode(), h, e)
+		}
+		binary.Write(&tuples, binary.LittleEndian, uint16(len(v)))
+		tuples.Write(v)
+	}
+
+	// The list of the length value tuples is truncated to ATT_MTU-1 octets.
+	rsp := ReadMultipleVariableResponse(s.txBuf)
+	rsp.SetAttributeOpcode()
+	n := copy(rsp.LengthValueTupleList(), tuples.Bytes())
+	return rsp[:1+n]
+}
+
+// readValue reads the whole value of the attribute for the request, which
+// reads the values of multiple attributes.
+func (s *Server) readValue(h uint16, r []byte) ([]byte, ble.ATTError) {
+	a, ok := s.db.at(h)
+	if !ok {
+		return nil, ble.ErrInvalidHandle
+	}
+	if a.v != nil {
+		if e := s.checkAccess(a, opOf(r[0])); e != ble.ErrSuccess {
+			return nil, e
+		}
+		return a.v, ble.ErrSuccess
+	}
+	// The maximum length of an attribute value shall be 512 octets [Vol 3, Part F, 3.2.9].
+	buf := bytes.NewBuffer(make([]byte, 0, ble.MaxMTU-3))
+	if e := handleATT(a, s, r, ble.NewResponseWriter(buf)); e != ble.ErrSuccess {
+		return nil, e
+	}
+	return buf.Bytes(), ble.ErrSuccess
+}
+
 // handle Read Blob request. [Vol 3, Part F, 3.4.4.5 & 3.4.4.6]
 func (s *Server) handleReadBlobRequest(r ReadBlobRequest) []byte {
 	// Validate the request.
@@ -444,10 +1019,35 @@ func (s *Server) handleReadBlobRequest(r ReadBlobRequest) []byte {
 	buf := bytes.NewBuffer(rsp.PartAttributeValue())
 	buf.Reset()
 
-	// Simple case. Read-only, no-authorization, no-authentication.
+	// Serve the long read from the snapshot taken by the Read Request, which
+	// is dropped after the last part of the value. Each part is still subject
+	// to the security and the authorization of the access.
+	offset := int(r.ValueOffset())
+	if sn := s.snap; sn != nil && sn.h == a.h && offset > 0 {
+		if e := s.checkAccess(a, opOf(r[0])); e != ble.ErrSuccess {
+			s.snap = nil
+			return newErrorResponse(r.AttributeOpcode(), r.AttributeHandle(), e)
+		}
+		if offset > len(sn.v) {
+			return newErrorResponse(r.AttributeOpcode(), r.AttributeHandle(), ble.ErrInvalidOffset)
+		}
+		n := copy(rsp.PartAttributeValue(), sn.v[offset:])
+		if n < len(rsp.PartAttributeValue()) {
+			s.snap = nil
+		}
+		return rsp[:1+n]
+	}
+
+	// Simple case. Read-only, no-authorization.
 	if a.v != nil {
-		binary.Write(buf, binary.LittleEndian, a.v)
-		return rsp[:1+buf.Len()]
+		if e := s.checkAccess(a, opOf(r[0])); e != ble.ErrSuccess {
+			return newErrorResponse(r.AttributeOpcode(), r.AttributeHandle(), e)
+		}
+		if offset > len(a.v) {
+			return newErrorResponse(r.AttributeOpcode(), r.AttributeHandle(), ble.ErrInvalidOffset)
+		}
+		n := copy(rsp.PartAttributeValue(), a.v[offset:])
+		return rsp[:1+n]
 	}
 
 	// Pass the request to upper layer with the ResponseWriter, which caps
@@ -468,6 +1068,12 @@ func (s *Server) handleReadByGroupRequest(r ReadByGroupTypeRequest) []byte {
 		return newErrorResponse(r.AttributeOpcode(), r.StartingHandle(), ble.ErrInvalidHandle)
 	}
 
+	// Only the service declarations are grouping attributes [Vol 3, Part G, 2.5.3].
+	typ := ble.UUID(r.AttributeGroupType())
+	if !typ.Equal(ble.PrimaryServiceUUID) && !typ.Equal(ble.SecondaryServiceUUID) {
+		return newErrorResponse(r.AttributeOpcode(), r.StartingHandle(), ble.ErrUnsuppGrpType)
+	}
+
 	rsp := ReadByGroupTypeResponse(s.txBuf)
 	rsp.SetAttributeOpcode()
 	buf := bytes.NewBuffer(rsp.AttributeDataList())
@@ -475,6 +1081,9 @@ func (s *Server) handleReadByGroupRequest(r ReadByGroupTypeRequest) []byte {
 
 	dlen := 0
 	for _, a := range s.db.subrange(r.StartingHandle(), r.EndingHandle()) {
+		if !a.typ.Equal(typ) {
+			continue
+		}
 		v := a.v
 		if v == nil {
 			buf2 := bytes.NewBuffer(make([]byte, buf.Cap()-buf.Len()-4))
@@ -532,11 +1141,12 @@ func (s *Server) handleWriteRequest(r WriteRequest) []byte {
 	return []byte{WriteResponseCode}
 }
 
+// handle Prepare Write request. [Vol 3, Part F, 3.4.6.1 & 3.4.6.2]
 func (s *Server) handlePrepareWriteRequest(r PrepareWriteRequest) []byte {
 	logger.Debug("handlePrepareWriteRequest ->", "r.AttributeHandle", r.AttributeHandle())
 	// Validate the request.
 	switch {
-	case len(r) < 3:
+	case len(r) < 5:
 		return newErrorResponse(r.AttributeOpcode(), 0x0000, ble.ErrInvalidPDU)
 	}
 
@@ -550,38 +1160,119 @@ func (s *Server) handlePrepareWriteRequest(r PrepareWriteRequest) []byte {
 		return newErrorResponse(r.AttributeOpcode(), r.AttributeHandle(), ble.ErrWriteNotPerm)
 	}
 
+	// The permissions are checked when the value is prepared.
 	if e := handleATT(a, s, r, ble.NewResponseWriter(nil)); e != ble.ErrSuccess {
 		return newErrorResponse(r.AttributeOpcode(), r.AttributeHandle(), e)
 	}
 
-	// Convert and validate the response.
+	if len(s.prepQueue) >= s.prepQueueSize {
+		return newErrorResponse(r.AttributeOpcode(), r.AttributeHandle(), ble.ErrPrepQueueFull)
+	}
+
+	// The offset and the length of the value are validated on execution, and
+	// not reported in the Prepare Write Response [Vol 3, Part F, 3.4.6.1].
+	s.prepQueue = append(s.prepQueue, prepWrite{
+		h:      r.AttributeHandle(),
+		offset: int(r.ValueOffset()),
+		value:  append([]byte(nil), r.PartAttributeValue()...),
+	})
+
+	// The response echoes the request.
 	rsp := PrepareWriteResponse(r)
 	rsp.SetAttributeOpcode()
 	return rsp
 }
 
+// handle Execute Write request. [Vol 3, Part F, 3.4.6.3 & 3.4.6.4]
 func (s *Server) handleExecuteWriteRequest(r ExecuteWriteRequest) []byte {
 	// Validate the request.
 	switch {
-	case len(r) < 2:
+	case len(r) < 2 || r.Flags() > 1:
 		return newErrorResponse(r.AttributeOpcode(), 0x0000, ble.ErrInvalidPDU)
 	}
 
-	switch r.Flags() {
-	case 0:
-		// 0x00 – Cancel all prepared writes
-		s.prepareWriteRequestAttr = nil
-	case 1:
-		// 0x01 – Immediately write all pending prepared values
-		a := s.prepareWriteRequestAttr
-		if e := handleATT(a, s, r, ble.NewResponseWriter(nil)); e != ble.ErrSuccess {
-			return newErrorResponse(r.AttributeOpcode(), 0, e)
-		}
+	// The queue is cleared either the values are written or cancelled.
+	q := s.prepQueue
+	s.prepQueue = nil
+
+	// 0x00 – Cancel all prepared writes
+	if r.Flags() == 0 {
+		return []byte{ExecuteWriteResponseCode}
 	}
 
+	// 0x01 – Immediately write all pending prepared values
+	vals, h, e := reassemble(q)
+	if e != ble.ErrSuccess {
+		return newErrorResponse(r.AttributeOpcode(), h, e)
+	}
+
+	// All the values are checked before any of them is written, so the
+	// writes are applied either all or none.
+	attrs := make([]*attr, len(vals))
+	for i, v := range vals {
+		a, ok := s.db.at(v.h)
+		if !ok {
+			return newErrorResponse(r.AttributeOpcode(), v.h, ble.ErrInvalidHandle)
+		}
+		if e := s.checkExecuteWrite(a, v); e != ble.ErrSuccess {
+			return newErrorResponse(r.AttributeOpcode(), v.h, e)
+		}
+		attrs[i] = a
+	}
+	for i, v := range vals {
+		a := attrs[i]
+		s.exec = v
+		e := handleATT(a, s, r, ble.NewResponseWriter(nil))
+		s.exec = prepWrite{}
+		if e != ble.ErrSuccess {
+			return newErrorResponse(r.AttributeOpcode(), v.h, e)
+		}
+	}
 	return []byte{ExecuteWriteResponseCode}
 }
 
+// checkExecuteWrite checks the access to the attribute, and the reassembled
+// value to be written to it.
+func (s *Server) checkExecuteWrite(a *attr, v prepWrite) ble.ATTError {
+	if e := s.checkAccess(a, ble.OpExecuteWrite); e != ble.ErrSuccess {
+		return e
+	}
+	if a.wh == nil {
+		return ble.ErrWriteNotPerm
+	}
+	return a.validate(v.offset, v.value)
+}
+
+// reassemble reassembles the prepared writes into one value per attribute,
+// in the order of the attributes first prepared. The parts of an attribute
+// shall be contiguous, and may overwrite the preceding ones. On failure, it
+// returns the handle of the attribute in error.
+func reassemble(q []prepWrite) ([]prepWrite, uint16, ble.ATTError) {
+	var vals []prepWrite
+	idx := make(map[uint16]int)
+	for _, p := range q {
+		i, ok := idx[p.h]
+		if !ok {
+			i = len(vals)
+			idx[p.h] = i
+			vals = append(vals, prepWrite{h: p.h, offset: p.offset})
+		}
+		v := &vals[i]
+		off := p.offset - v.offset
+		if off < 0 || off > len(v.value) {
+			return nil, p.h, ble.ErrInvalidOffset
+		}
+		if p.offset+len(p.value) > ble.MaxMTU-3 {
+			return nil, p.h, ble.ErrInvalAttrValueLen
+		}
+		if n := off + len(p.value); n > len(v.value) {
+			v.value = append(v.value, make([]byte, n-len(v.value))...)
+		}
+		copy(v.value[off:], p.value)
+	}
+	return vals, 0, ble.ErrSuccess
+}
+
 // handle Write command. [Vol 3, Part F, 3.4.5.3]
 func (s *Server) handleWriteCommand(r WriteCommand) []byte {
 	// Validate the request.
@@ -605,6 +1296,42 @@ func (s *Server) handleWriteCommand(r WriteCommand) []byte {
 	return nil
 }
 
+// handle Signed Write command. [Vol 3, Part F, 3.4.5.4]
+func (s *Server) handleSignedWriteCommand(r SignedWriteCommand) []byte {
+	// Validate the request.
+	switch {
+	case len(r) < 15:
+		return nil
+	}
+
+	a, ok := s.db.at(r.AttributeHandle())
+	if !ok || !a.signed {
+		return nil
+	}
+
+	// The signature authenticates the data in place of the encryption of
+	// the link [Vol 3, Part C, 10.2.2].
+	sc, ok := s.conn.Conn.(ble.SigningConn)
+	if !ok {
+		return nil
+	}
+	if err := sc.Verify(r[:len(r)-12], r.AuthenticationSignature()); err != nil {
+		logger.Error("server", "signed write", err)
+		return nil
+	}
+	if a.perm&ble.PermWriteAuthenticated != 0 {
+		bc, ok := s.conn.Conn.(ble.BondedConn)
+		if !ok {
+			return nil
+		}
+		if b := bc.Bond(); b == nil || !b.Authenticated {
+			return nil
+		}
+	}
+	handleATT(a, s, r, s.dummyRspWriter)
+	return nil
+}
+
 func newErrorResponse(op byte, h uint16, s ble.ATTError) []byte {
 	r := ErrorResponse(make([]byte, 5))
 	r.SetAttributeOpcode()
@@ -614,46 +1341,151 @@ func newErrorResponse(op byte, h uint16, s ble.ATTError) []byte {
 	return r
 }
 
+// checkSecurity checks if the link meets the security required to read or
+// write the attribute [Vol 3, Part F, 3.2.5]. If it doesn't, the link is
+// notified, and may ask the remote device to pair.
+func (s *Server) checkSecurity(a *attr, write bool) ble.ATTError {
+	enc, auth := ble.PermReadEncrypted, ble.PermReadAuthenticated
+	if write {
+		enc, auth = ble.PermWriteEncrypted, ble.PermWriteAuthenticated
+	}
+	if a.perm&(enc|auth) == 0 {
+		return ble.ErrSuccess
+	}
+	required := ble.Security{Encrypted: true, Authenticated: a.perm&auth != 0, KeySize: a.keySize}
+
+	sc, ok := s.conn.Conn.(ble.SecureConn)
+	var cur ble.Security
+	if ok {
+		cur = sc.Security()
+	}
+	e := ble.ErrSuccess
+	switch {
+	case required.Authenticated && !cur.Authenticated:
+		e = ble.ErrAuthentication
+	case !cur.Encrypted:
+		e = ble.ErrInsuffEnc
+	case cur.KeySize < required.KeySize:
+		e = ble.ErrInsuffEncrKeySize
+	}
+	if e != ble.ErrSuccess && ok {
+		sc.InsufficientSecurity(required)
+	}
+	return e
+}
+
+// checkAccess checks the security of the link, and then authorizes the access
+// to the attribute.
+func (s *Server) checkAccess(a *attr, op ble.Operation) ble.ATTError {
+	if e := s.checkSecurity(a, op.IsWrite()); e != ble.ErrSuccess {
+		return e
+	}
+	return s.authorize(a, op)
+}
+
+// authorize asks the authorizer, if any, whether the remote device may read
+// or write the characteristic value or the descriptor [Vol 3, Part F, 3.2.7].
+func (s *Server) authorize(a *attr, op ble.Operation) ble.ATTError {
+	if s.authorizer == nil || a.c == nil {
+		return ble.ErrSuccess
+	}
+	acc := ble.Access{
+		Conn:           s.conn.Conn,
+		Addr:           s.conn.RemoteAddr(),
+		Handle:         a.h,
+		UUID:           a.typ,
+		Characteristic: a.c,
+		Descriptor:     a.d,
+		Op:             op,
+	}
+	if sc, ok := s.conn.Conn.(ble.SecureConn); ok {
+		acc.Security = sc.Security()
+	}
+	if bc, ok := s.conn.Conn.(ble.BondedConn); ok {
+		if b := bc.Bond(); b != nil {
+			acc.Identity = ble.NewAddr(b.Addr)
+		}
+	}
+	return s.authorizer.Authorize(acc)
+}
+
+// opOf returns the operation of the request or the command.
+func opOf(code byte) ble.Operation {
+	switch code {
+	case WriteRequestCode:
+		return ble.OpWrite
+	case ReadBlobRequestCode:
+		return ble.OpReadBlob
+	case ReadByTypeRequestCode:
+		return ble.OpReadByType
+	case ReadMultipleRequestCode, ReadMultipleVariableRequestCode:
+		return ble.OpReadMultiple
+	case WriteCommandCode:
+		return ble.OpWriteCommand
+	case SignedWriteCommandCode:
+		return ble.OpSignedWrite
+	case PrepareWriteRequestCode:
+		return ble.OpPrepareWrite
+	case ExecuteWriteRequestCode:
+		return ble.OpExecuteWrite
+	}
+	return ble.OpRead
+}
+
 func handleATT(a *attr, s *Server, req []byte, rsp ble.ResponseWriter) ble.ATTError {
 	rsp.SetStatus(ble.ErrSuccess)
+	op := opOf(req[0])
+	switch {
+	case op == ble.OpSignedWrite:
+		// The signature has been verified in place of the security of the link.
+		if e := s.authorize(a, op); e != ble.ErrSuccess {
+			return e
+		}
+	case op == ble.OpExecuteWrite:
+		// The values have been checked before they are written.
+	default:
+		if e := s.checkAccess(a, op); e != ble.ErrSuccess {
+			return e
+		}
+	}
+	// The handlers may defer the responses, but not the commands.
+	var d *deferrable
+	if op != ble.OpWriteCommand && op != ble.OpSignedWrite {
+		d = newDeferrable(rsp)
+		rsp = d
+	}
 	var offset int
 	var data []byte
 	conn := s.conn
+	newRequest := func() ble.Request {
+		return ble.NewRequestWithContext(s.ctx, conn, op, a.h, data, offset)
+	}
 	switch req[0] {
-	case ReadByTypeRequestCode:
+	case ReadByTypeRequestCode, ReadMultipleRequestCode, ReadMultipleVariableRequestCode:
 		fallthrough
 	case ReadRequestCode:
 		if a.rh == nil {
 			return ble.ErrReadNotPerm
 		}
-		a.rh.ServeRead(ble.NewRequest(conn, data, offset), rsp)
+		a.rh.ServeRead(newRequest(), rsp)
 	case ReadBlobRequestCode:
 		if a.rh == nil {
 			return ble.ErrReadNotPerm
 		}
 		offset = int(ReadBlobRequest(req).ValueOffset())
-		a.rh.ServeRead(ble.NewRequest(conn, data, offset), rsp)
+		a.rh.ServeRead(newRequest(), rsp)
 	case PrepareWriteRequestCode:
 		if a.wh == nil {
 			return ble.ErrWriteNotPerm
 		}
-		data = PrepareWriteRequest(req).PartAttributeValue()
-		logger.Debug("handleATT", "PartAttributeValue",
-			fmt.Sprintf("data: %x, offset: %d, %p\n", data, int(PrepareWriteRequest(req).ValueOffset()), s.prepareWriteRequestAttr))
-
-		if s.prepareWriteRequestAttr == nil {
-			s.prepareWriteRequestAttr = a
-			s.prepareWriteRequestData.Reset()
-		}
-		s.prepareWriteRequestData.Write(data)
-
+		// The value is queued, and written on execution.
 	case ExecuteWriteRequestCode:
 		if a.wh == nil {
 			return ble.ErrWriteNotPerm
 		}
-		data = s.prepareWriteRequestData.Bytes()
-		a.wh.ServeWrite(ble.NewRequest(conn, data, offset), rsp)
-		s.prepareWriteRequestAttr = nil
+		// The reassembled value has been validated by checkExecuteWrite.
+		data, offset = s.exec.value, s.exec.offset
+		a.wh.ServeWrite(newRequest(), rsp)
 	case WriteRequestCode:
 		fallthrough
 	case WriteCommandCode:
@@ -661,13 +1493,26 @@ func handleATT(a *attr, s *Server, req []byte, rsp ble.ResponseWriter) ble.ATTEr
 			return ble.ErrWriteNotPerm
 		}
 		data = WriteRequest(req).AttributeValue()
-		a.wh.ServeWrite(ble.NewRequest(conn, data, offset), rsp)
-	// case SignedWriteCommandCode:
+		if e := a.validate(offset, data); e != ble.ErrSuccess {
+			return e
+		}
+		a.wh.ServeWrite(newRequest(), rsp)
+	case SignedWriteCommandCode:
+		if a.wh == nil {
+			return ble.ErrWriteNotPerm
+		}
+		data = SignedWriteCommand(req).AttributeValue()
+		if e := a.validate(offset, data); e != ble.ErrSuccess {
+			return e
+		}
+		a.wh.ServeWrite(newRequest(), rsp)
 	// case ReadByGroupTypeRequestCode:
-	// case ReadMultipleRequestCode:
 	default:
 		return ble.ErrReqNotSupp
 	}
 
+	if d != nil {
+		return d.wait(s.rspTimeout, s.conn.Disconnected())
+	}
 	return rsp.Status()
 }
@@ -0,0 +1,600 @@
+package att
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/runtimeco/ble"
+)
+
+// fakeConn is an L2CAP connection, of which the server is driven by calling
+// handleRequest directly.
+type fakeConn struct {
+	disconnected chan struct{}
+}
+
+func newFakeConn() *fakeConn { return &fakeConn{disconnected: make(chan struct{})} }
+
+func (c *fakeConn) Read(b []byte) (int, error)     { <-c.disconnected; return 0, nil }
+func (c *fakeConn) Write(b []byte) (int, error)    { return len(b), nil }
+func (c *fakeConn) Close() error                   { return nil }
+func (c *fakeConn) Context() context.Context       { return context.Background() }
+func (c *fakeConn) SetContext(ctx context.Context) {}
+func (c *fakeConn) LocalAddr() ble.Addr            { return ble.NewAddr("00:00:00:00:00:01") }
+func (c *fakeConn) RemoteAddr() ble.Addr           { return ble.NewAddr("00:00:00:00:00:02") }
+func (c *fakeConn) RxMTU() int                     { return ble.DefaultMTU }
+func (c *fakeConn) SetRxMTU(mtu int)               {}
+func (c *fakeConn) TxMTU() int                     { return ble.DefaultMTU }
+func (c *fakeConn) SetTxMTU(mtu int)               {}
+func (c *fakeConn) Disconnected() <-chan struct{}  { return c.disconnected }
+
+// newTestServer returns a server of the service on a fakeConn.
+func newTestServer(t *testing.T, svc *ble.Service) *Server {
+	db, err := NewDB([]*ble.Service{svc}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewServer(db, newFakeConn())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func request(code byte, h uint16, b ...byte) []byte {
+	return append([]byte{code, byte(h), byte(h >> 8)}, b...)
+}
+
+func errorResponse(code byte, h uint16, e ble.ATTError) []byte {
+	return []byte{ErrorResponseCode, code, byte(h), byte(h >> 8), byte(e)}
+}
+
+func TestDeferredRead(t *testing.T) {
+	svc := ble.NewService(ble.UUID16(0x1234))
+	c := svc.NewCharacteristic(ble.UUID16(0x5678))
+	c.HandleRead(ble.ReadHandlerFunc(func(req ble.Request, rsp ble.ResponseWriter) {
+		done := rsp.(ble.DeferrableResponseWriter).Defer()
+		go func() {
+			time.Sleep(10 * time.Millisecond)
+			rsp.Write([]byte{0x01, 0x02})
+			done()
+		}()
+	}))
+	s := newTestServer(t, svc)
+
+	got := s.handleRequest(request(ReadRequestCode, c.ValueHandle))
+	if want := []byte{ReadResponseCode, 0x01, 0x02}; !bytes.Equal(got, want) {
+		t.Errorf("response % X, want % X", got, want)
+	}
+}
+
+func TestDeferredReadTimeout(t *testing.T) {
+	svc := ble.NewService(ble.UUID16(0x1234))
+	c := svc.NewCharacteristic(ble.UUID16(0x5678))
+	written := make(chan error, 1)
+	c.HandleRead(ble.ReadHandlerFunc(func(req ble.Request, rsp ble.ResponseWriter) {
+		rsp.(ble.DeferrableResponseWriter).Defer()
+		go func() {
+			time.Sleep(50 * time.Millisecond)
+			_, err := rsp.Write([]byte{0x01})
+			written <- err
+		}()
+	}))
+	s := newTestServer(t, svc)
+	s.SetResponseTimeout(10 * time.Millisecond)
+
+	got := s.handleRequest(request(ReadRequestCode, c.ValueHandle))
+	if want := errorResponse(ReadRequestCode, c.ValueHandle, ble.ErrUnlikely); !bytes.Equal(got, want) {
+		t.Errorf("response % X, want % X", got, want)
+	}
+	if err := <-written; err == nil {
+		t.Error("late write of the timed out response succeeded")
+	}
+}
+
+func TestSnapshotRead(t *testing.T) {
+	value := bytes.Repeat([]byte{0xAA}, 30)
+	svc := ble.NewService(ble.UUID16(0x1234))
+	c := svc.NewCharacteristic(ble.UUID16(0x5678))
+	c.SnapshotRead = true
+	c.HandleRead(ble.ReadHandlerFunc(func(req ble.Request, rsp ble.ResponseWriter) {
+		rsp.Write(value[req.Offset():])
+	}))
+	s := newTestServer(t, svc)
+	blob := func(offset uint16) []byte {
+		return s.handleRequest(request(ReadBlobRequestCode, c.ValueHandle, byte(offset), byte(offset>>8)))
+	}
+
+	got := s.handleRequest(request(ReadRequestCode, c.ValueHandle))
+	if want := append([]byte{ReadResponseCode}, bytes.Repeat([]byte{0xAA}, 22)...); !bytes.Equal(got, want) {
+		t.Fatalf("read response % X, want % X", got, want)
+	}
+
+	// The value changed during the long read is served from the snapshot.
+	value = bytes.Repeat([]byte{0xBB}, 30)
+	got = blob(22)
+	if want := append([]byte{ReadBlobResponseCode}, bytes.Repeat([]byte{0xAA}, 8)...); !bytes.Equal(got, want) {
+		t.Errorf("read blob response % X, want % X", got, want)
+	}
+
+	// The snapshot is dropped after the last part.
+	got = blob(22)
+	if want := append([]byte{ReadBlobResponseCode}, bytes.Repeat([]byte{0xBB}, 8)...); !bytes.Equal(got, want) {
+		t.Errorf("read blob response after the long read % X, want % X", got, want)
+	}
+}
+
+func TestValidatedWrites(t *testing.T) {
+	written := map[uint16][]byte{}
+	handler := ble.WriteHandlerFunc(func(req ble.Request, rsp ble.ResponseWriter) {
+		written[req.Handle()] = req.Data()
+	})
+	svc := ble.NewService(ble.UUID16(0x1234))
+	a := svc.NewCharacteristic(ble.UUID16(0x5678))
+	a.HandleWrite(handler)
+	a.Validation = &ble.Validation{Len: 2}
+	b := svc.NewCharacteristic(ble.UUID16(0x5679))
+	b.HandleWrite(handler)
+	b.Validation = &ble.Validation{MaxLen: 2}
+	s := newTestServer(t, svc)
+
+	got := s.handleRequest(request(WriteRequestCode, a.ValueHandle, 0x01))
+	if want := errorResponse(WriteRequestCode, a.ValueHandle, ble.ErrInvalAttrValueLen); !bytes.Equal(got, want) {
+		t.Errorf("write response % X, want % X", got, want)
+	}
+
+	// The value of a is valid, but isn't written, since the value of b isn't.
+	s.handleRequest(request(PrepareWriteRequestCode, a.ValueHandle, 0x00, 0x00, 0x01, 0x02))
+	s.handleRequest(request(PrepareWriteRequestCode, b.ValueHandle, 0x00, 0x00, 0x01, 0x02))
+	s.handleRequest(request(PrepareWriteRequestCode, b.ValueHandle, 0x02, 0x00, 0x03))
+	got = s.handleRequest([]byte{ExecuteWriteRequestCode, 0x01})
+	if want := errorResponse(ExecuteWriteRequestCode, b.ValueHandle, ble.ErrInvalAttrValueLen); !bytes.Equal(got, want) {
+		t.Errorf("execute write response % X, want % X", got, want)
+	}
+	if len(written) != 0 {
+		t.Errorf("rejected values written % X", written)
+	}
+
+	got = s.handleRequest(request(WriteRequestCode, a.ValueHandle, 0x01, 0x02))
+	if want := []byte{WriteResponseCode}; !bytes.Equal(got, want) {
+		t.Errorf("write response % X, want % X", got, want)
+	}
+	if v := written[a.ValueHandle]; !bytes.Equal(v, []byte{0x01, 0x02}) {
+		t.Errorf("written % X, want 01 02", v)
+	}
+}
+
+// secureConn is a fakeConn with the security of the link, which records the
+// security required by the accesses rejected.
+type secureConn struct {
+	*fakeConn
+	sec      ble.Security
+	required *ble.Security
+}
+
+func (c *secureConn) Security() ble.Security                { return c.sec }
+func (c *secureConn) InsufficientSecurity(req ble.Security) { c.required = &req }
+func (c *secureConn) SecurityChanged() <-chan struct{}      { return nil }
+
+func TestAttributeSecurity(t *testing.T) {
+	enc := ble.Security{Encrypted: true, KeySize: 16}
+	auth := ble.Security{Encrypted: true, Authenticated: true, KeySize: 16}
+	tests := []struct {
+		name    string
+		perm    ble.Permission
+		keySize int
+		sec     ble.Security
+		op      byte
+		want    ble.ATTError
+	}{
+		{"open read", 0, 0, ble.Security{}, ReadRequestCode, ble.ErrSuccess},
+		{"encrypted read", ble.PermReadEncrypted, 0, ble.Security{}, ReadRequestCode, ble.ErrInsuffEnc},
+		{"encrypted read on encrypted link", ble.PermReadEncrypted, 0, enc, ReadRequestCode, ble.ErrSuccess},
+		{"authenticated read", ble.PermReadAuthenticated, 0, enc, ReadRequestCode, ble.ErrAuthentication},
+		{"authenticated read on authenticated link", ble.PermReadAuthenticated, 0, auth, ReadRequestCode, ble.ErrSuccess},
+		{"write permission on read", ble.PermWriteAuthenticated, 0, ble.Security{}, ReadRequestCode, ble.ErrSuccess},
+		{"encrypted write", ble.PermWriteEncrypted, 0, ble.Security{}, WriteRequestCode, ble.ErrInsuffEnc},
+		{"authenticated write", ble.PermWriteAuthenticated, 0, enc, WriteRequestCode, ble.ErrAuthentication},
+		{"authenticated write on authenticated link", ble.PermWriteAuthenticated, 0, auth, WriteRequestCode, ble.ErrSuccess},
+		{"read permission on write", ble.PermReadEncrypted, 0, ble.Security{}, WriteRequestCode, ble.ErrSuccess},
+		{"short key", ble.PermReadEncrypted, 16, ble.Security{Encrypted: true, KeySize: 7}, ReadRequestCode, ble.ErrInsuffEncrKeySize},
+		{"long key", ble.PermReadEncrypted, 16, enc, ReadRequestCode, ble.ErrSuccess},
+	}
+	for _, tt := range tests {
+		svc := ble.NewService(ble.UUID16(0x1234))
+		c := svc.NewCharacteristic(ble.UUID16(0x5678))
+		c.HandleRead(ble.ReadHandlerFunc(func(req ble.Request, rsp ble.ResponseWriter) { rsp.Write([]byte{0x01}) }))
+		c.HandleWrite(ble.WriteHandlerFunc(func(req ble.Request, rsp ble.ResponseWriter) {}))
+		c.Secure, c.MinKeySize = tt.perm, tt.keySize
+		db, err := NewDB([]*ble.Service{svc}, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		l2c := &secureConn{fakeConn: newFakeConn(), sec: tt.sec}
+		s, err := NewServer(db, l2c)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req := request(tt.op, c.ValueHandle)
+		if tt.op == WriteRequestCode {
+			req = append(req, 0x01)
+		}
+		got := s.handleRequest(req)
+		if tt.want == ble.ErrSuccess {
+			if got[0] == ErrorResponseCode {
+				t.Errorf("%s: response % X, want success", tt.name, got)
+			}
+			if l2c.required != nil {
+				t.Errorf("%s: insufficient security reported", tt.name)
+			}
+			continue
+		}
+		if want := errorResponse(tt.op, c.ValueHandle, tt.want); !bytes.Equal(got, want) {
+			t.Errorf("%s: response % X, want % X", tt.name, got, want)
+		}
+		want := ble.Security{
+			Encrypted:     true,
+			Authenticated: tt.perm&(ble.PermReadAuthenticated|ble.PermWriteAuthenticated) != 0,
+			KeySize:       tt.keySize,
+		}
+		if l2c.required == nil || *l2c.required != want {
+			t.Errorf("%s: insufficient security reported %+v, want %+v", tt.name, l2c.required, want)
+		}
+	}
+}
+
+func TestAuthorizer(t *testing.T) {
+	svc := ble.NewService(ble.UUID16(0x1234))
+	c := svc.NewCharacteristic(ble.UUID16(0x5678))
+	c.HandleRead(ble.ReadHandlerFunc(func(req ble.Request, rsp ble.ResponseWriter) { rsp.Write([]byte{0x01}) }))
+	c.Secure = ble.PermReadEncrypted
+	db, err := NewDB([]*ble.Service{svc}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l2c := &secureConn{fakeConn: newFakeConn()}
+	s, err := NewServer(db, l2c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var accesses []ble.Access
+	s.SetAuthorizer(ble.AuthorizerFunc(func(a ble.Access) ble.ATTError {
+		accesses = append(accesses, a)
+		return ble.ErrAuthorization
+	}))
+
+	// The security is checked before the access is authorized.
+	got := s.handleRequest(request(ReadRequestCode, c.ValueHandle))
+	if want := errorResponse(ReadRequestCode, c.ValueHandle, ble.ErrInsuffEnc); !bytes.Equal(got, want) {
+		t.Errorf("response % X, want % X", got, want)
+	}
+	if len(accesses) != 0 {
+		t.Errorf("access authorized on an unencrypted link")
+	}
+
+	l2c.sec = ble.Security{Encrypted: true, KeySize: 16}
+	got = s.handleRequest(request(ReadRequestCode, c.ValueHandle))
+	if want := errorResponse(ReadRequestCode, c.ValueHandle, ble.ErrAuthorization); !bytes.Equal(got, want) {
+		t.Errorf("response % X, want % X", got, want)
+	}
+	if len(accesses) != 1 || accesses[0].Op != ble.OpRead || accesses[0].Handle != c.ValueHandle {
+		t.Errorf("accesses %+v, want a read of the value", accesses)
+	}
+}
+
+func TestSnapshotReadAuthorized(t *testing.T) {
+	svc := ble.NewService(ble.UUID16(0x1234))
+	c := svc.NewCharacteristic(ble.UUID16(0x5678))
+	c.SnapshotRead = true
+	c.HandleRead(ble.ReadHandlerFunc(func(req ble.Request, rsp ble.ResponseWriter) {
+		rsp.Write(bytes.Repeat([]byte{0xAA}, 30)[req.Offset():])
+	}))
+	s := newTestServer(t, svc)
+	s.SetAuthorizer(ble.AuthorizerFunc(func(a ble.Access) ble.ATTError {
+		if a.Op == ble.OpReadBlob {
+			return ble.ErrAuthorization
+		}
+		return ble.ErrSuccess
+	}))
+
+	if got := s.handleRequest(request(ReadRequestCode, c.ValueHandle)); got[0] != ReadResponseCode {
+		t.Fatalf("read response % X", got)
+	}
+	got := s.handleRequest(request(ReadBlobRequestCode, c.ValueHandle, 22, 0x00))
+	if want := errorResponse(ReadBlobRequestCode, c.ValueHandle, ble.ErrAuthorization); !bytes.Equal(got, want) {
+		t.Errorf("read blob response % X, want % X", got, want)
+	}
+}
+
+// signingConn is a fakeConn, which accepts the signatures ending with 0xAA.
+type signingConn struct{ *fakeConn }
+
+func (c signingConn) Sign(m []byte) ([12]byte, error) { return [12]byte{}, ble.ErrNoSigningKey }
+func (c signingConn) Verify(m []byte, sig [12]byte) error {
+	if sig[11] != 0xAA {
+		return ble.ErrBadSignature
+	}
+	return nil
+}
+
+func TestSignedWrite(t *testing.T) {
+	var written []byte
+	svc := ble.NewService(ble.UUID16(0x1234))
+	c := svc.NewCharacteristic(ble.UUID16(0x5678))
+	c.HandleWrite(ble.WriteHandlerFunc(func(req ble.Request, rsp ble.ResponseWriter) {
+		written = req.Data()
+	}))
+	c.Property |= ble.CharSignedWrite
+	db, err := NewDB([]*ble.Service{svc}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewServer(db, signingConn{newFakeConn()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	signedWrite := func(mac byte) []byte {
+		b := append(request(SignedWriteCommandCode, c.ValueHandle, 0x01, 0x02), make([]byte, 11)...)
+		return append(b, mac)
+	}
+
+	s.handleRequest(signedWrite(0xBB))
+	if written != nil {
+		t.Errorf("value % X written with a bad signature", written)
+	}
+	s.handleRequest(signedWrite(0xAA))
+	if !bytes.Equal(written, []byte{0x01, 0x02}) {
+		t.Errorf("written % X, want 01 02", written)
+	}
+}
+
+func TestEnhancedBearerSharesCCCD(t *testing.T) {
+	svc := ble.NewService(ble.UUID16(0x1234))
+	c := svc.NewCharacteristic(ble.UUID16(0x5678))
+	c.HandleNotify(ble.NotifyHandlerFunc(func(req ble.Request, n ble.Notifier) {}))
+	s := newTestServer(t, svc)
+	l2c := newFakeConn()
+	es, err := NewEnhancedServer(s.db, l2c, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	es.handleRequest(request(WriteRequestCode, c.CCCD.Handle, 0x01, 0x00))
+	got := s.handleRequest(request(ReadRequestCode, c.CCCD.Handle))
+	if want := []byte{ReadResponseCode, 0x01, 0x00}; !bytes.Equal(got, want) {
+		t.Errorf("CCCD read on the unenhanced bearer % X, want % X", got, want)
+	}
+
+	// The subscription of the device outlives the enhanced bearer.
+	done := make(chan struct{})
+	go func() {
+		es.Loop()
+		close(done)
+	}()
+	close(l2c.disconnected)
+	<-done
+	if subs := c.Subscribers(false); len(subs) != 1 || subs[0] != s.conn.Conn {
+		t.Errorf("subscribers %v, want the link of the device", subs)
+	}
+	if err := c.NotifyConn(es.Bearer(), []byte{0x01}); err != nil {
+		t.Errorf("NotifyConn() on the enhanced bearer = %v", err)
+	}
+}
+
+func TestReadMultiple(t *testing.T) {
+	svc := ble.NewService(ble.UUID16(0x1234))
+	c1 := svc.NewCharacteristic(ble.UUID16(0x5671))
+	c1.SetValue(bytes.Repeat([]byte{0x11}, 10))
+	c2 := svc.NewCharacteristic(ble.UUID16(0x5672))
+	c2.HandleRead(ble.ReadHandlerFunc(func(req ble.Request, rsp ble.ResponseWriter) {
+		rsp.Write(bytes.Repeat([]byte{0x22}, 20))
+	}))
+	c3 := svc.NewCharacteristic(ble.UUID16(0x5673))
+	c3.SetValue([]byte{0x33})
+	c4 := svc.NewCharacteristic(ble.UUID16(0x5674))
+	c4.SetValue([]byte{0x44, 0x45})
+	c3.Secure = ble.PermReadEncrypted
+	s := newTestServer(t, svc)
+	handles := func(hh ...uint16) (b []byte) {
+		for _, h := range hh {
+			b = append(b, byte(h), byte(h>>8))
+		}
+		return b
+	}
+	h1, h2, h3, h4 := c1.ValueHandle, c2.ValueHandle, c3.ValueHandle, c4.ValueHandle
+
+	tests := []struct {
+		name string
+		code byte
+		hh   []byte
+		want []byte
+	}{
+		{
+			"values truncated to ATT_MTU-1", ReadMultipleRequestCode, handles(h1, h2),
+			append(append([]byte{ReadMultipleResponseCode}, bytes.Repeat([]byte{0x11}, 10)...), bytes.Repeat([]byte{0x22}, 12)...),
+		},
+		{
+			"value not encrypted", ReadMultipleRequestCode, handles(h1, h3),
+			errorResponse(ReadMultipleRequestCode, h3, ble.ErrInsuffEnc),
+		},
+		{
+			"invalid handle", ReadMultipleRequestCode, handles(h1, 0x00F0),
+			errorResponse(ReadMultipleRequestCode, 0x00F0, ble.ErrInvalidHandle),
+		},
+		{
+			"length value tuples", ReadMultipleVariableRequestCode, handles(h4, h1),
+			append([]byte{ReadMultipleVariableResponseCode, 0x02, 0x00, 0x44, 0x45, 0x0A, 0x00}, bytes.Repeat([]byte{0x11}, 10)...),
+		},
+		{
+			"tuples truncated to ATT_MTU-1", ReadMultipleVariableRequestCode, handles(h1, h2),
+			append(append([]byte{ReadMultipleVariableResponseCode, 0x0A, 0x00},
+				bytes.Repeat([]byte{0x11}, 10)...), 0x14, 0x00, 0x22, 0x22, 0x22, 0x22, 0x22, 0x22, 0x22, 0x22),
+		},
+		{
+			"variable value not encrypted", ReadMultipleVariableRequestCode, handles(h3, h1),
+			errorResponse(ReadMultipleVariableRequestCode, h3, ble.ErrInsuffEnc),
+		},
+	}
+	for _, tt := range tests {
+		if got := s.handleRequest(append([]byte{tt.code}, tt.hh...)); !bytes.Equal(got, tt.want) {
+			t.Errorf("%s: response % X, want % X", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestNotifySubscribers(t *testing.T) {
+	svc := ble.NewService(ble.UUID16(0x1234))
+	c := svc.NewCharacteristic(ble.UUID16(0x5678))
+	c.Property = ble.CharNotify
+	db, err := NewDB([]*ble.Service{svc}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l2c := newPipeConn()
+	defer close(l2c.disconnected)
+	s, err := NewServer(db, l2c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Loop()
+	writeCCCD := func(v byte) {
+		l2c.in <- request(WriteRequestCode, c.CCCD.Handle, v, 0x00)
+		if b := l2c.receive(t); !bytes.Equal(b, []byte{WriteResponseCode}) {
+			t.Fatalf("response % X to the CCCD write", b)
+		}
+	}
+
+	// The notifications enabled by the client are sent to it.
+	writeCCCD(0x01)
+	subs := c.Subscribers(false)
+	if len(subs) != 1 {
+		t.Fatalf("%d subscribers, want 1", len(subs))
+	}
+	if err := c.Notify([]byte{0x01}); err != nil {
+		t.Fatalf("Notify() = %v", err)
+	}
+	if b, want := l2c.receive(t), request(HandleValueNotificationCode, c.ValueHandle, 0x01); !bytes.Equal(b, want) {
+		t.Errorf("sent % X, want % X", b, want)
+	}
+	if err := c.NotifyConn(subs[0], []byte{0x02}); err != nil {
+		t.Fatalf("NotifyConn() = %v", err)
+	}
+	if b, want := l2c.receive(t), request(HandleValueNotificationCode, c.ValueHandle, 0x02); !bytes.Equal(b, want) {
+		t.Errorf("sent % X, want % X", b, want)
+	}
+
+	// The subscriber is removed, once the client disables the notifications.
+	writeCCCD(0x00)
+	deadline := time.Now().Add(time.Second)
+	for len(c.Subscribers(false)) != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("subscriber not removed")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if err := c.NotifyConn(subs[0], []byte{0x03}); err != ble.ErrNotSubscribed {
+		t.Errorf("NotifyConn() = %v, want ErrNotSubscribed", err)
+	}
+}
+
+// mtuConn is a pipeConn, which receives PDUs of up to 100 bytes.
+type mtuConn struct{ *pipeConn }
+
+func (c mtuConn) RxMTU() int { return 100 }
+
+func TestNotifyQueue(t *testing.T) {
+	svc := ble.NewService(ble.UUID16(0x1234))
+	c := svc.NewCharacteristic(ble.UUID16(0x5678))
+	nc := make(chan ble.Notifier, 1)
+	c.HandleNotify(ble.NotifyHandlerFunc(func(req ble.Request, n ble.Notifier) { nc <- n }))
+	db, err := NewDB([]*ble.Service{svc}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l2c := newPipeConn()
+	defer close(l2c.disconnected)
+	s, err := NewServer(db, mtuConn{l2c})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.SetNotifyQueue(1, ble.NotifyQueueDrop)
+	go s.Loop()
+
+	l2c.in <- request(WriteRequestCode, c.CCCD.Handle, 0x01, 0x00)
+	l2c.receive(t)
+	n := <-nc
+	if n.Cap() != ble.DefaultMTU-3 {
+		t.Errorf("Cap() = %d, want %d", n.Cap(), ble.DefaultMTU-3)
+	}
+
+	// The capacity follows the ATT_MTU exchanged.
+	l2c.in <- []byte{ExchangeMTURequestCode, 64, 0x00}
+	if b := l2c.receive(t); !bytes.Equal(b, []byte{ExchangeMTUResponseCode, 100, 0x00}) {
+		t.Fatalf("response % X to the MTU exchange", b)
+	}
+	deadline := time.Now().Add(time.Second)
+	for n.Cap() != 64-3 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Cap() = %d, want %d", n.Cap(), 64-3)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if _, err := n.Write(make([]byte, 64-2)); err != ble.ErrValueTooLong {
+		t.Errorf("Write() of ATT_MTU-2 octets = %v, want ErrValueTooLong", err)
+	}
+
+	// The notifications are dropped, once the queue is full.
+	sent := 0
+	for ; ; sent++ {
+		_, err := n.Write(make([]byte, 64-3))
+		if err == ble.ErrNotifyQueueFull {
+			break
+		}
+		if err != nil || sent == 4 {
+			t.Fatalf("Write() = %v after %d notifications, want ErrNotifyQueueFull", err, sent)
+		}
+	}
+	for ; sent > 0; sent-- {
+		if b := l2c.receive(t); b[0] != HandleValueNotificationCode || len(b) != 64 {
+			t.Errorf("sent % X, want a notification of ATT_MTU octets", b)
+		}
+	}
+}
+
+func TestStdDescriptors(t *testing.T) {
+	svc := ble.NewService(ble.UUID16(0x1234))
+	c := svc.NewCharacteristic(ble.UUID16(0x5678))
+	c.SetValue([]byte{0x00, 0x00})
+	c.SetUserDescription("Temp", true)
+	c.AddPresentationFormat(ble.PresentationFormat{Format: ble.FormatUint8})
+	c.AddPresentationFormat(ble.PresentationFormat{Format: ble.FormatSint8})
+	s := newTestServer(t, svc)
+
+	// The declared fields aren't changed by the generated descriptors.
+	if c.AggregateFormat != nil {
+		t.Errorf("aggregate format %v declared by the server", c.AggregateFormat)
+	}
+	ud := c.ValueHandle + 2
+	tests := []struct {
+		req  []byte
+		want []byte
+	}{
+		{request(ReadRequestCode, c.ValueHandle+1), []byte{ReadResponseCode, 0x02, 0x00}},
+		{request(ReadRequestCode, c.ValueHandle+5), []byte{ReadResponseCode, 0x06, 0x00, 0x07, 0x00}},
+		{request(ReadRequestCode, ud), append([]byte{ReadResponseCode}, "Temp"...)},
+		{append(request(WriteRequestCode, ud), "Sensor"...), []byte{WriteResponseCode}},
+		{request(WriteRequestCode, ud, 0xC3), errorResponse(WriteRequestCode, ud, ble.ErrValueNotAllowed)},
+		{request(ReadBlobRequestCode, ud, 0x02, 0x00), append([]byte{ReadBlobResponseCode}, "nsor"...)},
+	}
+	for _, tt := range tests {
+		if got := s.handleRequest(tt.req); !bytes.Equal(got, tt.want) {
+			t.Errorf("response % X to % X, want % X", got, tt.req, tt.want)
+		}
+	}
+	if d := c.Description(); d != "Sensor" {
+		t.Errorf("description %q, want \"Sensor\"", d)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"io"
 	"log"
+	"sync"
 
 	"github.com/runtimeco/ble"
 	"github.com/runtimeco/ble/linux/att"
@@ -45,12 +46,26 @@ func NewDeviceWithNameAndHandler(name string, handler ble.NotifyHandler, opts ..
 		return nil, errors.Wrapf(err, "maximum ATT_MTU is %d", ble.MaxMTU)
 	}
 
-	go loop(dev, srv, mtu)
+	srv.SetBondStore(dev.BondStore())
+	links := &links{m: make(map[ble.Conn]*att.Server)}
+	go loop(dev, srv, mtu, links)
+
+	// Serve the Enhanced ATT bearers, which require an encrypted link [Vol 3, Part G, 5.3.2].
+	if dev.EATT() {
+		l, err := dev.ListenL2CAP(ble.PSMEATT, mtu)
+		if err != nil {
+			dev.Close()
+			return nil, errors.Wrap(err, "can't listen on EATT")
+		}
+		l.RequireSecurity(ble.Security{Encrypted: true})
+		srv.SetEATT(true)
+		go eattLoop(dev, l, srv, links)
+	}
 
 	return &Device{HCI: dev, Server: srv}, nil
 }
 
-func loop(dev *hci.HCI, s *gatt.Server, mtu int) {
+func loop(dev *hci.HCI, s *gatt.Server, mtu int, links *links) {
 	for {
 		l2c, err := dev.Accept()
 		if err != nil {
@@ -74,10 +89,86 @@ func loop(dev *hci.HCI, s *gatt.Server, mtu int) {
 			continue
 
 		}
-		go as.Loop()
+		configure(dev, as)
+		links.add(l2c, as)
+		go s.Serve(as)
 	}
 }
 
+// eattLoop serves the Enhanced ATT bearers connected by the remote devices.
+func eattLoop(dev *hci.HCI, l *hci.L2CAPListener, s *gatt.Server, links *links) {
+	for {
+		l2c, err := l.Accept()
+		if err != nil {
+			if err != io.EOF && err != hci.ErrListenerClosed {
+				log.Printf("can't accept EATT bearer: %s", err)
+			}
+			return
+		}
+
+		// The bearer shares the state of the device with its unenhanced bearer.
+		us := links.get(l2c.(ble.LinkedConn).Link())
+		if us == nil {
+			log.Printf("can't accept EATT bearer: link not served")
+			l2c.Close()
+			continue
+		}
+		s.Lock()
+		as, err := att.NewEnhancedServer(s.DB(), l2c, us)
+		s.Unlock()
+		if err != nil {
+			log.Printf("can't create ATT server: %s", err)
+			l2c.Close()
+			continue
+		}
+		configure(dev, as)
+		go s.Serve(as)
+	}
+}
+
+// configure applies the options of the device to the ATT server.
+func configure(dev *hci.HCI, as *att.Server) {
+	if n := dev.PrepareQueueSize(); n > 0 {
+		as.SetPrepareQueueSize(n)
+	}
+	if n, policy := dev.NotifyQueue(); n > 0 {
+		as.SetNotifyQueue(n, policy)
+	}
+	if d := dev.TransactionTimeout(); d > 0 {
+		as.SetTransactionTimeout(d)
+	}
+	if d := dev.ResponseTimeout(); d > 0 {
+		as.SetResponseTimeout(d)
+	}
+	as.SetAuthorizer(dev.Authorizer())
+}
+
+// links are the ATT servers of the unenhanced bearers of the connected
+// devices, keyed by the connections of their links.
+type links struct {
+	sync.Mutex
+	m map[ble.Conn]*att.Server
+}
+
+// add adds the server of the link, and removes it once the link is disconnected.
+func (l *links) add(link ble.Conn, as *att.Server) {
+	l.Lock()
+	l.m[link] = as
+	l.Unlock()
+	go func() {
+		<-link.Disconnected()
+		l.Lock()
+		delete(l.m, link)
+		l.Unlock()
+	}()
+}
+
+func (l *links) get(link ble.Conn) *att.Server {
+	l.Lock()
+	defer l.Unlock()
+	return l.m[link]
+}
+
 // Device ...
 type Device struct {
 	HCI    *hci.HCI
@@ -1,10 +1,14 @@
 package gatt
 
 import (
+	"context"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"log"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/runtimeco/ble"
 	"github.com/runtimeco/ble/linux/att"
@@ -15,18 +19,24 @@ const (
 	cccIndicate = 0x0002
 )
 
+// maxBearers is the maximum number of ATT bearers, including the unenhanced one.
+const maxBearers = 16
+
 // NewClient returns a GATT Client.
 func NewClient(conn ble.Conn) (*Client, error) {
 	p := &Client{
-		subs: make(map[uint16]*sub),
-		conn: conn,
+		subs:    make(map[uint16]*sub),
+		conn:    conn,
+		bearers: make(chan *bearer, maxBearers),
 	}
-	p.ac = att.NewClient(conn, p)
+	p.ac = &bearer{Client: att.NewClient(conn, p), l2c: conn}
 	go p.ac.Loop()
+	p.bearers <- p.ac
 	return p, nil
 }
 
-// A Client is a GATT Client.
+// A Client is a GATT Client. Its lock guards the profile and the subscriptions,
+// while the requests are sent on the ATT bearers acquired.
 type Client struct {
 	sync.RWMutex
 
@@ -34,8 +44,77 @@ type Client struct {
 	name    string
 	subs    map[uint16]*sub
 
-	ac   *att.Client
+	ac   *bearer // The unenhanced ATT bearer.
 	conn ble.Conn
+
+	// bearers are the idle ATT bearers, which serve the requests concurrently.
+	// eatt is the number of the Enhanced ATT bearers.
+	bearers chan *bearer
+	eatt    int32
+
+	// timeout is the ATT transaction timeout of the bearers, or 0 for the default.
+	timeout time.Duration
+}
+
+// A bearer is an ATT bearer, and the L2CAP channel it runs on. Its lock is
+// held by the user of the bearer, so one transaction is in progress at a time
+// [Vol 3, Part F, 3.3.2].
+type bearer struct {
+	sync.Mutex
+	*att.Client
+	l2c ble.Conn
+}
+
+// SetTransactionTimeout sets the time an ATT request has to be responded,
+// before the bearer is closed. It must be called before sending any request.
+func (p *Client) SetTransactionTimeout(d time.Duration) {
+	p.timeout = d
+	p.ac.SetTransactionTimeout(d)
+}
+
+// acquire waits for and takes an idle ATT bearer. The Enhanced ATT bearers
+// disconnected while idle are dropped.
+func (p *Client) acquire() *bearer {
+	for {
+		b := <-p.bearers
+		if !p.dead(b) {
+			b.Lock()
+			return b
+		}
+	}
+}
+
+// release returns the bearer to the idle ones, unless it's an Enhanced ATT
+// bearer, which has been disconnected.
+func (p *Client) release(b *bearer) {
+	b.Unlock()
+	if p.dead(b) {
+		return
+	}
+	p.bearers <- b
+}
+
+// acquireUnenhanced takes the unenhanced ATT bearer, for the procedures which
+// are only allowed on it, such as the MTU exchange. It waits for the user of
+// the bearer, if it isn't idle, and must be released with Unlock.
+func (p *Client) acquireUnenhanced() *bearer {
+	p.ac.Lock()
+	return p.ac
+}
+
+// dead reports whether the bearer is an Enhanced ATT bearer, which has been
+// disconnected, and drops it from the count.
+func (p *Client) dead(b *bearer) bool {
+	if b == p.ac {
+		return false
+	}
+	select {
+	case <-b.l2c.Disconnected():
+		atomic.AddInt32(&p.eatt, -1)
+		return true
+	default:
+		return false
+	}
 }
 
 // Addr returns the address of the client.
@@ -92,9 +171,11 @@ func (p *Client) DiscoverServices(filter []ble.UUID) ([]*ble.Service, error) {
 	if p.profile == nil {
 		p.profile = &ble.Profile{}
 	}
+	ab := p.acquire()
+	defer p.release(ab)
 	start := uint16(0x0001)
 	for {
-		length, b, err := p.ac.ReadByGroupType(start, 0xFFFF, ble.PrimaryServiceUUID)
+		length, b, err := ab.ReadByGroupType(start, 0xFFFF, ble.PrimaryServiceUUID)
 		if err == ble.ErrAttrNotFound {
 			return p.profile.Services, nil
 		}
@@ -124,10 +205,67 @@ func (p *Client) DiscoverServices(filter []ble.UUID) ([]*ble.Service, error) {
 
 // DiscoverIncludedServices finds the included services of a service. [Vol 3, Part G, 4.5.1]
 // If filter is specified, only filtered services are returned.
-func (p *Client) DiscoverIncludedServices(ss []ble.UUID, s *ble.Service) ([]*ble.Service, error) {
+// The included services, which have been discovered as primary services, are
+// returned as they are.
+func (p *Client) DiscoverIncludedServices(filter []ble.UUID, s *ble.Service) ([]*ble.Service, error) {
 	p.Lock()
 	defer p.Unlock()
-	return nil, nil
+	ab := p.acquire()
+	defer p.release(ab)
+	var incs []*ble.Service
+	start := s.Handle
+	for start <= s.EndHandle {
+		length, b, err := ab.ReadByType(start, s.EndHandle, ble.IncludeUUID)
+		if err == ble.ErrAttrNotFound {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		if length != 6 && length != 8 {
+			return nil, att.ErrInvalidResponse
+		}
+		for len(b) >= length {
+			h := binary.LittleEndian.Uint16(b[:2])
+			ih := binary.LittleEndian.Uint16(b[2:4])
+			endh := binary.LittleEndian.Uint16(b[4:6])
+			u := ble.UUID(b[6:length])
+			if length == 6 {
+				// The 128-bit UUID isn't included in the declaration, and
+				// is read from the declaration of the included service.
+				if u, err = ab.Read(ih); err != nil {
+					return nil, err
+				}
+			}
+			if filter == nil || ble.Contains(filter, u) {
+				inc := p.findService(ih)
+				if inc == nil {
+					inc = &ble.Service{UUID: u, Handle: ih, EndHandle: endh}
+				}
+				incs = append(incs, inc)
+			}
+			if h == 0xFFFF {
+				s.Includes = incs
+				return incs, nil
+			}
+			start = h + 1
+			b = b[length:]
+		}
+	}
+	s.Includes = incs
+	return incs, nil
+}
+
+// findService returns the discovered primary service, which starts at handle h.
+func (p *Client) findService(h uint16) *ble.Service {
+	if p.profile == nil {
+		return nil
+	}
+	for _, s := range p.profile.Services {
+		if s.Handle == h {
+			return s
+		}
+	}
+	return nil
 }
 
 // DiscoverCharacteristics finds all the characteristics within a service. [Vol 3, Part G, 4.6.1]
@@ -135,10 +273,12 @@ func (p *Client) DiscoverIncludedServices(ss []ble.UUID, s *ble.Service) ([]*ble
 func (p *Client) DiscoverCharacteristics(filter []ble.UUID, s *ble.Service) ([]*ble.Characteristic, error) {
 	p.Lock()
 	defer p.Unlock()
+	ab := p.acquire()
+	defer p.release(ab)
 	start := s.Handle
 	var lastChar *ble.Characteristic
 	for start <= s.EndHandle {
-		length, b, err := p.ac.ReadByType(start, s.EndHandle, ble.CharacteristicUUID)
+		length, b, err := ab.ReadByType(start, s.EndHandle, ble.CharacteristicUUID)
 		if err == ble.ErrAttrNotFound {
 			break
 		} else if err != nil {
@@ -175,9 +315,11 @@ func (p *Client) DiscoverCharacteristics(filter []ble.UUID, s *ble.Service) ([]*
 func (p *Client) DiscoverDescriptors(filter []ble.UUID, c *ble.Characteristic) ([]*ble.Descriptor, error) {
 	p.Lock()
 	defer p.Unlock()
+	ab := p.acquire()
+	defer p.release(ab)
 	start := c.ValueHandle + 1
 	for start <= c.EndHandle {
-		fmt, b, err := p.ac.FindInformation(start, c.EndHandle)
+		fmt, b, err := ab.FindInformation(start, c.EndHandle)
 		if err == ble.ErrAttrNotFound {
 			break
 		} else if err != nil {
@@ -201,14 +343,80 @@ func (p *Client) DiscoverDescriptors(filter []ble.UUID, c *ble.Characteristic) (
 			b = b[length:]
 		}
 	}
+	if err := p.readStdDescriptors(ab, c); err != nil {
+		return nil, err
+	}
 	return c.Descriptors, nil
 }
 
+// readStdDescriptors reads the standard descriptors discovered, and parses
+// them into the typed fields of the characteristic. The descriptors which
+// can't be read, such as the ones requiring a higher security, or which are
+// malformed, are skipped.
+func (p *Client) readStdDescriptors(ab *bearer, c *ble.Characteristic) error {
+	c.PresentationFormats = nil
+	for _, d := range c.Descriptors {
+		switch {
+		case d.UUID.Equal(ble.CharacteristicExtendedPropertiesUUID),
+			d.UUID.Equal(ble.CharacteristicUserDescriptionUUID),
+			d.UUID.Equal(ble.CharacteristicPresentationFormatUUID),
+			d.UUID.Equal(ble.CharacteristicAggregateFormatUUID),
+			d.UUID.Equal(ble.ValidRangeUUID):
+		default:
+			continue
+		}
+		v, err := readLong(ab, d.Handle)
+		if _, ok := err.(ble.ATTError); ok {
+			continue
+		} else if err != nil {
+			return err
+		}
+		d.Value = v
+
+		switch {
+		case d.UUID.Equal(ble.CharacteristicExtendedPropertiesUUID):
+			if ep, err := ble.ParseExtendedProperties(v); err == nil {
+				c.ExtendedProperties = ep
+			}
+		case d.UUID.Equal(ble.CharacteristicUserDescriptionUUID):
+			c.UserDescription = string(v)
+		case d.UUID.Equal(ble.CharacteristicPresentationFormatUUID):
+			if f, err := ble.ParsePresentationFormat(v); err == nil {
+				c.PresentationFormats = append(c.PresentationFormats, f)
+			}
+		case d.UUID.Equal(ble.CharacteristicAggregateFormatUUID):
+			if hh, err := ble.ParseAggregateFormat(v); err == nil {
+				c.AggregateFormat = hh
+			}
+		case d.UUID.Equal(ble.ValidRangeUUID):
+			if r, err := ble.ParseValidRange(v); err == nil {
+				c.ValidRange = r
+			}
+		}
+	}
+	return nil
+}
+
+// readLong reads the value of an attribute, which may be longer than the MTU,
+// on the bearer acquired.
+func readLong(b *bearer, h uint16) ([]byte, error) {
+	v, err := b.Read(h)
+	if err != nil {
+		return nil, err
+	}
+	for read := v; len(read) >= b.l2c.TxMTU()-1; v = append(v, read...) {
+		if read, err = b.ReadBlob(h, uint16(len(v))); err != nil {
+			return nil, err
+		}
+	}
+	return v, nil
+}
+
 // ReadCharacteristic reads a characteristic value from a server. [Vol 3, Part G, 4.8.1]
 func (p *Client) ReadCharacteristic(c *ble.Characteristic) ([]byte, error) {
-	p.Lock()
-	defer p.Unlock()
-	val, err := p.ac.Read(c.ValueHandle)
+	b := p.acquire()
+	defer p.release(b)
+	val, err := b.Read(c.ValueHandle)
 	if err != nil {
 		return nil, err
 	}
@@ -219,20 +427,20 @@ func (p *Client) ReadCharacteristic(c *ble.Characteristic) ([]byte, error) {
 
 // ReadLongCharacteristic reads a characteristic value which is longer than the MTU. [Vol 3, Part G, 4.8.3]
 func (p *Client) ReadLongCharacteristic(c *ble.Characteristic) ([]byte, error) {
-	p.Lock()
-	defer p.Unlock()
+	b := p.acquire()
+	defer p.release(b)
 
 	// The maximum length of an attribute value shall be 512 octects [Vol 3, 3.2.9]
 	buffer := make([]byte, 0, 512)
 
-	read, err := p.ac.Read(c.ValueHandle)
+	read, err := b.Read(c.ValueHandle)
 	if err != nil {
 		return nil, err
 	}
 	buffer = append(buffer, read...)
 
-	for len(read) >= p.conn.TxMTU()-1 {
-		if read, err = p.ac.ReadBlob(c.ValueHandle, uint16(len(buffer))); err != nil {
+	for len(read) >= b.l2c.TxMTU()-1 {
+		if read, err = b.ReadBlob(c.ValueHandle, uint16(len(buffer))); err != nil {
 			return nil, err
 		}
 		buffer = append(buffer, read...)
@@ -244,19 +452,43 @@ func (p *Client) ReadLongCharacteristic(c *ble.Characteristic) ([]byte, error) {
 
 // WriteCharacteristic writes a characteristic value to a server. [Vol 3, Part G, 4.9.3]
 func (p *Client) WriteCharacteristic(c *ble.Characteristic, v []byte, noRsp bool) error {
-	p.Lock()
-	defer p.Unlock()
+	if noRsp && p.signWrite(c) {
+		// The data is only signed on the unenhanced bearer, since the link isn't encrypted.
+		b := p.acquireUnenhanced()
+		defer b.Unlock()
+		return b.SignedWrite(c.ValueHandle, v)
+	}
+	b := p.acquire()
+	defer p.release(b)
 	if noRsp {
-		return p.ac.WriteCommand(c.ValueHandle, v)
+		return b.WriteCommand(c.ValueHandle, v)
 	}
-	return p.ac.Write(c.ValueHandle, v)
+	return b.Write(c.ValueHandle, v)
+}
+
+// signWrite reports whether to sign the write without response to c.
+// The data is signed if the link isn't encrypted, and the client has
+// distributed the CSRK to the server [Vol 3, Part C, 10.4.1].
+func (p *Client) signWrite(c *ble.Characteristic) bool {
+	if c.Property&ble.CharSignedWrite == 0 {
+		return false
+	}
+	if sc, ok := p.conn.(ble.SecureConn); ok && sc.Security().Encrypted {
+		return false
+	}
+	bc, ok := p.conn.(ble.BondedConn)
+	if !ok {
+		return false
+	}
+	b := bc.Bond()
+	return b != nil && b.LocalCSRK != nil
 }
 
 // ReadDescriptor reads a characteristic descriptor from a server. [Vol 3, Part G, 4.12.1]
 func (p *Client) ReadDescriptor(d *ble.Descriptor) ([]byte, error) {
-	p.Lock()
-	defer p.Unlock()
-	val, err := p.ac.Read(d.Handle)
+	b := p.acquire()
+	defer p.release(b)
+	val, err := b.Read(d.Handle)
 	if err != nil {
 		return nil, err
 	}
@@ -267,9 +499,9 @@ func (p *Client) ReadDescriptor(d *ble.Descriptor) ([]byte, error) {
 
 // WriteDescriptor writes a characteristic descriptor to a server. [Vol 3, Part G, 4.12.3]
 func (p *Client) WriteDescriptor(d *ble.Descriptor, v []byte) error {
-	p.Lock()
-	defer p.Unlock()
-	return p.ac.Write(d.Handle, v)
+	b := p.acquire()
+	defer p.release(b)
+	return b.Write(d.Handle, v)
 }
 
 // ReadRSSI retrieves the current RSSI value of remote peripheral. [Vol 2, Part E, 7.5.4]
@@ -283,9 +515,9 @@ func (p *Client) ReadRSSI() int {
 // ExchangeMTU informs the server of the client’s maximum receive MTU size and
 // request the server to respond with its maximum receive MTU size. [Vol 3, Part F, 3.4.2.1]
 func (p *Client) ExchangeMTU(mtu int) (int, error) {
-	p.Lock()
-	defer p.Unlock()
-	return p.ac.ExchangeMTU(mtu)
+	b := p.acquireUnenhanced()
+	defer b.Unlock()
+	return b.ExchangeMTU(mtu)
 }
 
 // Subscribe subscribes to indication (if ind is set true), or notification of a
@@ -340,16 +572,20 @@ func (p *Client) setHandlers(cccdh, vh, flag uint16, h ble.NotificationHandler)
 	} else {
 		s.iHandler = h
 	}
-	return p.ac.Write(s.cccdh, v)
+	b := p.acquire()
+	defer p.release(b)
+	return b.Write(s.cccdh, v)
 }
 
 // ClearSubscriptions clears all subscriptions to notifications and indications.
 func (p *Client) ClearSubscriptions() error {
 	p.Lock()
 	defer p.Unlock()
+	b := p.acquire()
+	defer p.release(b)
 	zero := make([]byte, 2)
 	for vh, s := range p.subs {
-		if err := p.ac.Write(s.cccdh, zero); err != nil {
+		if err := b.Write(s.cccdh, zero); err != nil {
 			return err
 		}
 		delete(p.subs, vh)
@@ -376,6 +612,80 @@ func (p *Client) Conn() ble.Conn {
 	return p.conn
 }
 
+// enableClientFeatures enables the features in the Client Supported Features
+// of the server, if it has the characteristic [Vol 3, Part G, 7.2].
+func (p *Client) enableClientFeatures(f byte) error {
+	ab := p.acquire()
+	defer p.release(ab)
+	length, b, err := ab.ReadByType(0x0001, 0xFFFF, ble.ClientSupportedFeaturesUUID)
+	if err == ble.ErrAttrNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if length < 3 {
+		return nil
+	}
+	h, v := binary.LittleEndian.Uint16(b), append([]byte(nil), b[2:length]...)
+	if v[0]&f == f {
+		return nil
+	}
+	v[0] |= f
+	return ab.Write(h, v)
+}
+
+// OpenL2CAPChannel connects an LE credit based connection-oriented channel to the LE_PSM of the remote device.
+func (p *Client) OpenL2CAPChannel(ctx context.Context, psm uint16, mtu int) (ble.Conn, error) {
+	cc, ok := p.conn.(ble.ChannelConn)
+	if !ok {
+		return nil, errors.New("L2CAP channels not supported")
+	}
+	return cc.OpenL2CAPChannel(ctx, psm, mtu)
+}
+
+// EnableEATT connects up to n Enhanced ATT bearers to the server, which serve
+// the requests concurrently with the unenhanced bearer [Vol 3, Part G, 5.3.2].
+// The link must be encrypted. It returns the number of the bearers connected.
+func (p *Client) EnableEATT(ctx context.Context, n int) (int, error) {
+	cc, ok := p.conn.(ble.ChannelConn)
+	if !ok {
+		return 0, errors.New("EATT not supported")
+	}
+	if max := maxBearers - 1 - int(atomic.LoadInt32(&p.eatt)); n > max {
+		n = max
+	}
+	if err := p.enableClientFeatures(ble.ClientFeatureEATT); err != nil {
+		return 0, err
+	}
+	cnt := 0
+	for n > 0 {
+		k := n
+		if k > 5 {
+			k = 5 // Maximum channels connected with a request.
+		}
+		conns, err := cc.OpenEnhancedL2CAPChannels(ctx, ble.PSMEATT, ble.MaxMTU, k)
+		if err != nil {
+			return cnt, err
+		}
+		for _, l2c := range conns {
+			ac := att.NewClient(l2c, p)
+			if p.timeout > 0 {
+				ac.SetTransactionTimeout(p.timeout)
+			}
+			go ac.Loop()
+			atomic.AddInt32(&p.eatt, 1)
+			p.bearers <- &bearer{Client: ac, l2c: l2c}
+		}
+		cnt += len(conns)
+		if len(conns) < k {
+			break
+		}
+		n -= k
+	}
+	return cnt, nil
+}
+
 // HandleNotification ...
 func (p *Client) HandleNotification(req []byte) {
 	p.Lock()
@@ -0,0 +1,300 @@
+package gatt
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/runtimeco/ble"
+	"github.com/runtimeco/ble/linux/att"
+)
+
+// pipeConn is an L2CAP connection, which receives the PDUs from in, and sends
+// the PDUs to out.
+type pipeConn struct {
+	in, out      chan []byte
+	disconnected chan struct{}
+}
+
+func newPipeConn() *pipeConn {
+	return &pipeConn{
+		in:           make(chan []byte),
+		out:          make(chan []byte, 4),
+		disconnected: make(chan struct{}),
+	}
+}
+
+func (c *pipeConn) Read(b []byte) (int, error) {
+	select {
+	case p := <-c.in:
+		return copy(b, p), nil
+	case <-c.disconnected:
+		return 0, io.EOF
+	}
+}
+
+func (c *pipeConn) Write(b []byte) (int, error) {
+	c.out <- append([]byte(nil), b...)
+	return len(b), nil
+}
+
+func (c *pipeConn) Close() error {
+	select {
+	case <-c.disconnected:
+	default:
+		close(c.disconnected)
+	}
+	return nil
+}
+
+func (c *pipeConn) Context() context.Context       { return context.Background() }
+func (c *pipeConn) SetContext(ctx context.Context) {}
+func (c *pipeConn) LocalAddr() ble.Addr            { return ble.NewAddr("00:00:00:00:00:01") }
+func (c *pipeConn) RemoteAddr() ble.Addr           { return ble.NewAddr("00:00:00:00:00:02") }
+func (c *pipeConn) RxMTU() int                     { return ble.DefaultMTU }
+func (c *pipeConn) SetRxMTU(mtu int)               {}
+func (c *pipeConn) TxMTU() int                     { return ble.DefaultMTU }
+func (c *pipeConn) SetTxMTU(mtu int)               {}
+func (c *pipeConn) Disconnected() <-chan struct{}  { return c.disconnected }
+
+// receive returns the next PDU sent by the server.
+func (c *pipeConn) receive(t *testing.T) []byte {
+	select {
+	case b := <-c.out:
+		return b
+	case <-time.After(time.Second):
+		t.Fatal("no PDU sent")
+		return nil
+	}
+}
+
+// channelConn is the link of a pipeConn, which opens the enhanced channels in chs.
+type channelConn struct {
+	*pipeConn
+	chs []*pipeConn
+}
+
+func (c *channelConn) OpenL2CAPChannel(ctx context.Context, psm uint16, mtu int) (ble.Conn, error) {
+	return nil, errors.New("not supported")
+}
+
+func (c *channelConn) OpenEnhancedL2CAPChannels(ctx context.Context, psm uint16, mtu int, n int) ([]ble.Conn, error) {
+	var conns []ble.Conn
+	for ; n > 0 && len(c.chs) > 0; n-- {
+		conns = append(conns, c.chs[0])
+		c.chs = c.chs[1:]
+	}
+	return conns, nil
+}
+
+// newEATTClient returns a client of the link, which has connected the Enhanced
+// ATT bearers chs.
+func newEATTClient(t *testing.T, link *pipeConn, chs ...*pipeConn) *Client {
+	p, err := NewClient(&channelConn{pipeConn: link, chs: chs})
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		_, err := p.EnableEATT(context.Background(), len(chs))
+		done <- err
+	}()
+	// The server doesn't have Client Supported Features.
+	if b := link.receive(t); b[0] != att.ReadByTypeRequestCode {
+		t.Fatalf("sent % X, want a Read By Type Request", b)
+	}
+	link.in <- []byte{att.ErrorResponseCode, att.ReadByTypeRequestCode, 0x01, 0x00, byte(ble.ErrAttrNotFound)}
+	if err := <-done; err != nil {
+		t.Fatalf("EnableEATT() = %v", err)
+	}
+	return p
+}
+
+// read reads the characteristic at handle h, and passes the result to ch.
+func read(p *Client, h uint16, ch chan<- []byte) {
+	go func() {
+		v, err := p.ReadCharacteristic(&ble.Characteristic{ValueHandle: h})
+		if err != nil {
+			v = nil
+		}
+		ch <- v
+	}()
+}
+
+// readResponse responds to the Read Request b with the handle as the value.
+func readResponse(t *testing.T, b []byte) []byte {
+	if b[0] != att.ReadRequestCode {
+		t.Fatalf("sent % X, want a Read Request", b)
+	}
+	return []byte{att.ReadResponseCode, b[1], b[2]}
+}
+
+func TestClientSerializesRequests(t *testing.T) {
+	link := newPipeConn()
+	defer link.Close()
+	p, err := NewClient(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	errc := make(chan error, 1)
+	go func() {
+		_, err := p.DiscoverServices(nil)
+		errc <- err
+	}()
+	vc := make(chan []byte, 1)
+	read(p, 0x0003, vc)
+
+	// The second request isn't sent, until the first one is responded.
+	first := link.receive(t)
+	select {
+	case b := <-link.out:
+		t.Fatalf("sent % X, while % X is pending", b, first)
+	case <-time.After(50 * time.Millisecond):
+	}
+	respond := func(b []byte) {
+		if b[0] == att.ReadByGroupTypeRequestCode {
+			link.in <- []byte{att.ErrorResponseCode, b[0], 0x01, 0x00, byte(ble.ErrAttrNotFound)}
+			return
+		}
+		link.in <- readResponse(t, b)
+	}
+	respond(first)
+	respond(link.receive(t))
+
+	if err := <-errc; err != nil {
+		t.Errorf("DiscoverServices() = %v", err)
+	}
+	if v := <-vc; !bytes.Equal(v, []byte{0x03, 0x00}) {
+		t.Errorf("read % X, want 03 00", v)
+	}
+}
+
+func TestEATTConcurrentRequests(t *testing.T) {
+	link, e1, e2 := newPipeConn(), newPipeConn(), newPipeConn()
+	defer link.Close()
+	p := newEATTClient(t, link, e1, e2)
+
+	vc := make([]chan []byte, 3)
+	for i := range vc {
+		vc[i] = make(chan []byte, 1)
+		read(p, uint16(i+1), vc[i])
+	}
+
+	// Each bearer serves one of the requests at the same time.
+	var reqs [][]byte
+	for _, c := range []*pipeConn{link, e1, e2} {
+		reqs = append(reqs, c.receive(t))
+	}
+	for i, c := range []*pipeConn{link, e1, e2} {
+		c.in <- readResponse(t, reqs[i])
+	}
+	for i := range vc {
+		if v, want := <-vc[i], []byte{byte(i + 1), 0x00}; !bytes.Equal(v, want) {
+			t.Errorf("read % X, want % X", v, want)
+		}
+	}
+}
+
+func TestEATTBearerDisconnected(t *testing.T) {
+	link, e1 := newPipeConn(), newPipeConn()
+	defer link.Close()
+	p := newEATTClient(t, link, e1)
+
+	// The unenhanced bearer is busy, and the Enhanced ATT bearer is
+	// disconnected while it serves the second request.
+	vc1, vc2 := make(chan []byte, 1), make(chan []byte, 1)
+	read(p, 0x0001, vc1)
+	b1 := link.receive(t)
+	read(p, 0x0002, vc2)
+	e1.receive(t)
+	e1.Close()
+	if v := <-vc2; v != nil {
+		t.Errorf("read % X on the disconnected bearer", v)
+	}
+	link.in <- readResponse(t, b1)
+	<-vc1
+
+	if n := atomic.LoadInt32(&p.eatt); n != 0 {
+		t.Errorf("%d Enhanced ATT bearers, want 0", n)
+	}
+	vc3 := make(chan []byte, 1)
+	read(p, 0x0003, vc3)
+	link.in <- readResponse(t, link.receive(t))
+	if v := <-vc3; !bytes.Equal(v, []byte{0x03, 0x00}) {
+		t.Errorf("read % X, want 03 00", v)
+	}
+}
+
+func TestDiscoverStdDescriptors(t *testing.T) {
+	s, err := NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc := ble.NewService(ble.UUID16(0x1234))
+	c := svc.NewCharacteristic(ble.UUID16(0x5678))
+	c.SetValue([]byte{0x00, 0x00})
+	c.SetUserDescription("Temp", false)
+	c.AddPresentationFormat(ble.PresentationFormat{Format: ble.FormatUint8})
+	c.AddPresentationFormat(ble.PresentationFormat{Format: ble.FormatSint8, Exponent: -1})
+	c.SetValidRange([]byte{0x00}, []byte{0x64})
+	if err := s.SetServices([]*ble.Service{svc}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The client is linked to the server.
+	l2c, link := newPipeConn(), newPipeConn()
+	defer l2c.Close()
+	defer link.Close()
+	forward := func(from, to *pipeConn) {
+		for {
+			select {
+			case b := <-from.out:
+				to.in <- b
+			case <-from.disconnected:
+				return
+			}
+		}
+	}
+	go forward(l2c, link)
+	go forward(link, l2c)
+	as, err := att.NewServer(s.DB(), l2c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Serve(as)
+	p, err := NewClient(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	svcs, err := p.DiscoverServices([]ble.UUID{svc.UUID})
+	if err != nil || len(svcs) != 1 {
+		t.Fatalf("DiscoverServices() = %v, %v", svcs, err)
+	}
+	chars, err := p.DiscoverCharacteristics(nil, svcs[0])
+	if err != nil || len(chars) != 1 {
+		t.Fatalf("DiscoverCharacteristics() = %v, %v", chars, err)
+	}
+	rc := chars[0]
+	if _, err := p.DiscoverDescriptors(nil, rc); err != nil {
+		t.Fatalf("DiscoverDescriptors() = %v", err)
+	}
+	if rc.ExtendedProperties != 0 || rc.UserDescription != "Temp" {
+		t.Errorf("extended properties %v, user description %q", rc.ExtendedProperties, rc.UserDescription)
+	}
+	if !reflect.DeepEqual(rc.PresentationFormats, c.PresentationFormats) {
+		t.Errorf("presentation formats %+v, want %+v", rc.PresentationFormats, c.PresentationFormats)
+	}
+	if fh := rc.ValueHandle + 2; !reflect.DeepEqual(rc.AggregateFormat, []uint16{fh, fh + 1}) {
+		t.Errorf("aggregate format %v, want the handles 0x%04X and 0x%04X", rc.AggregateFormat, fh, fh+1)
+	}
+	if !reflect.DeepEqual(rc.ValidRange, c.ValidRange) {
+		t.Errorf("valid range %+v, want %+v", rc.ValidRange, c.ValidRange)
+	}
+}
@@ -1,7 +1,9 @@
 package gatt
 
 import (
+	"encoding/binary"
 	"log"
+	"strings"
 	"sync"
 
 	"github.com/runtimeco/ble"
@@ -15,11 +17,17 @@ func NewServerWithName(name string) (*Server, error) {
 
 // NewServerWithNameAndHandler allow to specify a custom NotifyHandler
 func NewServerWithNameAndHandler(name string, notifyHandler ble.NotifyHandler) (*Server, error) {
-	return &Server{
-		name: name,
-		svcs: defaultServicesWithHandler(name, notifyHandler),
-		db:   att.NewDB(defaultServices(name), uint16(1)),
-	}, nil
+	s := &Server{
+		name:    name,
+		handler: notifyHandler,
+
+		bearers:     make(map[*att.Server]*att.DB),
+		scNotifiers: make(map[ble.Notifier]bool),
+	}
+	if err := s.setServices(s.defaultServices()); err != nil {
+		return nil, err
+	}
+	return s, nil
 }
 
 // NewServer ...
@@ -27,40 +35,56 @@ func NewServer() (*Server, error) {
 	return NewServerWithName("Gopher")
 }
 
+// A ViewFunc returns the services visible to a connected device, which are
+// selected from svcs, the services of the server. It may depend on the security
+// of the link, or the identity of the device. The GAP and GATT services are
+// always visible. It's called with the server locked, so it must not call the
+// methods of the server, such as Refresh.
+type ViewFunc func(conn ble.Conn, svcs []*ble.Service) []*ble.Service
+
 // Server ...
 type Server struct {
 	sync.Mutex
-	name string
+	name    string
+	handler ble.NotifyHandler // handler of the Service Changed indications.
 
-	svcs []*ble.Service
-	db   *att.DB
+	svcs     []*ble.Service
+	defaults []*ble.Service // GAP and GATT services.
+	db       *att.DB
+	sc       *ble.Characteristic // Service Changed characteristic.
+
+	// bearers are the ATT servers of the connected devices, and the
+	// databases served to them.
+	bearers map[*att.Server]*att.DB
+	bonds   ble.BondStore
+	view    ViewFunc
+	eatt    bool // Enhanced ATT bearers are served.
+
+	// scNotifiers are the notifiers of the devices which enable Service
+	// Changed indications.
+	muSC        sync.Mutex
+	scNotifiers map[ble.Notifier]bool
 }
 
 // AddService ...
 func (s *Server) AddService(svc *ble.Service) error {
 	s.Lock()
 	defer s.Unlock()
-	s.svcs = append(s.svcs, svc)
-	s.db = att.NewDB(s.svcs, uint16(1)) // ble attrs start at 1
-	return nil
+	return s.setServices(append(s.svcs, svc))
 }
 
 // RemoveAllServices ...
 func (s *Server) RemoveAllServices() error {
 	s.Lock()
 	defer s.Unlock()
-	s.svcs = defaultServices(s.name)
-	s.db = att.NewDB(s.svcs, uint16(1)) // ble attrs start at 1
-	return nil
+	return s.setServices(s.defaultServices())
 }
 
 // SetServices ...
 func (s *Server) SetServices(svcs []*ble.Service) error {
 	s.Lock()
 	defer s.Unlock()
-	s.svcs = append(defaultServices(s.name), svcs...)
-	s.db = att.NewDB(s.svcs, uint16(1)) // ble attrs start at 1
-	return nil
+	return s.setServices(append(s.defaultServices(), svcs...))
 }
 
 // DB ...
@@ -68,9 +92,287 @@ func (s *Server) DB() *att.DB {
 	return s.db
 }
 
-func defaultServices(name string) []*ble.Service {
-	return defaultServicesWithHandler(name, nil)
+// SetBondStore sets the store of the bonded devices, which keeps the services
+// changed while they are disconnected.
+func (s *Server) SetBondStore(bs ble.BondStore) {
+	s.Lock()
+	defer s.Unlock()
+	s.bonds = bs
+}
+
+// SetEATT sets whether the Enhanced ATT bearers are served, which is reported
+// by the Server Supported Features characteristic.
+func (s *Server) SetEATT(enable bool) {
+	s.Lock()
+	defer s.Unlock()
+	s.eatt = enable
+}
+
+// serveServerFeatures reads the Server Supported Features characteristic.
+func (s *Server) serveServerFeatures(req ble.Request, rsp ble.ResponseWriter) {
+	s.Lock()
+	eatt := s.eatt
+	s.Unlock()
+	if eatt {
+		rsp.Write([]byte{0x01}) // EATT supported.
+		return
+	}
+	rsp.Write([]byte{0x00})
+}
+
+// SetView sets the function, which selects the services visible to each
+// connected device. It's called when the device connects, when the security of
+// the link changes, and when the services are changed. If the services visible
+// are changed, the device is indicated with Service Changed.
+func (s *Server) SetView(f ViewFunc) {
+	s.Lock()
+	defer s.Unlock()
+	s.view = f
+	for as := range s.bearers {
+		s.refresh(as)
+	}
+}
+
+// Refresh re-evaluates the services visible to the device, such as its role
+// has been changed by the application.
+func (s *Server) Refresh(addr ble.Addr) {
+	s.Lock()
+	defer s.Unlock()
+	for as := range s.bearers {
+		if strings.EqualFold(as.Conn().RemoteAddr().String(), addr.String()) {
+			s.refresh(as)
+		}
+	}
+}
+
+// Serve serves the ATT server of a connected device until the connection is
+// closed. The changes of the database are applied to the ATT server.
+func (s *Server) Serve(as *att.Server) {
+	// The changes of the security are watched before the view is evaluated,
+	// so the link encrypted in between isn't missed.
+	var changed <-chan struct{}
+	if sc, ok := as.Conn().(ble.SecureConn); ok {
+		changed = sc.SecurityChanged()
+	}
+
+	s.Lock()
+	db := s.dbOf(as.Conn())
+	as.SetDB(db)
+	s.bearers[as] = db
+	s.Unlock()
+
+	done := make(chan struct{})
+	go s.watchSecurity(as, changed, done)
+	as.Loop()
+	close(done)
+
+	s.Lock()
+	delete(s.bearers, as)
+	s.Unlock()
+}
+
+// watchSecurity re-evaluates the services visible to the device, whenever the
+// security of the link changes, until done is closed. ch is the first change
+// of the security watched.
+func (s *Server) watchSecurity(as *att.Server, ch <-chan struct{}, done <-chan struct{}) {
+	sc, ok := as.Conn().(ble.SecureConn)
+	if !ok {
+		return
+	}
+	for {
+		select {
+		case <-ch:
+			ch = sc.SecurityChanged()
+			s.Lock()
+			s.refresh(as)
+			s.Unlock()
+		case <-done:
+			return
+		}
+	}
+}
+
+// dbOf returns the database served to the connection. s must be locked.
+func (s *Server) dbOf(conn ble.Conn) *att.DB {
+	if s.view == nil {
+		return s.db
+	}
+	handles := []uint16{s.svcs[0].Handle, s.svcs[1].Handle}
+	for _, svc := range s.view(conn, s.userServices()) {
+		for _, t := range s.svcs[2:] {
+			if svc == t {
+				handles = append(handles, svc.Handle)
+				break
+			}
+		}
+	}
+	return s.db.View(handles)
+}
+
+// userServices returns a copy of the services, which aren't the GAP and GATT services.
+func (s *Server) userServices() []*ble.Service {
+	return append([]*ble.Service(nil), s.svcs[2:]...)
+}
+
+// refresh applies the database of the connection to the bearer, and indicates
+// the range of the handles changed to the device. s must be locked.
+func (s *Server) refresh(as *att.Server) {
+	old, ok := s.bearers[as]
+	if !ok {
+		return
+	}
+	db := s.dbOf(as.Conn())
+	as.SetDB(db)
+	s.bearers[as] = db
+	// The device is indicated once, on its unenhanced bearer.
+	start, end, ok := db.Changed(old)
+	if !ok || as.Enhanced() {
+		return
+	}
+	go indicateConn(s.sc, as.Bearer(), ble.HandleRange{Start: start, End: end})
+}
+
+// indicateConn indicates the range of the handles changed to the connection,
+// if it enables Service Changed indications.
+func indicateConn(sc *ble.Characteristic, conn ble.Conn, r ble.HandleRange) {
+	v := make([]byte, 4)
+	binary.LittleEndian.PutUint16(v, r.Start)
+	binary.LittleEndian.PutUint16(v[2:], r.End)
+	if err := sc.IndicateConn(conn, v); err != nil && err != ble.ErrNotSubscribed {
+		log.Printf("can't indicate service changed: %s", err)
+	}
+}
+
+// setServices rebuilds the database with the services, and applies it to the
+// connected devices. If the services are changed, the devices are indicated
+// with the range of the handles changed. s must be locked.
+func (s *Server) setServices(svcs []*ble.Service) error {
+	db, err := att.NewDB(svcs, uint16(1)) // ble attrs start at 1
+	if err != nil {
+		return err
+	}
+	old := s.db
+	s.svcs = svcs
+	s.db = db
+	if old == nil {
+		return nil
+	}
+	start, end, ok := s.db.Changed(old)
+	if !ok {
+		return nil
+	}
+	// The devices, which are served with views, are indicated with the
+	// changes of their views only.
+	r := ble.HandleRange{Start: start, End: end}
+	conns := make([]ble.Conn, 0, len(s.bearers))
+	for as := range s.bearers {
+		if s.view != nil {
+			s.refresh(as)
+		} else {
+			as.SetDB(s.db)
+			s.bearers[as] = s.db
+		}
+		conns = append(conns, as.Conn())
+	}
+	go s.indicateServiceChanged(r, s.view == nil, s.sc.CCCD.Handle, s.bonds, conns)
+	return nil
+}
+
+// indicateServiceChanged indicates the range of the handles changed to the
+// subscribed devices if all is set, and saves it for the bonded devices, which
+// enabled the indications in the CCCD of handle ccc, but aren't connected
+// [Vol 3, Part G, 7.1].
+func (s *Server) indicateServiceChanged(r ble.HandleRange, all bool, ccc uint16, bonds ble.BondStore, conns []ble.Conn) {
+	v := make([]byte, 4)
+	binary.LittleEndian.PutUint16(v, r.Start)
+	binary.LittleEndian.PutUint16(v[2:], r.End)
+
+	if all {
+		s.muSC.Lock()
+		ns := make([]ble.Notifier, 0, len(s.scNotifiers))
+		for n := range s.scNotifiers {
+			ns = append(ns, n)
+		}
+		s.muSC.Unlock()
+		for _, n := range ns {
+			if _, err := n.Write(v); err != nil {
+				log.Printf("can't indicate service changed: %s", err)
+			}
+		}
+	}
+
+	if bonds == nil {
+		return
+	}
+	connected := make(map[string]bool)
+	for _, c := range conns {
+		if bc, ok := c.(ble.BondedConn); ok {
+			if b := bc.Bond(); b != nil {
+				connected[strings.ToLower(b.Addr)] = true
+			}
+		}
+	}
+	bb, err := bonds.List()
+	if err != nil {
+		log.Printf("can't list bonds: %s", err)
+		return
+	}
+	for _, b := range bb {
+		if connected[strings.ToLower(b.Addr)] {
+			continue
+		}
+		// A client with Robust Caching enabled is change-unaware when it
+		// reconnects, even if it doesn't subscribe Service Changed [Vol 3, Part G, 2.5.2.1].
+		robust := len(b.ClientFeatures) > 0 && b.ClientFeatures[0]&ble.ClientFeatureRobustCaching != 0
+		if b.CCCDs[ccc]&0x0002 == 0 && !robust {
+			continue
+		}
+		if b.ServiceChanged == nil {
+			b.ServiceChanged = &ble.HandleRange{Start: r.Start, End: r.End}
+		} else {
+			b.ServiceChanged.Merge(r)
+		}
+		if err := bonds.Save(b); err != nil {
+			log.Printf("can't save bond: %s", err)
+		}
+	}
+}
+
+// serveServiceChanged keeps the notifier of a device, which enables Service
+// Changed indications, until it's unsubscribed.
+func (s *Server) serveServiceChanged(req ble.Request, n ble.Notifier) {
+	s.muSC.Lock()
+	s.scNotifiers[n] = true
+	s.muSC.Unlock()
+	defer func() {
+		s.muSC.Lock()
+		delete(s.scNotifiers, n)
+		s.muSC.Unlock()
+	}()
+	if s.handler != nil {
+		s.handler.ServeNotify(req, n)
+	}
+	<-n.Context().Done()
 }
+
+// defaultServices returns the GAP and GATT services. They are created once,
+// so the subscriptions of the Service Changed characteristic are kept across
+// the changes of the services.
+func (s *Server) defaultServices() []*ble.Service {
+	if s.defaults == nil {
+		s.defaults = defaultServicesWithHandler(s.name, ble.NotifyHandlerFunc(s.serveServiceChanged))
+		for _, c := range s.defaults[1].Characteristics {
+			switch {
+			case c.UUID.Equal(ble.ServiceChangedUUID):
+				s.sc = c
+			case c.UUID.Equal(ble.ServerSupportedFeaturesUUID):
+				c.HandleRead(ble.ReadHandlerFunc(s.serveServerFeatures))
+			}
+		}
+	}
+	return append([]*ble.Service(nil), s.defaults...)
+}
+
 func defaultServicesWithHandler(name string, handler ble.NotifyHandler) []*ble.Service {
 	// https://developer.bluetooth.org/gatt/characteristics/Pages/CharacteristicViewer.aspx?u=org.bluetooth.characteristic.ble.appearance.xml
 	var gapCharAppearanceGenericComputer = []byte{0x00, 0x80}
@@ -83,22 +385,9 @@ func defaultServicesWithHandler(name string, handler ble.NotifyHandler) []*ble.S
 	gapSvc.NewCharacteristic(ble.PeferredParamsUUID).SetValue([]byte{0x06, 0x00, 0x06, 0x00, 0x00, 0x00, 0xd0, 0x07})
 
 	gattSvc := ble.NewService(ble.GATTUUID)
-	var indicationHandler ble.NotifyHandlerFunc
-	indicationHandler = defaultHanderFunc
-	if handler != nil {
-		indicationHandler = handler.ServeNotify
-	}
-	gattSvc.NewCharacteristic(ble.ServiceChangedUUID).HandleIndicate(indicationHandler)
+	gattSvc.NewCharacteristic(ble.ServiceChangedUUID).HandleIndicate(handler)
+	att.HandleClientSupportedFeatures(gattSvc.NewCharacteristic(ble.ClientSupportedFeaturesUUID))
+	att.HandleDatabaseHash(gattSvc.NewCharacteristic(ble.DatabaseHashUUID))
+	gattSvc.NewCharacteristic(ble.ServerSupportedFeaturesUUID) // Served by the server.
 	return []*ble.Service{gapSvc, gattSvc}
 }
-
-func defaultHanderFunc(r ble.Request, n ble.Notifier) {
-	log.Printf("TODO: indicate client when the services are changed")
-	for {
-		select {
-		case <-n.Context().Done():
-			log.Printf("count: Notification unsubscribed")
-			return
-		}
-	}
-}
@@ -0,0 +1,45 @@
+package gatt
+
+import (
+	"testing"
+
+	"github.com/runtimeco/ble"
+	"github.com/runtimeco/ble/linux/att"
+)
+
+func TestServiceChangedWithView(t *testing.T) {
+	s, err := NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.SetView(func(conn ble.Conn, svcs []*ble.Service) []*ble.Service { return svcs })
+
+	l2c := newPipeConn()
+	defer l2c.Close()
+	as, err := att.NewServer(s.DB(), l2c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Serve(as)
+
+	// Enable the Service Changed indications.
+	ccc := s.sc.CCCD.Handle
+	l2c.in <- []byte{att.WriteRequestCode, byte(ccc), byte(ccc >> 8), 0x02, 0x00}
+	if b := l2c.receive(t); b[0] != att.WriteResponseCode {
+		t.Fatalf("response % X to the CCCD write", b)
+	}
+
+	svc := ble.NewService(ble.UUID16(0x1234))
+	svc.NewCharacteristic(ble.UUID16(0x5678)).SetValue([]byte{0x01})
+	if err := s.SetServices([]*ble.Service{svc}); err != nil {
+		t.Fatal(err)
+	}
+	b := l2c.receive(t)
+	if b[0] != att.HandleValueIndicationCode || len(b) != 7 {
+		t.Fatalf("sent % X, want a Service Changed indication", b)
+	}
+	if h := uint16(b[1]) | uint16(b[2])<<8; h != s.sc.ValueHandle {
+		t.Errorf("indicated handle 0x%04X, want 0x%04X", h, s.sc.ValueHandle)
+	}
+	l2c.in <- []byte{att.HandleValueConfirmationCode}
+}
@@ -0,0 +1,164 @@
+package hci
+
+import (
+	"bytes"
+	"net"
+
+	"github.com/runtimeco/ble"
+	"github.com/runtimeco/ble/linux/hci/cmd"
+)
+
+// addrString formats the address, which is least significant octet first.
+func addrString(a []byte) string {
+	return net.HardwareAddr(swap(a)).String()
+}
+
+// lookupBond returns the bond with the remote device of the address a, which
+// is either its identity address, or a resolvable private address generated
+// with its IRK.
+func (h *HCI) lookupBond(t uint8, a []byte) *ble.Bond {
+	if h.bonds == nil {
+		return nil
+	}
+	if b, err := h.bonds.Load(ble.NewAddr(addrString(a))); err == nil {
+		return b
+	}
+
+	// The two most significant bits of a resolvable private address are 0b01 [Vol 6, Part B, 1.3.2.2].
+	if t != 0x01 || a[5]&0xC0 != 0x40 {
+		return nil
+	}
+	bonds, err := h.bonds.List()
+	if err != nil {
+		_ = logger.Error("bond", "list", err)
+		return nil
+	}
+	for _, b := range bonds {
+		if len(b.IRK) == 16 && bytes.Equal(ah(b.IRK, a[3:6]), a[0:3]) {
+			return b
+		}
+	}
+	return nil
+}
+
+// loadBond returns the bond with the remote device, or nil if it isn't bonded.
+func (s *smp) loadBond() *ble.Bond {
+	if !s.bondLoaded {
+		t, a := s.c.peerAddr()
+		s.bond = s.c.hci.lookupBond(t, a)
+		s.bondLoaded = true
+	}
+	return s.bond
+}
+
+// saveBond saves the keys exchanged in the pairing, if both devices requested bonding.
+func (s *smp) saveBond() {
+	if !s.bonding || s.c.hci.bonds == nil {
+		return
+	}
+	t, a := s.c.peerAddr()
+	if s.peer.addr != nil {
+		t, a = s.peer.addrType, s.peer.addr
+	}
+	b := &ble.Bond{
+		Addr:              addrString(a),
+		AddrType:          t,
+		IRK:               s.peer.irk,
+		LocalCSRK:         s.local.csrk,
+		PeerCSRK:          s.peer.csrk,
+		Authenticated:     s.authenticated,
+		SecureConnections: s.sc,
+		KeySize:           s.keySize,
+	}
+	if s.local.ltk != nil {
+		b.LocalLTK = &ble.LTK{Key: s.local.ltk, EDIV: s.local.ediv, Rand: s.local.rand}
+	}
+	if s.peer.ltk != nil {
+		b.PeerLTK = &ble.LTK{Key: s.peer.ltk, EDIV: s.peer.ediv, Rand: s.peer.rand}
+	}
+
+	// Keep the configurations of the remote device, if it was bonded before.
+	if old := s.loadBond(); old != nil && old.Addr == b.Addr {
+		b.CCCDs = old.CCCDs
+	}
+	if err := s.c.hci.bonds.Save(b); err != nil {
+		_ = logger.Error("bond", "save", err)
+		return
+	}
+	s.bond, s.bondLoaded = b, true
+}
+
+// encryptBond encrypts the link with the LTK distributed by the remote
+// device, if it's bonded. This is done by the master only.
+func (s *smp) encryptBond() bool {
+	b := s.loadBond()
+	if b == nil || b.PeerLTK == nil {
+		return false
+	}
+	s.start(true)
+	s.timer.Stop() // This is not an SMP procedure.
+	s.state = smpWaitBondEncryption
+	s.bondKey = true
+
+	c := &cmd.LEStartEncryption{
+		ConnectionHandle:     s.c.param.ConnectionHandle(),
+		RandomNumber:         b.PeerLTK.Rand,
+		EncryptedDiversifier: b.PeerLTK.EDIV,
+	}
+	copy(c.LongTermKey[:], b.PeerLTK.Key)
+	s.sendEncryption(c)
+	return true
+}
+
+// bondEncrypted is called when the link has been encrypted with the LTK of the bond.
+func (s *smp) bondEncrypted(status uint8) {
+	s.state = smpIdle
+	if s.encrypted {
+		s.authenticated, s.encKeySize = s.bond.Authenticated, s.bond.KeySize
+		s.finish(nil)
+		return
+	}
+
+	// The remote device may have lost the keys, pair again.
+	logger.Info("bond", "peer", s.c.RemoteAddr(), "encryption failed", ErrCommand(status))
+	gen := s.gen
+	go func() {
+		s.Lock()
+		defer s.Unlock()
+		if s.gen == gen && s.done != nil && s.state == smpIdle {
+			s.requestPairing()
+		}
+	}()
+}
+
+// resume encrypts the link with the LTK of the bond, if the remote device is bonded.
+func (s *smp) resume() {
+	s.Lock()
+	defer s.Unlock()
+	if s.done == nil && !s.timedOut && !s.encrypted {
+		s.encryptBond()
+	}
+}
+
+// Bond returns a copy of the bond with the remote device, or nil if it isn't bonded.
+func (c *Conn) Bond() *ble.Bond {
+	c.smp.Lock()
+	defer c.smp.Unlock()
+	b := c.smp.loadBond()
+	if b == nil {
+		return nil
+	}
+	return b.Copy()
+}
+
+// UpdateBond calls f with the bond with the remote device, and saves the modified bond.
+func (c *Conn) UpdateBond(f func(b *ble.Bond)) error {
+	c.smp.Lock()
+	defer c.smp.Unlock()
+	b := c.smp.loadBond()
+	if b == nil {
+		return ble.ErrBondNotFound
+	}
+	f(b)
+	return c.hci.bonds.Save(b)
+}
@@ -0,0 +1,676 @@
+package hci
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/runtimeco/ble"
+)
+
+// LE credit based flow control mode [Vol 3, Part A, 3.4, 10.1].
+const (
+	cocMinMTU     = 23    // Minimum MTU and MPS of the channels.
+	cocMaxMPS     = 65533 // Maximum MPS of the channels.
+	cocMaxCredits = 65535 // Maximum credits a device may hold.
+	cocCredits    = 10    // Credits granted to the remote device.
+)
+
+// ErrListenerClosed is returned by L2CAPListener.Accept after the listener is closed.
+var ErrListenerClosed = errors.New("listener closed")
+
+// L2CAPListener accepts the LE credit based connection-oriented channels,
+// which remote devices connect to an LE_PSM.
+type L2CAPListener struct {
+	h   *HCI
+	psm uint16
+	mtu int
+	sec ble.Security
+
+	chChan chan *L2CAPChannel
+	done   chan struct{}
+}
+
+// ListenL2CAP registers the LE_PSM, and returns a listener which accepts the
+// channels connected to it. The mtu is the maximum size of the SDUs that the
+// local device accepts on the channels.
+func (h *HCI) ListenL2CAP(psm uint16, mtu int) (*L2CAPListener, error) {
+	// SIG assigned LE_PSMs range from 0x0001 to 0x007F, and dynamic ones
+	// range from 0x0080 to 0x00FF [Vol 3, Part A, 4.22].
+	if psm == 0 || psm > 0x00FF {
+		return nil, fmt.Errorf("invalid LE_PSM 0x%04X", psm)
+	}
+	if mtu < cocMinMTU || mtu > 0xFFFF {
+		return nil, fmt.Errorf("invalid MTU %d", mtu)
+	}
+	h.muL2CAP.Lock()
+	defer h.muL2CAP.Unlock()
+	if _, ok := h.listeners[psm]; ok {
+		return nil, fmt.Errorf("LE_PSM 0x%04X is in use", psm)
+	}
+	l := &L2CAPListener{
+		h:      h,
+		psm:    psm,
+		mtu:    mtu,
+		chChan: make(chan *L2CAPChannel, 8),
+		done:   make(chan struct{}),
+	}
+	h.listeners[psm] = l
+	return l, nil
+}
+
+// listener returns the listener registered to the LE_PSM, if any.
+func (h *HCI) listener(psm uint16) *L2CAPListener {
+	h.muL2CAP.Lock()
+	defer h.muL2CAP.Unlock()
+	return h.listeners[psm]
+}
+
+// PSM returns the LE_PSM which the listener is registered to.
+func (l *L2CAPListener) PSM() uint16 { return l.psm }
+
+// RequireSecurity sets the security required to connect to the listener.
+// The connection is refused if the link doesn't meet it.
+func (l *L2CAPListener) RequireSecurity(s ble.Security) {
+	l.h.muL2CAP.Lock()
+	defer l.h.muL2CAP.Unlock()
+	l.sec = s
+}
+
+// Accept waits for and returns the next channel connected to the listener.
+func (l *L2CAPListener) Accept() (ble.Conn, error) {
+	select {
+	case ch := <-l.chChan:
+		return ch, nil
+	case <-l.done:
+		return nil, ErrListenerClosed
+	case <-l.h.done:
+		return nil, l.h.err
+	}
+}
+
+// Close unregisters the LE_PSM, and disconnects the channels not accepted yet.
+func (l *L2CAPListener) Close() error {
+	l.h.muL2CAP.Lock()
+	if l.h.listeners[l.psm] != l {
+		l.h.muL2CAP.Unlock()
+		return nil
+	}
+	delete(l.h.listeners, l.psm)
+	close(l.done)
+	l.h.muL2CAP.Unlock()
+	for {
+		select {
+		case ch := <-l.chChan:
+			ch.Close()
+		default:
+			return nil
+		}
+	}
+}
+
+// L2CAPChannel is an LE credit based connection-oriented channel [Vol 3, Part A, 3.4].
+// Each Write sends an SDU, which is segmented into K-frames, and Read returns
+// the data of the reassembled SDUs.
+type L2CAPChannel struct {
+	c   *Conn
+	ctx context.Context
+	psm uint16
+
+	// enhanced is set if the channel is in Enhanced Credit Based Flow Control mode.
+	enhanced bool
+
+	scid uint16 // Local CID.
+	dcid uint16 // Remote CID.
+
+	// The MTUs and MPSs, which are guarded by mu, since the channels in
+	// Enhanced Credit Based Flow Control mode can be reconfigured.
+	rxMTU int
+	rxMPS int
+	txMTU int
+	txMPS int
+
+	mu        sync.Mutex
+	txCond    *sync.Cond
+	txCredits int // Credits to send K-frames.
+	rxCredits int // Credits granted to the remote device, which haven't been used.
+	err       error
+	chDone    chan struct{}
+
+	// wmu serializes the SDUs sent, and rmu serializes the reads.
+	wmu sync.Mutex
+	rmu sync.Mutex
+
+	// rxSDUs are the SDUs reassembled, and rbuf is the unread data of the
+	// SDU being read. Since each K-frame takes a credit, the number of SDUs
+	// can't exceed the credits granted.
+	rxSDUs chan cocSDU
+	rbuf   []byte
+
+	// The SDU being reassembled, which is only accessed by the recombine goroutine.
+	sdu    []byte
+	slen   int
+	frames int
+}
+
+// cocSDU is an SDU received, and the number of K-frames which carried it.
+type cocSDU struct {
+	b      []byte
+	frames int
+}
+
+func newChannel(c *Conn, psm uint16, mtu int, enhanced bool) *L2CAPChannel {
+	if enhanced && mtu < ecfcMinMTU {
+		mtu = ecfcMinMTU
+	}
+	mps := mtu + 2
+	if mps > cocMaxMPS {
+		mps = cocMaxMPS
+	}
+	ch := &L2CAPChannel{
+		c:         c,
+		psm:       psm,
+		enhanced:  enhanced,
+		rxMTU:     mtu,
+		rxMPS:     mps,
+		rxCredits: cocCredits,
+		chDone:    make(chan struct{}),
+		rxSDUs:    make(chan cocSDU, cocCredits),
+	}
+	ch.txCond = sync.NewCond(&ch.mu)
+	return ch
+}
+
+// acceptChannel creates the channel requested by the remote device, if it's acceptable.
+func (c *Conn) acceptChannel(req *LECreditBasedConnectionRequest) (*L2CAPChannel, error) {
+	l, err := c.listenerOf(req.LEPSM)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case req.SourceCID < cidDynamicFirst || req.SourceCID > cidDynamicLast:
+		return nil, ErrL2CAPInvalidSourceCID
+	case c.remoteChannel(req.SourceCID) != nil:
+		return nil, ErrL2CAPSourceCIDAllocated
+	case req.MTU < cocMinMTU || req.MPS < cocMinMTU || req.MPS > cocMaxMPS:
+		return nil, ErrL2CAPUnacceptableParameters
+	}
+	return c.deliverChannel(l, newChannel(c, l.psm, l.mtu, false), req.SourceCID, req.MTU, req.MPS)
+}
+
+// listenerOf returns the listener of the LE_PSM, if the link meets its security requirements.
+func (c *Conn) listenerOf(psm uint16) (*L2CAPListener, error) {
+	l := c.hci.listener(psm)
+	if l == nil {
+		return nil, ErrL2CAPPSMNotSupported
+	}
+
+	c.hci.muL2CAP.Lock()
+	sec := l.sec
+	c.hci.muL2CAP.Unlock()
+	cur := c.Security()
+	switch {
+	case sec.Authenticated && !cur.Authenticated:
+		return nil, ErrL2CAPAuthentication
+	case sec.Encrypted && !cur.Encrypted:
+		return nil, ErrL2CAPEncryption
+	case cur.KeySize < sec.KeySize:
+		return nil, ErrL2CAPEncryptionKeySize
+	}
+	return l, nil
+}
+
+// deliverChannel registers the channel connected by the remote device, and
+// queues it to the listener.
+func (c *Conn) deliverChannel(l *L2CAPListener, ch *L2CAPChannel, dcid, mtu, mps uint16) (*L2CAPChannel, error) {
+	ch.dcid = dcid
+	ch.txMTU = int(mtu)
+	ch.txMPS = int(mps)
+	if !c.addChannel(ch) {
+		return nil, ErrL2CAPNoResources
+	}
+	select {
+	case l.chChan <- ch:
+		return ch, nil
+	default:
+		c.removeChannel(ch)
+		return nil, ErrL2CAPNoResources
+	}
+}
+
+// OpenL2CAPChannel connects an LE credit based channel to the LE_PSM of the
+// remote device [Vol 3, Part A, 4.22]. The mtu is the maximum size of the SDUs
+// that the local device accepts on the channel. If the remote device refuses
+// the connection, the returned error is an ErrL2CAP. On ErrL2CAPAuthentication,
+// ErrL2CAPEncryption, or ErrL2CAPEncryptionKeySize, the caller may Pair and retry.
+func (c *Conn) OpenL2CAPChannel(ctx context.Context, psm uint16, mtu int) (ble.Conn, error) {
+	if psm == 0 || psm > 0x00FF {
+		return nil, fmt.Errorf("invalid LE_PSM 0x%04X", psm)
+	}
+	if mtu < cocMinMTU || mtu > 0xFFFF {
+		return nil, fmt.Errorf("invalid MTU %d", mtu)
+	}
+	ch := newChannel(c, psm, mtu, false)
+	if !c.addChannel(ch) {
+		return nil, ErrL2CAPNoResources
+	}
+
+	rsp := &LECreditBasedConnectionResponse{}
+	id, err := c.signalID(ctx,
+		&LECreditBasedConnectionRequest{
+			LEPSM:          psm,
+			SourceCID:      ch.scid,
+			MTU:            uint16(ch.rxMTU),
+			MPS:            uint16(ch.rxMPS),
+			InitialCredits: uint16(ch.rxCredits),
+		}, rsp)
+	switch {
+	case err == errSignalTimeout || err != nil && err == ctx.Err():
+		// The remote device may accept the channel later.
+		c.abandon(id, ch.scid)
+	case err != nil:
+	case rsp.Result != 0:
+		err = ErrL2CAP(rsp.Result)
+	case rsp.DestinationCID < cidDynamicFirst || rsp.DestinationCID > cidDynamicLast:
+		err = fmt.Errorf("invalid destination CID 0x%04X", rsp.DestinationCID)
+	case rsp.MTU < cocMinMTU || rsp.MPS < cocMinMTU || rsp.MPS > cocMaxMPS:
+		err = fmt.Errorf("invalid parameters MTU %d, MPS %d", rsp.MTU, rsp.MPS)
+		go c.disconnectChannel(rsp.DestinationCID, ch.scid)
+	}
+	if err != nil {
+		ch.shutdown(err)
+		return nil, err
+	}
+
+	c.muChans.Lock()
+	ch.dcid = rsp.DestinationCID
+	c.muChans.Unlock()
+	ch.mu.Lock()
+	ch.txMTU = int(rsp.MTU)
+	ch.txMPS = int(rsp.MPS)
+	ch.mu.Unlock()
+	ch.addCredits(int(rsp.InitialCreditsCID))
+	return ch, nil
+}
+
+// abandon records the connection request of the channels, which is abandoned
+// before the response. If the remote device accepts the channels later, they
+// are disconnected.
+func (c *Conn) abandon(id uint8, scids ...uint16) {
+	c.muChans.Lock()
+	defer c.muChans.Unlock()
+	if c.abandoned == nil {
+		c.abandoned = make(map[uint8][]uint16)
+	}
+	c.abandoned[id] = scids
+}
+
+// abandonedResponse disconnects the channels accepted by the response of an
+// abandoned connection request. It reports whether the command is taken.
+func (c *Conn) abandonedResponse(s sigCmd) bool {
+	code := s.code()
+	if code != SignalLECreditBasedConnectionResponse && code != SignalCreditBasedConnectionResponse {
+		return false
+	}
+	c.muChans.Lock()
+	scids, ok := c.abandoned[s.id()]
+	delete(c.abandoned, s.id())
+	c.muChans.Unlock()
+	if !ok {
+		return false
+	}
+	if code == SignalLECreditBasedConnectionResponse {
+		var rsp LECreditBasedConnectionResponse
+		if err := rsp.Unmarshal(s.data()); err == nil && rsp.Result == 0 {
+			go c.disconnectChannel(rsp.DestinationCID, scids[0])
+		}
+		return true
+	}
+	var rsp CreditBasedConnectionResponse
+	if err := rsp.Unmarshal(s.data()); err != nil {
+		return true
+	}
+	for i, dcid := range rsp.DestinationCID {
+		if dcid != 0 && i < len(scids) {
+			go c.disconnectChannel(dcid, scids[i])
+		}
+	}
+	return true
+}
+
+// disconnectChannel sends a Disconnection Request of a channel, which the
+// remote device has connected, but isn't used by the local device.
+func (c *Conn) disconnectChannel(dcid, scid uint16) {
+	err := c.Signal(&DisconnectRequest{DestinationCID: dcid, SourceCID: scid}, &DisconnectResponse{})
+	if err != nil {
+		_ = logger.Error("l2cap", "disconnect unused channel", err)
+	}
+}
+
+// addChannel allocates a local CID for the channel, and registers it.
+func (c *Conn) addChannel(ch *L2CAPChannel) bool {
+	c.muChans.Lock()
+	defer c.muChans.Unlock()
+	for cid := cidDynamicFirst; cid <= cidDynamicLast; cid++ {
+		if _, ok := c.chans[cid]; !ok {
+			ch.scid = cid
+			c.chans[cid] = ch
+			return true
+		}
+	}
+	return false
+}
+
+// removeChannel unregisters the channel.
+func (c *Conn) removeChannel(ch *L2CAPChannel) {
+	c.muChans.Lock()
+	defer c.muChans.Unlock()
+	if c.chans[ch.scid] == ch {
+		delete(c.chans, ch.scid)
+	}
+}
+
+// channel returns the channel of the local CID.
+func (c *Conn) channel(cid uint16) *L2CAPChannel {
+	c.muChans.Lock()
+	defer c.muChans.Unlock()
+	return c.chans[cid]
+}
+
+// remoteChannel returns the channel of the remote CID.
+func (c *Conn) remoteChannel(cid uint16) *L2CAPChannel {
+	c.muChans.Lock()
+	defer c.muChans.Unlock()
+	for _, ch := range c.chans {
+		if ch.dcid == cid {
+			return ch
+		}
+	}
+	return nil
+}
+
+// closeChannels closes all the channels when the link disconnects.
+func (c *Conn) closeChannels() {
+	c.muChans.Lock()
+	chans := make([]*L2CAPChannel, 0, len(c.chans))
+	for _, ch := range c.chans {
+		chans = append(chans, ch)
+	}
+	c.muChans.Unlock()
+	for _, ch := range chans {
+		ch.shutdown(io.ErrClosedPipe)
+	}
+}
+
+// receive handles a K-frame received on the channel, and reassembles the SDU [Vol 3, Part A, 3.4.3].
+// It's called by the recombine goroutine.
+func (ch *L2CAPChannel) receive(p pdu) {
+	ch.mu.Lock()
+	if ch.err != nil {
+		ch.mu.Unlock()
+		return
+	}
+	if ch.rxCredits == 0 {
+		ch.mu.Unlock()
+		ch.fail(errors.New("received a K-frame without credits"))
+		return
+	}
+	ch.rxCredits--
+	mtu, mps := ch.rxMTU, ch.rxMPS
+	ch.mu.Unlock()
+
+	if p.dlen() > mps {
+		ch.fail(fmt.Errorf("K-frame size (%d) larger than MPS (%d)", p.dlen(), mps))
+		return
+	}
+	b := p.payload()
+	if ch.sdu == nil {
+		// The first K-frame of the SDU starts with the SDU length.
+		if len(b) < 2 {
+			ch.fail(errors.New("K-frame without SDU length"))
+			return
+		}
+		ch.slen = leFrameHdr(p).slen()
+		if ch.slen > mtu {
+			ch.fail(fmt.Errorf("SDU size (%d) larger than MTU (%d)", ch.slen, mtu))
+			return
+		}
+		b = leFrameHdr(p).payload()
+		ch.sdu = make([]byte, 0, ch.slen)
+	}
+	if len(ch.sdu)+len(b) > ch.slen {
+		ch.fail(fmt.Errorf("SDU larger than the SDU length (%d)", ch.slen))
+		return
+	}
+	ch.sdu = append(ch.sdu, b...)
+	ch.frames++
+	if len(ch.sdu) < ch.slen {
+		return
+	}
+	ch.rxSDUs <- cocSDU{b: ch.sdu, frames: ch.frames}
+	ch.sdu, ch.slen, ch.frames = nil, 0, 0
+}
+
+// addCredits adds the credits granted by the remote device.
+func (ch *L2CAPChannel) addCredits(n int) {
+	ch.mu.Lock()
+	if ch.err != nil {
+		ch.mu.Unlock()
+		return
+	}
+	ch.txCredits += n
+	if ch.txCredits > cocMaxCredits {
+		ch.mu.Unlock()
+		ch.fail(errors.New("credits exceeded 65535"))
+		return
+	}
+	ch.txCond.Broadcast()
+	ch.mu.Unlock()
+}
+
+// fail disconnects the channel on an error of the remote device [Vol 3, Part A, 10.1].
+// It's called by the recombine goroutine, which handles the Disconnection Response.
+func (ch *L2CAPChannel) fail(err error) {
+	_ = logger.Error("l2cap", "cid", fmt.Sprintf("%04X", ch.scid), "err", err)
+	go ch.Close()
+}
+
+// shutdown closes the channel locally. It reports whether the channel was open.
+func (ch *L2CAPChannel) shutdown(err error) bool {
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+	if ch.err != nil {
+		return false
+	}
+	ch.err = err
+	ch.c.removeChannel(ch)
+	close(ch.chDone)
+	ch.txCond.Broadcast()
+	return true
+}
+
+// Context returns the context that is used by this channel. Unless it's set,
+// the channel shares the context of the link.
+func (ch *L2CAPChannel) Context() context.Context {
+	if ch.ctx == nil {
+		return ch.c.Context()
+	}
+	return ch.ctx
+}
+
+// SetContext sets the context that is used by this channel.
+func (ch *L2CAPChannel) SetContext(ctx context.Context) { ch.ctx = ctx }
+
+// Link returns the connection of the ACL link, which the channel is on.
+func (ch *L2CAPChannel) Link() ble.Conn { return ch.c }
+
+// LocalAddr returns local device's address.
+func (ch *L2CAPChannel) LocalAddr() ble.Addr { return ch.c.LocalAddr() }
+
+// RemoteAddr returns remote device's address.
+func (ch *L2CAPChannel) RemoteAddr() ble.Addr { return ch.c.RemoteAddr() }
+
+// Security returns the current security state of the link.
+func (ch *L2CAPChannel) Security() ble.Security { return ch.c.Security() }
+
+// InsufficientSecurity is called when an access to an attribute over the
+// channel is rejected for insufficient security.
+func (ch *L2CAPChannel) InsufficientSecurity(required ble.Security) {
+	ch.c.InsufficientSecurity(required)
+}
+
+// SecurityChanged returns a channel, which is closed when the security state of the link changes.
+func (ch *L2CAPChannel) SecurityChanged() <-chan struct{} { return ch.c.SecurityChanged() }
+
+// Bond returns a copy of the bond with the remote device, or nil if it isn't bonded.
+func (ch *L2CAPChannel) Bond() *ble.Bond { return ch.c.Bond() }
+
+// UpdateBond calls f with the bond with the remote device, and saves the modified bond.
+func (ch *L2CAPChannel) UpdateBond(f func(b *ble.Bond)) error { return ch.c.UpdateBond(f) }
+
+// PSM returns the LE_PSM of the channel.
+func (ch *L2CAPChannel) PSM() uint16 { return ch.psm }
+
+// RxMTU returns the maximum size of the SDUs that the local device accepts.
+func (ch *L2CAPChannel) RxMTU() int {
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+	return ch.rxMTU
+}
+
+// SetRxMTU has no effect, since the MTU is negotiated when the channel is connected.
+func (ch *L2CAPChannel) SetRxMTU(mtu int) {}
+
+// TxMTU returns the maximum size of the SDUs that the remote device accepts.
+func (ch *L2CAPChannel) TxMTU() int {
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+	return ch.txMTU
+}
+
+// SetTxMTU has no effect, since the MTU is negotiated when the channel is connected.
+func (ch *L2CAPChannel) SetTxMTU(mtu int) {}
+
+// Disconnected returns a receiving channel, which is closed when the channel disconnects.
+func (ch *L2CAPChannel) Disconnected() <-chan struct{} { return ch.chDone }
+
+// Read reads the data of the SDUs received. It returns io.EOF once the
+// channel is disconnected, and all the received data has been read.
+func (ch *L2CAPChannel) Read(b []byte) (int, error) {
+	ch.rmu.Lock()
+	defer ch.rmu.Unlock()
+	if len(ch.rbuf) == 0 {
+		var s cocSDU
+		select {
+		case s = <-ch.rxSDUs:
+		default:
+			select {
+			case s = <-ch.rxSDUs:
+			case <-ch.chDone:
+				return 0, io.EOF
+			}
+		}
+		ch.rbuf = s.b
+		ch.grant(s.frames)
+	}
+	n := copy(b, ch.rbuf)
+	ch.rbuf = ch.rbuf[n:]
+	return n, nil
+}
+
+// grant returns the credits of the K-frames consumed to the remote device.
+func (ch *L2CAPChannel) grant(n int) {
+	ch.mu.Lock()
+	if ch.err != nil {
+		ch.mu.Unlock()
+		return
+	}
+	ch.rxCredits += n
+	ch.mu.Unlock()
+	_, err := ch.c.sendResponse(
+		SignalLEFlowControlCredit,
+		ch.c.nextSigID(),
+		&LEFlowControlCredit{
+			CID:     ch.scid,
+			Credits: uint16(n),
+		})
+	if err != nil {
+		_ = logger.Error("l2cap", "send credits", err)
+	}
+}
+
+// Write sends b as an SDU, which is segmented into K-frames of the MPS of the
+// remote device [Vol 3, Part A, 7.3.2]. Each K-frame takes a credit, and
+// Write blocks until the remote device grants enough credits.
+func (ch *L2CAPChannel) Write(b []byte) (int, error) {
+	ch.wmu.Lock()
+	defer ch.wmu.Unlock()
+	ch.mu.Lock()
+	mtu, mps := ch.txMTU, ch.txMPS
+	ch.mu.Unlock()
+	if len(b) > mtu {
+		return 0, errors.Wrapf(io.ErrShortWrite, "payload exceeds mtu")
+	}
+
+	data := b
+	for first := true; first || len(data) > 0; first = false {
+		if err := ch.takeCredit(); err != nil {
+			return len(b) - len(data), err
+		}
+		hlen := 4
+		if first {
+			hlen = 6 // The first K-frame carries the SDU length.
+		}
+		n := len(data)
+		if n > mps-(hlen-4) {
+			n = mps - (hlen - 4)
+		}
+		f := make([]byte, hlen+n)
+		binary.LittleEndian.PutUint16(f[0:2], uint16(hlen-4+n))
+		binary.LittleEndian.PutUint16(f[2:4], ch.dcid)
+		if first {
+			binary.LittleEndian.PutUint16(f[4:6], uint16(len(b)))
+		}
+		copy(f[hlen:], data[:n])
+		if _, err := ch.c.writePDU(f); err != nil {
+			return len(b) - len(data), err
+		}
+		data = data[n:]
+	}
+	return len(b), nil
+}
+
+// takeCredit waits for and takes a credit to send a K-frame.
+func (ch *L2CAPChannel) takeCredit() error {
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+	for ch.txCredits == 0 && ch.err == nil {
+		ch.txCond.Wait()
+	}
+	if ch.err != nil {
+		return io.ErrClosedPipe
+	}
+	ch.txCredits--
+	return nil
+}
+
+// Close disconnects the channel [Vol 3, Part A, 4.6].
+func (ch *L2CAPChannel) Close() error {
+	if !ch.shutdown(io.EOF) {
+		return nil
+	}
+	select {
+	case <-ch.c.Disconnected():
+		return nil
+	default:
+	}
+	return ch.c.Signal(
+		&DisconnectRequest{
+			DestinationCID: ch.dcid,
+			SourceCID:      ch.scid,
+		},
+		&DisconnectResponse{})
+}
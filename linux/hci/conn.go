@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"io"
 	"net"
+	"sync"
 
 	"github.com/runtimeco/ble"
 	"github.com/runtimeco/ble/linux/hci/cmd"
@@ -45,6 +46,7 @@ type Conn struct {
 	sigTxMTU int
 
 	sigSent chan []byte
+	sigMu   sync.Mutex // Serializes the signaling requests.
 	// smpSent chan []byte
 
 	chInPkt chan packet
@@ -59,10 +61,29 @@ type Conn struct {
 	// The requesting device sets this field and the responding device uses the
 	// same value in its response. Within each signalling channel a different
 	// Identifier shall be used for each successive command. [Vol 3, Part A, 4]
-	sigID uint8
+	sigID uint32
+
+	// sigPending is the identifier of the signaling request waiting for the
+	// response, or zero if there is none.
+	sigPending uint32
+
+	// fixed are the handlers of the fixed channels, keyed by the CIDs.
+	muFixed sync.Mutex
+	fixed   map[uint16]func(pdu)
+
+	// chans are the LE credit based connection-oriented channels, keyed by the local CIDs.
+	muChans sync.Mutex
+	chans   map[uint16]*L2CAPChannel
+
+	// abandoned are the local CIDs of the channels, of which the connection
+	// requests are abandoned, keyed by the identifiers of the requests.
+	abandoned map[uint8][]uint16
 
 	// leFrame is set to be true when the LE Credit based flow control is used.
 	leFrame bool
+
+	// smp handles the pairing and the key distribution of this connection.
+	smp *smp
 }
 
 func newConn(h *HCI, param evt.LEConnectionComplete) *Conn {
@@ -78,6 +99,9 @@ func newConn(h *HCI, param evt.LEConnectionComplete) *Conn {
 
 		sigRxMTU: ble.MaxMTU,
 		sigTxMTU: ble.DefaultMTU,
+		sigSent:  make(chan []byte, 1),
+
+		chans: make(map[uint16]*L2CAPChannel),
 
 		chInPkt: make(chan packet, 16),
 		chInPDU: make(chan pdu, 16),
@@ -86,6 +110,15 @@ func newConn(h *HCI, param evt.LEConnectionComplete) *Conn {
 
 		chDone: make(chan struct{}),
 	}
+	c.smp = newSMP(c)
+	c.fixed = map[uint16]func(pdu){
+		cidLEAtt:    func(p pdu) { c.chInPDU <- p },
+		cidLESignal: func(p pdu) { c.handleSignal(p) },
+		cidSMP:      func(p pdu) { c.handleSMP(p) },
+	}
+	for cid, f := range h.fixedHandlers() {
+		c.HandleFixedChannel(cid, f)
+	}
 
 	go func() {
 		for {
@@ -278,17 +311,15 @@ func (c *Conn) recombine() error {
 		p = append(p, pdu(pkt.data())...)
 	}
 
-	// TODO: support dynamic or assigned channels for LE-Frames.
-	switch p.cid() {
-	case cidLEAtt:
-		c.chInPDU <- p
-	case cidLESignal:
-		c.handleSignal(p)
-	case cidSMP:
-		c.handleSMP(p)
-	default:
-		logger.Info("recombine()", "unrecognized CID", fmt.Sprintf("%04X, [%X]", p.cid(), p))
+	if f := c.fixedHandler(p.cid()); f != nil {
+		f(p)
+		return nil
+	}
+	if ch := c.channel(p.cid()); ch != nil {
+		ch.receive(p)
+		return nil
 	}
+	logger.Info("recombine()", "unrecognized CID", fmt.Sprintf("%04X, [%X]", p.cid(), p))
 	return nil
 }
 
@@ -22,6 +22,12 @@ const (
 	cidLEAtt    uint16 = 0x04 // Attribute Protocol [Vol 3, Part F].
 	cidLESignal uint16 = 0x05 // Low Energy L2CAP Signaling channel [Vol 3, Part A, 4].
 	cidSMP      uint16 = 0x06 // SecurityManager Protocol [Vol 3, Part H].
+
+	cidFixedFirst uint16 = 0x01 // First fixed CID.
+	cidFixedLast  uint16 = 0x3F // Last fixed CID.
+
+	cidDynamicFirst uint16 = 0x40 // First dynamically allocated CID.
+	cidDynamicLast  uint16 = 0x7F // Last dynamically allocated CID.
 )
 
 const (
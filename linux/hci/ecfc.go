@@ -0,0 +1,396 @@
+package hci
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/pkg/errors"
+	"github.com/runtimeco/ble"
+)
+
+// Enhanced Credit Based Flow Control mode [Vol 3, Part A, 3.4, 10.2].
+const (
+	ecfcMinMTU      = 64 // Minimum MTU and MPS of the channels.
+	ecfcMaxChannels = 5  // Maximum channels connected or reconfigured by a request.
+)
+
+// Credit Based Reconfigure Response result codes [Vol 3, Part A, 4.28].
+const (
+	ecfcReconfigureMTUReduced   = 0x0001
+	ecfcReconfigureMPSReduced   = 0x0002
+	ecfcReconfigureInvalidDCID  = 0x0003
+	ecfcReconfigureUnacceptable = 0x0004
+)
+
+var errReconfigure = map[uint16]string{
+	ecfcReconfigureMTUReduced:   "reduction in size of MTU not allowed",
+	ecfcReconfigureMPSReduced:   "reduction in size of MPS not allowed for more than one channel",
+	ecfcReconfigureInvalidDCID:  "one or more Destination CIDs invalid",
+	ecfcReconfigureUnacceptable: "unacceptable parameters",
+}
+
+// SignalCreditBasedConnectionRequest is the code of Credit Based Connection Request signaling packet.
+const SignalCreditBasedConnectionRequest = 0x17
+
+// CreditBasedConnectionRequest implements Credit Based Connection Request (0x17) [Vol 3, Part A, 4.25].
+type CreditBasedConnectionRequest struct {
+	SPSM           uint16
+	MTU            uint16
+	MPS            uint16
+	InitialCredits uint16
+	SourceCID      []uint16
+}
+
+// Code returns the event code of the command.
+func (s CreditBasedConnectionRequest) Code() int { return 0x17 }
+
+// Marshal serializes the command parameters into binary form.
+func (s *CreditBasedConnectionRequest) Marshal() ([]byte, error) {
+	return marshalCIDs(s.SourceCID, s.SPSM, s.MTU, s.MPS, s.InitialCredits)
+}
+
+// Unmarshal de-serializes the binary data and stores the result in the receiver.
+func (s *CreditBasedConnectionRequest) Unmarshal(b []byte) error {
+	cids, err := unmarshalCIDs(b, &s.SPSM, &s.MTU, &s.MPS, &s.InitialCredits)
+	s.SourceCID = cids
+	return err
+}
+
+// SignalCreditBasedConnectionResponse is the code of Credit Based Connection Response signaling packet.
+const SignalCreditBasedConnectionResponse = 0x18
+
+// CreditBasedConnectionResponse implements Credit Based Connection Response (0x18) [Vol 3, Part A, 4.26].
+type CreditBasedConnectionResponse struct {
+	MTU            uint16
+	MPS            uint16
+	InitialCredits uint16
+	Result         uint16
+	DestinationCID []uint16
+}
+
+// Code returns the event code of the command.
+func (s CreditBasedConnectionResponse) Code() int { return 0x18 }
+
+// Marshal serializes the command parameters into binary form.
+func (s *CreditBasedConnectionResponse) Marshal() ([]byte, error) {
+	return marshalCIDs(s.DestinationCID, s.MTU, s.MPS, s.InitialCredits, s.Result)
+}
+
+// Unmarshal de-serializes the binary data and stores the result in the receiver.
+func (s *CreditBasedConnectionResponse) Unmarshal(b []byte) error {
+	cids, err := unmarshalCIDs(b, &s.MTU, &s.MPS, &s.InitialCredits, &s.Result)
+	s.DestinationCID = cids
+	return err
+}
+
+// SignalCreditBasedReconfigureRequest is the code of Credit Based Reconfigure Request signaling packet.
+const SignalCreditBasedReconfigureRequest = 0x19
+
+// CreditBasedReconfigureRequest implements Credit Based Reconfigure Request (0x19) [Vol 3, Part A, 4.27].
+// The DestinationCID are the CIDs of the channels on the device sending the request.
+type CreditBasedReconfigureRequest struct {
+	MTU            uint16
+	MPS            uint16
+	DestinationCID []uint16
+}
+
+// Code returns the event code of the command.
+func (s CreditBasedReconfigureRequest) Code() int { return 0x19 }
+
+// Marshal serializes the command parameters into binary form.
+func (s *CreditBasedReconfigureRequest) Marshal() ([]byte, error) {
+	return marshalCIDs(s.DestinationCID, s.MTU, s.MPS)
+}
+
+// Unmarshal de-serializes the binary data and stores the result in the receiver.
+func (s *CreditBasedReconfigureRequest) Unmarshal(b []byte) error {
+	cids, err := unmarshalCIDs(b, &s.MTU, &s.MPS)
+	s.DestinationCID = cids
+	return err
+}
+
+// SignalCreditBasedReconfigureResponse is the code of Credit Based Reconfigure Response signaling packet.
+const SignalCreditBasedReconfigureResponse = 0x1A
+
+// CreditBasedReconfigureResponse implements Credit Based Reconfigure Response (0x1A) [Vol 3, Part A, 4.28].
+type CreditBasedReconfigureResponse struct {
+	Result uint16
+}
+
+// Code returns the event code of the command.
+func (s CreditBasedReconfigureResponse) Code() int { return 0x1A }
+
+// Marshal serializes the command parameters into binary form.
+func (s *CreditBasedReconfigureResponse) Marshal() ([]byte, error) {
+	buf := bytes.NewBuffer(make([]byte, 0))
+	if err := binary.Write(buf, binary.LittleEndian, s); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Unmarshal de-serializes the binary data and stores the result in the receiver.
+func (s *CreditBasedReconfigureResponse) Unmarshal(b []byte) error {
+	return binary.Read(bytes.NewBuffer(b), binary.LittleEndian, s)
+}
+
+// marshalCIDs serializes the fixed fields followed by the list of CIDs.
+func marshalCIDs(cids []uint16, fields ...uint16) ([]byte, error) {
+	b := make([]byte, 2*(len(fields)+len(cids)))
+	for i, v := range append(fields, cids...) {
+		binary.LittleEndian.PutUint16(b[2*i:], v)
+	}
+	return b, nil
+}
+
+// unmarshalCIDs de-serializes the fixed fields, and returns the list of CIDs following them.
+func unmarshalCIDs(b []byte, fields ...*uint16) ([]uint16, error) {
+	if len(b) < 2*len(fields) || len(b)%2 != 0 {
+		return nil, fmt.Errorf("invalid signaling length %d", len(b))
+	}
+	for i, f := range fields {
+		*f = binary.LittleEndian.Uint16(b[2*i:])
+	}
+	b = b[2*len(fields):]
+	cids := make([]uint16, len(b)/2)
+	for i := range cids {
+		cids[i] = binary.LittleEndian.Uint16(b[2*i:])
+	}
+	return cids, nil
+}
+
+// handleCreditBasedConnectionRequest handles Credit Based Connection Request (0x17) [Vol 3, Part A, 4.25].
+func (c *Conn) handleCreditBasedConnectionRequest(s sigCmd) {
+	var req CreditBasedConnectionRequest
+	if err := req.Unmarshal(s.data()); err != nil {
+		return
+	}
+
+	rsp := &CreditBasedConnectionResponse{DestinationCID: make([]uint16, len(req.SourceCID))}
+	l, err := c.listenerOf(req.SPSM)
+	switch {
+	case err != nil:
+		rsp.Result = uint16(err.(ErrL2CAP))
+	case len(req.SourceCID) == 0 || len(req.SourceCID) > ecfcMaxChannels:
+		rsp.Result = uint16(ErrL2CAPInvalidParameters)
+	case req.MTU < ecfcMinMTU || req.MPS < ecfcMinMTU || req.MPS > cocMaxMPS:
+		rsp.Result = uint16(ErrL2CAPUnacceptableParameters)
+	}
+
+	// Unless all the channels are refused, each one is accepted or refused separately.
+	var chs []*L2CAPChannel
+	if rsp.Result == 0 {
+		for i, scid := range req.SourceCID {
+			var err error
+			switch {
+			case scid < cidDynamicFirst || scid > cidDynamicLast:
+				err = ErrL2CAPInvalidSourceCID
+			case c.remoteChannel(scid) != nil:
+				err = ErrL2CAPSourceCIDAllocated
+			default:
+				var ch *L2CAPChannel
+				ch, err = c.deliverChannel(l, newChannel(c, l.psm, l.mtu, true), scid, req.MTU, req.MPS)
+				if err == nil {
+					rsp.DestinationCID[i] = ch.scid
+					chs = append(chs, ch)
+				}
+			}
+			if err != nil {
+				rsp.Result = uint16(err.(ErrL2CAP))
+			}
+		}
+	}
+	if len(chs) > 0 {
+		rsp.MTU = uint16(chs[0].rxMTU)
+		rsp.MPS = uint16(chs[0].rxMPS)
+		rsp.InitialCredits = uint16(chs[0].rxCredits)
+	}
+	if _, err := c.sendResponse(SignalCreditBasedConnectionResponse, s.id(), rsp); err != nil {
+		_ = logger.Error("send repsonse", fmt.Sprintf("%v", err))
+	}
+
+	// The channels can't send K-frames until the response has been sent.
+	for _, ch := range chs {
+		ch.addCredits(int(req.InitialCredits))
+	}
+}
+
+// handleCreditBasedReconfigureRequest handles Credit Based Reconfigure Request (0x19) [Vol 3, Part A, 4.27].
+func (c *Conn) handleCreditBasedReconfigureRequest(s sigCmd) {
+	var req CreditBasedReconfigureRequest
+	if err := req.Unmarshal(s.data()); err != nil {
+		return
+	}
+
+	rsp := &CreditBasedReconfigureResponse{}
+	chs := make([]*L2CAPChannel, 0, len(req.DestinationCID))
+	for _, cid := range req.DestinationCID {
+		ch := c.remoteChannel(cid)
+		if ch == nil || !ch.enhanced {
+			rsp.Result = ecfcReconfigureInvalidDCID
+			break
+		}
+		chs = append(chs, ch)
+	}
+	switch {
+	case rsp.Result != 0:
+	case len(chs) == 0 || len(chs) > ecfcMaxChannels:
+		rsp.Result = ecfcReconfigureUnacceptable
+	case req.MTU < ecfcMinMTU || req.MPS < ecfcMinMTU || req.MPS > cocMaxMPS:
+		rsp.Result = ecfcReconfigureUnacceptable
+	}
+	for _, ch := range chs {
+		if rsp.Result != 0 {
+			break
+		}
+		ch.mu.Lock()
+		switch {
+		case int(req.MTU) < ch.txMTU:
+			rsp.Result = ecfcReconfigureMTUReduced
+		case int(req.MPS) < ch.txMPS && len(chs) > 1:
+			rsp.Result = ecfcReconfigureMPSReduced
+		}
+		ch.mu.Unlock()
+	}
+	if rsp.Result == 0 {
+		for _, ch := range chs {
+			ch.mu.Lock()
+			ch.txMTU = int(req.MTU)
+			ch.txMPS = int(req.MPS)
+			ch.mu.Unlock()
+		}
+	}
+	if _, err := c.sendResponse(SignalCreditBasedReconfigureResponse, s.id(), rsp); err != nil {
+		_ = logger.Error("send repsonse", fmt.Sprintf("%v", err))
+	}
+}
+
+// OpenEnhancedL2CAPChannels connects up to 5 channels in Enhanced Credit Based
+// Flow Control mode to the SPSM of the remote device with a request [Vol 3, Part A, 4.25].
+// The mtu is the maximum size of the SDUs that the local device accepts on the
+// channels, which is at least 64. The remote device may accept only some of
+// the channels. If it refuses all of them, the returned error is an ErrL2CAP.
+func (c *Conn) OpenEnhancedL2CAPChannels(ctx context.Context, psm uint16, mtu int, n int) ([]ble.Conn, error) {
+	if psm == 0 || psm > 0x00FF {
+		return nil, fmt.Errorf("invalid SPSM 0x%04X", psm)
+	}
+	if mtu < ecfcMinMTU || mtu > 0xFFFF {
+		return nil, fmt.Errorf("invalid MTU %d", mtu)
+	}
+	if n < 1 || n > ecfcMaxChannels {
+		return nil, fmt.Errorf("invalid number of channels %d", n)
+	}
+
+	chs := make([]*L2CAPChannel, 0, n)
+	scids := make([]uint16, 0, n)
+	for i := 0; i < n; i++ {
+		ch := newChannel(c, psm, mtu, true)
+		if !c.addChannel(ch) {
+			break
+		}
+		chs = append(chs, ch)
+		scids = append(scids, ch.scid)
+	}
+	if len(chs) == 0 {
+		return nil, ErrL2CAPNoResources
+	}
+
+	rsp := &CreditBasedConnectionResponse{}
+	id, err := c.signalID(ctx,
+		&CreditBasedConnectionRequest{
+			SPSM:           psm,
+			MTU:            uint16(chs[0].rxMTU),
+			MPS:            uint16(chs[0].rxMPS),
+			InitialCredits: uint16(chs[0].rxCredits),
+			SourceCID:      scids,
+		}, rsp)
+	switch {
+	case err == errSignalTimeout || err != nil && err == ctx.Err():
+		// The remote device may accept the channels later.
+		c.abandon(id, scids...)
+	case err == nil && len(rsp.DestinationCID) != len(chs):
+		err = fmt.Errorf("mismatched number of destination CIDs %d", len(rsp.DestinationCID))
+	}
+	if err != nil {
+		for _, ch := range chs {
+			ch.shutdown(err)
+		}
+		return nil, err
+	}
+
+	var conns []ble.Conn
+	for i, ch := range chs {
+		dcid := rsp.DestinationCID[i]
+		if dcid == 0 {
+			ch.shutdown(ErrL2CAP(rsp.Result))
+			continue
+		}
+		c.muChans.Lock()
+		ch.dcid = dcid
+		c.muChans.Unlock()
+		ch.mu.Lock()
+		ch.txMTU = int(rsp.MTU)
+		ch.txMPS = int(rsp.MPS)
+		ch.mu.Unlock()
+		conns = append(conns, ch)
+	}
+	switch {
+	case len(conns) == 0 && rsp.Result != 0:
+		return nil, ErrL2CAP(rsp.Result)
+	case len(conns) == 0:
+		return nil, errors.New("no channel connected")
+	case rsp.MTU < ecfcMinMTU || rsp.MPS < ecfcMinMTU || rsp.MPS > cocMaxMPS:
+		for _, ch := range conns {
+			ch.Close()
+		}
+		return nil, fmt.Errorf("invalid parameters MTU %d, MPS %d", rsp.MTU, rsp.MPS)
+	}
+	for _, ch := range conns {
+		ch.(*L2CAPChannel).addCredits(int(rsp.InitialCredits))
+	}
+	return conns, nil
+}
+
+// Reconfigure increases the MTU of the channel in Enhanced Credit Based Flow
+// Control mode, which is the maximum size of the SDUs that the local device
+// accepts [Vol 3, Part A, 4.27].
+func (ch *L2CAPChannel) Reconfigure(ctx context.Context, mtu int) error {
+	if !ch.enhanced {
+		return errors.New("channel is not in enhanced credit based flow control mode")
+	}
+	ch.mu.Lock()
+	old, mps := ch.rxMTU, ch.rxMPS
+	if mtu < old || mtu > 0xFFFF {
+		ch.mu.Unlock()
+		return fmt.Errorf("invalid MTU %d", mtu)
+	}
+	// Accept the larger SDUs, which the remote device may send as soon as it responds.
+	ch.rxMTU = mtu
+	ch.mu.Unlock()
+
+	rsp := &CreditBasedReconfigureResponse{}
+	err := ch.c.signal(ctx,
+		&CreditBasedReconfigureRequest{
+			MTU:            uint16(mtu),
+			MPS:            uint16(mps),
+			DestinationCID: []uint16{ch.scid},
+		}, rsp)
+	if err == nil && rsp.Result != 0 {
+		err = fmt.Errorf("reconfiguration refused: %s", reconfigureResult(rsp.Result))
+	}
+	if err != nil {
+		ch.mu.Lock()
+		ch.rxMTU = old
+		ch.mu.Unlock()
+	}
+	return err
+}
+
+func reconfigureResult(r uint16) string {
+	if s, ok := errReconfigure[r]; ok {
+		return s
+	}
+	return fmt.Sprintf("reserved result (0x%04X)", r)
+}
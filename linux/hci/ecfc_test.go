@@ -0,0 +1,152 @@
+package hci
+
+import (
+	"context"
+	"encoding/binary"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// u16s returns the 16-bit values in little endian.
+func u16s(vs ...uint16) []byte {
+	b := make([]byte, 2*len(vs))
+	for i, v := range vs {
+		binary.LittleEndian.PutUint16(b[2*i:], v)
+	}
+	return b
+}
+
+// words returns the 16-bit values of b in little endian.
+func words(b []byte) []uint16 {
+	vs := make([]uint16, len(b)/2)
+	for i := range vs {
+		vs[i] = binary.LittleEndian.Uint16(b[2*i:])
+	}
+	return vs
+}
+
+// connectEnhanced connects the enhanced channels with the remote CIDs to the
+// listener of SPSM 0x0027, and returns the words of the response.
+func connectEnhanced(t *testing.T, c *Conn, skt chanSkt, mtu uint16, scids ...uint16) []uint16 {
+	c.chInPkt <- sigPacket(SignalCreditBasedConnectionRequest, 0x01,
+		append(u16s(0x0027, mtu, mtu, 5), u16s(scids...)...)...)
+	code, id, data := receiveSignal(t, skt)
+	if code != SignalCreditBasedConnectionResponse || id != 0x01 {
+		t.Fatalf("sent signal 0x%02X (id %d), want Credit Based Connection Response", code, id)
+	}
+	return words(data)
+}
+
+func TestCreditBasedConnectionRequest(t *testing.T) {
+	skt := make(chanSkt, 1)
+	c := newTestConn(skt)
+	defer close(c.chInPkt)
+	l, err := c.hci.ListenL2CAP(0x0027, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The channel with the invalid CID 0x0010 is refused, and the others are accepted.
+	rsp := connectEnhanced(t, c, skt, 80, 0x0050, 0x0010, 0x0051)
+	if want := []uint16{100, 102, cocCredits, uint16(ErrL2CAPInvalidSourceCID)}; !reflect.DeepEqual(rsp[:4], want) {
+		t.Errorf("MTU, MPS, credits and result %v, want %v", rsp[:4], want)
+	}
+	dcids := rsp[4:]
+	if len(dcids) != 3 || dcids[0] == 0 || dcids[1] != 0 || dcids[2] == 0 {
+		t.Fatalf("destination CIDs %v, want the 2nd one refused", dcids)
+	}
+	for i := 0; i < 2; i++ {
+		ch, err := l.Accept()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ch.TxMTU() != 80 || ch.RxMTU() != 100 {
+			t.Errorf("channel MTUs %d/%d, want 80/100", ch.TxMTU(), ch.RxMTU())
+		}
+	}
+
+	// The SPSM isn't listened.
+	c.chInPkt <- sigPacket(SignalCreditBasedConnectionRequest, 0x02, u16s(0x0028, 80, 80, 5, 0x0052)...)
+	if _, _, data := receiveSignal(t, skt); words(data)[3] != uint16(ErrL2CAPPSMNotSupported) {
+		t.Errorf("result 0x%04X, want SPSM not supported", words(data)[3])
+	}
+}
+
+func TestOpenEnhancedL2CAPChannels(t *testing.T) {
+	skt := make(chanSkt, 1)
+	c := newTestConn(skt)
+	defer close(c.chInPkt)
+
+	type result struct {
+		n   int
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		conns, err := c.OpenEnhancedL2CAPChannels(context.Background(), 0x0027, 100, 2)
+		if err == nil && conns[0].TxMTU() != 70 {
+			t.Errorf("channel TxMTU %d, want 70", conns[0].TxMTU())
+		}
+		done <- result{len(conns), err}
+	}()
+	code, id, data := receiveSignal(t, skt)
+	req := words(data)
+	if code != SignalCreditBasedConnectionRequest || len(req) != 6 || req[0] != 0x0027 || req[1] != 100 {
+		t.Fatalf("sent signal 0x%02X % X, want Credit Based Connection Request", code, data)
+	}
+
+	// The remote device accepts the first channel only.
+	c.chInPkt <- sigPacket(SignalCreditBasedConnectionResponse, id,
+		u16s(70, 70, 3, uint16(ErrL2CAPNoResources), 0x0060, 0x0000)...)
+	select {
+	case r := <-done:
+		if r.err != nil || r.n != 1 {
+			t.Errorf("OpenEnhancedL2CAPChannels() = %d channels, %v, want 1 channel", r.n, r.err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("OpenEnhancedL2CAPChannels() not returned")
+	}
+	if ch := c.remoteChannel(0x0060); ch == nil || ch.scid != req[4] {
+		t.Errorf("channel of the remote CID 0x0060 not connected")
+	}
+	if c.channel(req[5]) != nil {
+		t.Errorf("refused channel 0x%04X kept", req[5])
+	}
+}
+
+func TestCreditBasedReconfigureRequest(t *testing.T) {
+	skt := make(chanSkt, 1)
+	c := newTestConn(skt)
+	defer close(c.chInPkt)
+	if _, err := c.hci.ListenL2CAP(0x0027, 100); err != nil {
+		t.Fatal(err)
+	}
+	connectEnhanced(t, c, skt, 80, 0x0050, 0x0051)
+
+	tests := []struct {
+		name   string
+		req    []uint16
+		result uint16
+		mtu    int
+	}{
+		{"MTU decreased", []uint16{70, 80, 0x0050}, ecfcReconfigureMTUReduced, 80},
+		{"unknown CID", []uint16{90, 80, 0x0050, 0x0070}, ecfcReconfigureInvalidDCID, 80},
+		{"MPS decreased", []uint16{90, 70, 0x0050, 0x0051}, ecfcReconfigureMPSReduced, 80},
+		{"MTU too small", []uint16{60, 80, 0x0050}, ecfcReconfigureUnacceptable, 80},
+		{"MTU increased", []uint16{120, 80, 0x0050, 0x0051}, 0, 120},
+	}
+	for i, tt := range tests {
+		c.chInPkt <- sigPacket(SignalCreditBasedReconfigureRequest, byte(0x10+i), u16s(tt.req...)...)
+		code, _, data := receiveSignal(t, skt)
+		if code != SignalCreditBasedReconfigureResponse || len(data) != 2 {
+			t.Fatalf("%s: sent signal 0x%02X % X, want Credit Based Reconfigure Response", tt.name, code, data)
+		}
+		if r := binary.LittleEndian.Uint16(data); r != tt.result {
+			t.Errorf("%s: result 0x%04X, want 0x%04X", tt.name, r, tt.result)
+		}
+		if mtu := c.remoteChannel(0x0050).TxMTU(); mtu != tt.mtu {
+			t.Errorf("%s: channel TxMTU %d, want %d", tt.name, mtu, tt.mtu)
+		}
+	}
+}
@@ -1,6 +1,9 @@
 package hci
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+)
 
 // errors
 var (
@@ -9,6 +12,10 @@ var (
 	ErrBusyDialing     = errors.New("busy dialing")
 	ErrBusyListening   = errors.New("busy listening")
 	ErrInvalidAddr     = errors.New("invalid address")
+
+	// ErrSMPTimeout means a SMP procedure hasn't been completed in 30 seconds.
+	// No further SMP procedure can be performed on the same link. [Vol 3, Part H, 3.4]
+	ErrSMPTimeout = errors.New("smp timeout")
 )
 
 // HCI Command Errors  [Vol2, Part D, 1.3 ]
@@ -159,3 +166,86 @@ var errCmd = map[ErrCommand]string{
 	0x3F: "MAC Connection Failed",
 	0x40: "Coarse Clock Adjustment Rejected but Will Try to Adjust Using Clock Dragging",
 }
+
+// Pairing Failed reason codes [Vol 3, Part H, 3.5.5].
+const (
+	ErrSMPPasskeyEntryFailed          ErrSMP = 0x01 // Passkey Entry Failed
+	ErrSMPOOBNotAvailable             ErrSMP = 0x02 // OOB Not Available
+	ErrSMPAuthenticationRequirements  ErrSMP = 0x03 // Authentication Requirements
+	ErrSMPConfirmValueFailed          ErrSMP = 0x04 // Confirm Value Failed
+	ErrSMPPairingNotSupported         ErrSMP = 0x05 // Pairing Not Supported
+	ErrSMPEncryptionKeySize           ErrSMP = 0x06 // Encryption Key Size
+	ErrSMPCommandNotSupported         ErrSMP = 0x07 // Command Not Supported
+	ErrSMPUnspecifiedReason           ErrSMP = 0x08 // Unspecified Reason
+	ErrSMPRepeatedAttempts            ErrSMP = 0x09 // Repeated Attempts
+	ErrSMPInvalidParameters           ErrSMP = 0x0A // Invalid Parameters
+	ErrSMPDHKeyCheckFailed            ErrSMP = 0x0B // DHKey Check Failed
+	ErrSMPNumericComparisonFailed     ErrSMP = 0x0C // Numeric Comparison Failed
+	ErrSMPBREDRPairingInProgress      ErrSMP = 0x0D // BR/EDR pairing in progress
+	ErrSMPCrossTransportKeyNotAllowed ErrSMP = 0x0E // Cross-transport Key Derivation/Generation not allowed
+)
+
+// ErrSMP is the reason of a failed pairing [Vol 3, Part H, 3.5.5].
+type ErrSMP byte
+
+func (e ErrSMP) Error() string {
+	if s, ok := errSMP[e]; ok {
+		return "pairing failed: " + s
+	}
+	return fmt.Sprintf("pairing failed: reserved reason (0x%02X)", byte(e))
+}
+
+var errSMP = map[ErrSMP]string{
+	0x01: "Passkey Entry Failed",
+	0x02: "OOB Not Available",
+	0x03: "Authentication Requirements",
+	0x04: "Confirm Value Failed",
+	0x05: "Pairing Not Supported",
+	0x06: "Encryption Key Size",
+	0x07: "Command Not Supported",
+	0x08: "Unspecified Reason",
+	0x09: "Repeated Attempts",
+	0x0A: "Invalid Parameters",
+	0x0B: "DHKey Check Failed",
+	0x0C: "Numeric Comparison Failed",
+	0x0D: "BR/EDR pairing in progress",
+	0x0E: "Cross-transport Key Derivation/Generation not allowed",
+}
+
+// LE Credit Based Connection Response and Credit Based Connection Response
+// result codes [Vol 3, Part A, 4.23, 4.26].
+const (
+	ErrL2CAPPSMNotSupported        ErrL2CAP = 0x0002 // LE_PSM not supported
+	ErrL2CAPNoResources            ErrL2CAP = 0x0004 // No resources available
+	ErrL2CAPAuthentication         ErrL2CAP = 0x0005 // Insufficient Authentication
+	ErrL2CAPAuthorization          ErrL2CAP = 0x0006 // Insufficient Authorization
+	ErrL2CAPEncryptionKeySize      ErrL2CAP = 0x0007 // Insufficient Encryption Key Size
+	ErrL2CAPEncryption             ErrL2CAP = 0x0008 // Insufficient Encryption
+	ErrL2CAPInvalidSourceCID       ErrL2CAP = 0x0009 // Invalid Source CID
+	ErrL2CAPSourceCIDAllocated     ErrL2CAP = 0x000A // Source CID already allocated
+	ErrL2CAPUnacceptableParameters ErrL2CAP = 0x000B // Unacceptable parameters
+	ErrL2CAPInvalidParameters      ErrL2CAP = 0x000C // Invalid parameters
+)
+
+// ErrL2CAP is the reason of a refused L2CAP channel connection [Vol 3, Part A, 4.23].
+type ErrL2CAP uint16
+
+func (e ErrL2CAP) Error() string {
+	if s, ok := errL2CAP[e]; ok {
+		return "connection refused: " + s
+	}
+	return fmt.Sprintf("connection refused: reserved result (0x%04X)", uint16(e))
+}
+
+var errL2CAP = map[ErrL2CAP]string{
+	0x0002: "LE_PSM not supported",
+	0x0004: "No resources available",
+	0x0005: "Insufficient Authentication",
+	0x0006: "Insufficient Authorization",
+	0x0007: "Insufficient Encryption Key Size",
+	0x0008: "Insufficient Encryption",
+	0x0009: "Invalid Source CID",
+	0x000A: "Source CID already allocated",
+	0x000B: "Unacceptable parameters",
+	0x000C: "Invalid parameters",
+}
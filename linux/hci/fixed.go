@@ -0,0 +1,80 @@
+package hci
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// A FixedChannelHandler handles the B-frames received on an L2CAP fixed
+// channel [Vol 3, Part A, 2.1]. It's called with the information payload by
+// the goroutine which recombines the PDUs of the connection, and shouldn't
+// block. It may send on the channel with WriteFixedChannel.
+type FixedChannelHandler func(c *Conn, b []byte)
+
+// HandleFixedChannel registers the handler for the fixed CID on the
+// connections established afterwards. A nil handler unregisters it.
+func (h *HCI) HandleFixedChannel(cid uint16, f FixedChannelHandler) error {
+	if cid < cidFixedFirst || cid > cidFixedLast {
+		return fmt.Errorf("invalid fixed CID 0x%04X", cid)
+	}
+	h.muL2CAP.Lock()
+	defer h.muL2CAP.Unlock()
+	if f == nil {
+		delete(h.fixed, cid)
+		return nil
+	}
+	h.fixed[cid] = f
+	return nil
+}
+
+func (h *HCI) fixedHandlers() map[uint16]FixedChannelHandler {
+	h.muL2CAP.Lock()
+	defer h.muL2CAP.Unlock()
+	m := make(map[uint16]FixedChannelHandler, len(h.fixed))
+	for cid, f := range h.fixed {
+		m[cid] = f
+	}
+	return m
+}
+
+// HandleFixedChannel registers the handler for the fixed CID on the connection.
+// It replaces the existing handler, including the ones of ATT, the signaling
+// channel, and SMP, which are registered by default. A nil handler unregisters
+// it, and the PDUs received on the channel are discarded.
+func (c *Conn) HandleFixedChannel(cid uint16, f FixedChannelHandler) error {
+	if cid < cidFixedFirst || cid > cidFixedLast {
+		return fmt.Errorf("invalid fixed CID 0x%04X", cid)
+	}
+	c.muFixed.Lock()
+	defer c.muFixed.Unlock()
+	if f == nil {
+		delete(c.fixed, cid)
+		return nil
+	}
+	c.fixed[cid] = func(p pdu) { f(c, p.payload()) }
+	return nil
+}
+
+func (c *Conn) fixedHandler(cid uint16) func(pdu) {
+	c.muFixed.Lock()
+	defer c.muFixed.Unlock()
+	return c.fixed[cid]
+}
+
+// WriteFixedChannel sends b as a B-frame on the fixed CID [Vol 3, Part A, 3.1].
+func (c *Conn) WriteFixedChannel(cid uint16, b []byte) (int, error) {
+	if cid < cidFixedFirst || cid > cidFixedLast {
+		return 0, fmt.Errorf("invalid fixed CID 0x%04X", cid)
+	}
+	if len(b) > 0xFFFF {
+		return 0, fmt.Errorf("payload size (%d) too large", len(b))
+	}
+	p := make([]byte, 4+len(b))
+	binary.LittleEndian.PutUint16(p[0:2], uint16(len(b)))
+	binary.LittleEndian.PutUint16(p[2:4], cid)
+	copy(p[4:], b)
+	if _, err := c.writePDU(p); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
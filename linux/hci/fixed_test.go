@@ -0,0 +1,55 @@
+package hci
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/runtimeco/ble/linux/hci/evt"
+)
+
+type fakeSkt struct{ bytes.Buffer }
+
+func (s *fakeSkt) Close() error { return nil }
+
+func TestFixedChannel(t *testing.T) {
+	skt := &fakeSkt{}
+	h := &HCI{
+		skt:     skt,
+		pool:    NewPool(64, 4),
+		muL2CAP: &sync.Mutex{},
+		fixed:   make(map[uint16]FixedChannelHandler),
+	}
+	param := make(evt.LEConnectionComplete, 19)
+	param[2] = 0x40 // Connection handle 0x0040.
+
+	got := make(chan []byte, 1)
+	if err := h.HandleFixedChannel(0x3F, func(c *Conn, b []byte) { got <- b }); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.HandleFixedChannel(0x40, func(c *Conn, b []byte) {}); err == nil {
+		t.Error("registered a dynamic CID")
+	}
+	c := newConn(h, param)
+
+	// ACL packet: handle, length, and the B-frame on CID 0x003F.
+	c.chInPkt <- packet{0x40, 0x20, 0x07, 0x00, 0x03, 0x00, 0x3F, 0x00, 0x01, 0x02, 0x03}
+	select {
+	case b := <-got:
+		if !bytes.Equal(b, []byte{0x01, 0x02, 0x03}) {
+			t.Errorf("received % X, want 01 02 03", b)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("handler not called")
+	}
+
+	if _, err := c.WriteFixedChannel(0x3F, []byte{0x04, 0x05}); err != nil {
+		t.Fatal(err)
+	}
+	want := []byte{pktTypeACLData, 0x40, 0x00, 0x06, 0x00, 0x02, 0x00, 0x3F, 0x00, 0x04, 0x05}
+	if !bytes.Equal(skt.Bytes(), want) {
+		t.Errorf("sent % X, want % X", skt.Bytes(), want)
+	}
+	close(c.chInPkt)
+}
@@ -218,7 +218,7 @@ func (h *HCI) Dial(ctx context.Context, a ble.Addr) (ble.Client, error) {
 	case <-h.done:
 		return nil, h.err
 	case c := <-h.chMasterConn:
-		return gatt.NewClient(c)
+		return h.newClient(c)
 
 	}
 }
@@ -233,11 +233,23 @@ func (h *HCI) cancelDial() (ble.Client, error) {
 	// The connection has been established, the cancel command
 	// failed with ErrDisallowed.
 	if err == ErrDisallowed {
-		return gatt.NewClient(<-h.chMasterConn)
+		return h.newClient(<-h.chMasterConn)
 	}
 	return nil, errors.Wrap(err, "cancel connection failed")
 }
 
+// newClient returns a GATT client of the master connection.
+func (h *HCI) newClient(c *Conn) (ble.Client, error) {
+	cln, err := gatt.NewClient(c)
+	if err != nil {
+		return nil, err
+	}
+	if h.attTimeout > 0 {
+		cln.SetTransactionTimeout(h.attTimeout)
+	}
+	return cln, nil
+}
+
 // Advertise starts advertising.
 func (h *HCI) Advertise() error {
 	h.params.advEnable.AdvertisingEnable = 1
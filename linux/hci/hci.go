@@ -53,9 +53,22 @@ func NewHCI(opts ...ble.Option) (*HCI, error) {
 		chMasterConn: make(chan *Conn),
 		chSlaveConn:  make(chan *Conn),
 
+		muSMP: &sync.Mutex{},
+		oob:   make(map[string][]byte),
+
+		muL2CAP:   &sync.Mutex{},
+		listeners: make(map[uint16]*L2CAPListener),
+		fixed:     make(map[uint16]FixedChannelHandler),
+
 		done: make(chan bool),
 	}
 	h.params.init()
+	h.smpConfig.init()
+	irk, err := random(16)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't generate irk")
+	}
+	h.irk = irk
 	if err := h.Option(opts...); err != nil {
 		return nil, errors.Wrap(err, "can't set options")
 	}
@@ -111,6 +124,29 @@ type HCI struct {
 	chMasterConn chan *Conn // Dial returns master connections.
 	chSlaveConn  chan *Conn // Peripheral accept slave connections.
 
+	// Security Manager
+	smpConfig smpConfig
+	irk       []byte // Identity Resolving Key of the local device.
+	muSMP     *sync.Mutex
+	oob       map[string][]byte // OOB data (TK) for legacy pairing, keyed by the peer address.
+	bonds     ble.BondStore
+	agent     ble.Agent
+	secReq    bool
+
+	// L2CAP LE credit based connection-oriented channels
+	muL2CAP   *sync.Mutex
+	listeners map[uint16]*L2CAPListener // keyed by LE_PSM.
+	fixed     map[uint16]FixedChannelHandler
+
+	// ATT server
+	prepQueueSize   int
+	notifyQueueSize int
+	notifyPolicy    ble.NotifyQueuePolicy
+	attTimeout      time.Duration
+	authorizer      ble.Authorizer
+	rspTimeout      time.Duration
+	eatt            bool
+
 	connectedHandler    func(evt.LEConnectionComplete)
 	disconnectedHandler func(evt.DisconnectionComplete)
 
@@ -128,16 +164,16 @@ func (h *HCI) Init() error {
 	h.evth[evt.CommandStatusCode] = h.handleCommandStatus
 	h.evth[evt.DisconnectionCompleteCode] = h.handleDisconnectionComplete
 	h.evth[evt.NumberOfCompletedPacketsCode] = h.handleNumberOfCompletedPackets
+	h.evth[evt.EncryptionChangeCode] = h.handleEncryptionChange
+	h.evth[evt.EncryptionKeyRefreshCompleteCode] = h.handleEncryptionKeyRefreshComplete
 
 	h.subh[evt.LEAdvertisingReportSubCode] = h.handleLEAdvertisingReport
 	h.subh[evt.LEConnectionCompleteSubCode] = h.handleLEConnectionComplete
 	h.subh[evt.LEConnectionUpdateCompleteSubCode] = h.handleLEConnectionUpdateComplete
 	h.subh[evt.LELongTermKeyRequestSubCode] = h.handleLELongTermKeyRequest
-	// evt.EncryptionChangeCode:                     todo),
 	// evt.ReadRemoteVersionInformationCompleteCode: todo),
 	// evt.HardwareErrorCode:                        todo),
 	// evt.DataBufferOverflowCode:                   todo),
-	// evt.EncryptionKeyRefreshCompleteCode:         todo),
 	// evt.AuthenticatedPayloadTimeoutExpiredCode:   todo),
 	// evt.LEReadRemoteUsedFeaturesCompleteSubCode:   todo),
 	// evt.LERemoteConnectionParameterRequestSubCode: todo),
@@ -183,6 +219,49 @@ func (h *HCI) Option(opts ...ble.Option) error {
 	return err
 }
 
+// BondStore returns the store of the bonded devices, or nil if it's not set
+// by OptBondStore.
+func (h *HCI) BondStore() ble.BondStore {
+	return h.bonds
+}
+
+// PrepareQueueSize returns the number of the prepared writes the ATT server
+// queues for each connection, or 0 if it's not set by OptPrepareQueueSize.
+func (h *HCI) PrepareQueueSize() int {
+	return h.prepQueueSize
+}
+
+// NotifyQueue returns the number of the notifications the ATT server queues
+// for each connection, or 0 if it's not set by OptNotifyQueue, and what to do
+// when the queue is full.
+func (h *HCI) NotifyQueue() (int, ble.NotifyQueuePolicy) {
+	return h.notifyQueueSize, h.notifyPolicy
+}
+
+// TransactionTimeout returns how long the ATT client and server wait for a
+// response or a confirmation, or 0 if it's not set by OptTransactionTimeout.
+func (h *HCI) TransactionTimeout() time.Duration {
+	return h.attTimeout
+}
+
+// Authorizer returns the authorizer of the accesses to the attributes of the
+// ATT server, or nil if it's not set by OptAuthorizer.
+func (h *HCI) Authorizer() ble.Authorizer {
+	return h.authorizer
+}
+
+// ResponseTimeout returns how long the ATT server waits for a handler to
+// complete a deferred response, or 0 if it's not set by OptResponseTimeout.
+func (h *HCI) ResponseTimeout() time.Duration {
+	return h.rspTimeout
+}
+
+// EATT reports whether the device serves the Enhanced ATT bearers, which is
+// set by OptEATT.
+func (h *HCI) EATT() bool {
+	return h.eatt
+}
+
 func (h *HCI) init() error {
 	h.Send(&cmd.Reset{}, nil)
 
@@ -479,6 +558,10 @@ func (h *HCI) handleLEConnectionComplete(b []byte) error {
 	h.muConns.Unlock()
 	if e.Role() == roleMaster {
 		if e.Status() == 0x00 {
+			// Encrypt the link if the remote device is bonded.
+			if h.bonds != nil {
+				go c.smp.resume()
+			}
 			select {
 			case h.chMasterConn <- c:
 			default:
@@ -529,6 +612,8 @@ func (h *HCI) handleDisconnectionComplete(b []byte) error {
 		return fmt.Errorf("disconnecting an invalid handle %04X", e.ConnectionHandle())
 	}
 	close(c.chInPkt)
+	c.smp.disconnected()
+	c.closeChannels()
 
 	if c.param.Role() == roleSlave {
 		// Re-enable advertising, if it was advertising. Refer to the
@@ -577,11 +662,55 @@ func (h *HCI) handleNumberOfCompletedPackets(b []byte) error {
 	return nil
 }
 
+func (h *HCI) handleEncryptionChange(b []byte) error {
+	e := evt.EncryptionChange(b)
+	h.muConns.Lock()
+	c, found := h.conns[e.ConnectionHandle()]
+	h.muConns.Unlock()
+	if !found {
+		return nil
+	}
+	c.smp.encryptionChanged(e.Status(), e.EncryptionEnabled() != 0x00)
+	return nil
+}
+
+func (h *HCI) handleEncryptionKeyRefreshComplete(b []byte) error {
+	e := evt.EncryptionKeyRefreshComplete(b)
+	h.muConns.Lock()
+	c, found := h.conns[e.ConnectionHandle()]
+	h.muConns.Unlock()
+	if !found {
+		return nil
+	}
+	c.smp.encryptionChanged(e.Status(), e.Status() == 0x00)
+	return nil
+}
+
 func (h *HCI) handleLELongTermKeyRequest(b []byte) error {
 	e := evt.LELongTermKeyRequest(b)
-	return h.Send(&cmd.LELongTermKeyRequestNegativeReply{
-		ConnectionHandle: e.ConnectionHandle(),
-	}, nil)
+	h.muConns.Lock()
+	c, found := h.conns[e.ConnectionHandle()]
+	h.muConns.Unlock()
+
+	// The reply can't be sent synchronously, since the command complete
+	// event is handled in the same goroutine as this handler. The LTK may
+	// also be loaded from the bond store.
+	go func() {
+		var ltk []byte
+		if found {
+			ltk = c.smp.ltk(e.EncryptionDiversifier(), e.RandomNumber())
+		}
+		if ltk == nil {
+			h.Send(&cmd.LELongTermKeyRequestNegativeReply{
+				ConnectionHandle: e.ConnectionHandle(),
+			}, nil)
+			return
+		}
+		r := &cmd.LELongTermKeyRequestReply{ConnectionHandle: e.ConnectionHandle()}
+		copy(r.LongTermKey[:], ltk)
+		h.Send(r, nil)
+	}()
+	return nil
 }
 
 func (h *HCI) setAllowedCommands(n int) {
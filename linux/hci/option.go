@@ -2,9 +2,11 @@ package hci
 
 import (
 	"errors"
+	"fmt"
 	"github.com/runtimeco/ble/linux/hci/evt"
 	"time"
 
+	"github.com/runtimeco/ble"
 	"github.com/runtimeco/ble/linux/hci/cmd"
 )
 
@@ -65,3 +67,107 @@ func (h *HCI) SetPeripheralRole() error {
 func (h *HCI) SetCentralRole() error {
 	return errors.New("Not supported")
 }
+
+// SetBondStore sets the store which keeps the keys of bonded devices.
+func (h *HCI) SetBondStore(s ble.BondStore) error {
+	h.bonds = s
+	return nil
+}
+
+// SetIRK sets the Identity Resolving Key of the device.
+func (h *HCI) SetIRK(irk []byte) error {
+	if len(irk) != 16 {
+		return fmt.Errorf("invalid IRK length %d", len(irk))
+	}
+	h.irk = append([]byte(nil), irk...)
+	return nil
+}
+
+// SetIOCapability sets the input and output capabilities of the device used in pairing.
+func (h *HCI) SetIOCapability(c ble.IOCapability) error {
+	if c > ble.IOCapKeyboardDisplay {
+		return fmt.Errorf("invalid IO capability 0x%02X", uint8(c))
+	}
+	h.smpConfig.ioCap = uint8(c)
+	return nil
+}
+
+// SetAuthRequirements sets whether the device bonds with the remote devices,
+// and whether it requires MITM protection in pairing.
+func (h *HCI) SetAuthRequirements(bonding, mitm bool) error {
+	h.smpConfig.authReq = authReqSC
+	if bonding {
+		h.smpConfig.authReq |= authReqBonding
+	}
+	if mitm {
+		h.smpConfig.authReq |= authReqMITM
+	}
+	return nil
+}
+
+// SetAgent sets the agent, which interacts with the user during pairing.
+func (h *HCI) SetAgent(a ble.Agent) error {
+	h.agent = a
+	return nil
+}
+
+// SetSecurityRequest sets whether the device, as a slave, sends a Security
+// Request when the ATT server rejects a request for insufficient security.
+func (h *HCI) SetSecurityRequest(enable bool) error {
+	h.secReq = enable
+	return nil
+}
+
+// SetPrepareQueueSize sets the number of the prepared writes the ATT server
+// queues for each connection.
+func (h *HCI) SetPrepareQueueSize(n int) error {
+	if n < 1 {
+		return fmt.Errorf("invalid prepare queue size %d", n)
+	}
+	h.prepQueueSize = n
+	return nil
+}
+
+// SetNotifyQueue sets the number of the notifications the ATT server queues
+// for each connection, and what to do when the queue is full.
+func (h *HCI) SetNotifyQueue(n int, policy ble.NotifyQueuePolicy) error {
+	if n < 1 {
+		return fmt.Errorf("invalid notification queue size %d", n)
+	}
+	h.notifyQueueSize = n
+	h.notifyPolicy = policy
+	return nil
+}
+
+// SetTransactionTimeout sets how long the ATT client and server wait for a
+// response or a confirmation.
+func (h *HCI) SetTransactionTimeout(d time.Duration) error {
+	if d <= 0 {
+		return fmt.Errorf("invalid transaction timeout %s", d)
+	}
+	h.attTimeout = d
+	return nil
+}
+
+// SetAuthorizer sets the authorizer of the accesses to the attributes of the
+// ATT server.
+func (h *HCI) SetAuthorizer(a ble.Authorizer) error {
+	h.authorizer = a
+	return nil
+}
+
+// SetResponseTimeout sets how long the ATT server waits for a handler to
+// complete a deferred response.
+func (h *HCI) SetResponseTimeout(d time.Duration) error {
+	if d <= 0 {
+		return fmt.Errorf("invalid response timeout %s", d)
+	}
+	h.rspTimeout = d
+	return nil
+}
+
+// SetEATT sets whether the device serves the Enhanced ATT bearers.
+func (h *HCI) SetEATT(enable bool) error {
+	h.eatt = enable
+	return nil
+}
@@ -0,0 +1,50 @@
+package hci
+
+import (
+	"crypto/subtle"
+	"encoding/binary"
+	"math"
+
+	"github.com/runtimeco/ble"
+)
+
+// Sign signs m with the CSRK distributed by the local device, and the next
+// sign counter, which is saved with the bond [Vol 3, Part H, 2.4.5]. Once the
+// sign counter is exhausted, the devices must pair again.
+func (c *Conn) Sign(m []byte) ([12]byte, error) {
+	s := c.smp
+	s.Lock()
+	defer s.Unlock()
+	b := s.loadBond()
+	if b == nil || len(b.LocalCSRK) != 16 || b.LocalSignCounter == math.MaxUint32 {
+		return [12]byte{}, ble.ErrNoSigningKey
+	}
+	sig := sign(b.LocalCSRK, m, b.LocalSignCounter)
+	b.LocalSignCounter++
+	if err := c.hci.bonds.Save(b); err != nil {
+		return [12]byte{}, err
+	}
+	return sig, nil
+}
+
+// Verify verifies the signature of m with the CSRK distributed by the remote
+// device. The sign counter must be greater than the ones previously received,
+// and is saved with the bond [Vol 3, Part H, 2.4.5]. The last sign counter
+// isn't accepted, since the next one would wrap around, and make the previous
+// signatures valid again.
+func (c *Conn) Verify(m []byte, sig [12]byte) error {
+	s := c.smp
+	s.Lock()
+	defer s.Unlock()
+	b := s.loadBond()
+	if b == nil || len(b.PeerCSRK) != 16 {
+		return ble.ErrNoSigningKey
+	}
+	cnt := binary.LittleEndian.Uint32(sig[:4])
+	want := sign(b.PeerCSRK, m, cnt)
+	if cnt < b.PeerSignCounter || cnt == math.MaxUint32 || subtle.ConstantTimeCompare(want[:], sig[:]) != 1 {
+		return ble.ErrBadSignature
+	}
+	b.PeerSignCounter = cnt + 1
+	return c.hci.bonds.Save(b)
+}
@@ -0,0 +1,78 @@
+package hci
+
+import (
+	"math"
+	"testing"
+
+	"github.com/runtimeco/ble"
+)
+
+// memBonds is a BondStore, which discards the bonds saved.
+type memBonds struct{}
+
+func (s memBonds) Load(a ble.Addr) (*ble.Bond, error) { return nil, ble.ErrBondNotFound }
+func (s memBonds) Save(b *ble.Bond) error             { return nil }
+func (s memBonds) Delete(a ble.Addr) error            { return nil }
+func (s memBonds) List() ([]*ble.Bond, error)         { return nil, nil }
+
+// newSigningConn returns a connection bonded with a device, which has
+// distributed the same CSRK as the local device.
+func newSigningConn() (*Conn, *ble.Bond) {
+	c := newTestConn(make(chanSkt, 1))
+	c.hci.bonds = memBonds{}
+	csrk := []byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0A, 0x0B, 0x0C, 0x0D, 0x0E, 0x0F, 0x10}
+	b := &ble.Bond{LocalCSRK: csrk, PeerCSRK: csrk}
+	c.smp.bond, c.smp.bondLoaded = b, true
+	return c, b
+}
+
+func TestSignVerify(t *testing.T) {
+	c, b := newSigningConn()
+	defer close(c.chInPkt)
+	m := []byte{0xD2, 0x03, 0x00, 0x01, 0x02}
+
+	sig0, err := c.Sign(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig1, err := c.Sign(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.LocalSignCounter != 2 {
+		t.Errorf("local sign counter %d, want 2", b.LocalSignCounter)
+	}
+	if err := c.Verify(m, sig1); err != nil {
+		t.Errorf("Verify() = %v", err)
+	}
+	if b.PeerSignCounter != 2 {
+		t.Errorf("peer sign counter %d, want 2", b.PeerSignCounter)
+	}
+
+	tampered := sig1
+	tampered[11] ^= 0x01
+	tests := []struct {
+		name string
+		m    []byte
+		sig  [12]byte
+	}{
+		{"replayed counter", m, sig1},
+		{"lower counter", m, sig0},
+		{"tampered MAC", m, tampered},
+		{"tampered data", []byte{0xD2, 0x03, 0x00, 0x01, 0x03}, sig1},
+		{"last counter", m, sign(b.PeerCSRK, m, math.MaxUint32)},
+	}
+	for _, tt := range tests {
+		if err := c.Verify(tt.m, tt.sig); err != ble.ErrBadSignature {
+			t.Errorf("%s: Verify() = %v, want %v", tt.name, err, ble.ErrBadSignature)
+		}
+	}
+	if b.PeerSignCounter != 2 {
+		t.Errorf("peer sign counter %d after the rejected signatures, want 2", b.PeerSignCounter)
+	}
+
+	b.LocalSignCounter = math.MaxUint32
+	if _, err := c.Sign(m); err != ble.ErrNoSigningKey {
+		t.Errorf("Sign() with the exhausted counter = %v, want %v", err, ble.ErrNoSigningKey)
+	}
+}
@@ -2,9 +2,12 @@ package hci
 
 import (
 	"bytes"
+	"context"
 	"encoding/binary"
 	"errors"
 	"fmt"
+	"io"
+	"sync/atomic"
 	"time"
 
 	"github.com/runtimeco/ble/linux/hci/cmd"
@@ -26,55 +29,107 @@ func (s sigCmd) data() []byte { return s[4 : 4+s.len()] }
 
 // Signal ...
 func (c *Conn) Signal(req Signal, rsp Signal) error {
+	return c.signal(context.Background(), req, rsp)
+}
+
+// errSignalTimeout means the remote device hasn't responded a signaling request.
+var errSignalTimeout = errors.New("signaling request timed out")
+
+// signal sends the request, and waits for the response until the request
+// times out or ctx is done.
+func (c *Conn) signal(ctx context.Context, req Signal, rsp Signal) error {
+	_, err := c.signalID(ctx, req, rsp)
+	return err
+}
+
+// signalID is signal, which also returns the identifier of the request.
+func (c *Conn) signalID(ctx context.Context, req Signal, rsp Signal) (id uint8, err error) {
 	data, err := req.Marshal()
 	if err != nil {
-		return err
+		return 0, err
 	}
 	buf := bytes.NewBuffer(make([]byte, 0))
 	if err := binary.Write(buf, binary.LittleEndian, uint16(4+len(data))); err != nil {
-		return err
+		return id, err
 	}
 	if err := binary.Write(buf, binary.LittleEndian, cidLESignal); err != nil {
-		return err
+		return id, err
 	}
 
 	if err := binary.Write(buf, binary.LittleEndian, uint8(req.Code())); err != nil {
-		return err
+		return id, err
 	}
-	if err := binary.Write(buf, binary.LittleEndian, uint8(c.sigID)); err != nil {
-		return err
+	c.sigMu.Lock()
+	defer c.sigMu.Unlock()
+	id = c.nextSigID()
+	c.muChans.Lock()
+	delete(c.abandoned, id)
+	c.muChans.Unlock()
+	if err := binary.Write(buf, binary.LittleEndian, id); err != nil {
+		return id, err
 	}
 	if err := binary.Write(buf, binary.LittleEndian, uint16(len(data))); err != nil {
-		return err
+		return id, err
 	}
 	if err := binary.Write(buf, binary.LittleEndian, data); err != nil {
-		return err
+		return id, err
 	}
 
-	c.sigSent = make(chan []byte)
-	defer close(c.sigSent)
+	// Discard the responses arrived after the previous requests timed out.
+	for len(c.sigSent) > 0 {
+		<-c.sigSent
+	}
+	atomic.StoreUint32(&c.sigPending, uint32(id))
+	defer atomic.StoreUint32(&c.sigPending, 0)
 	if _, err := c.writePDU(buf.Bytes()); err != nil {
-		return err
+		return id, err
 	}
 	var s sigCmd
 	select {
 	case s = <-c.sigSent:
 	case <-time.After(time.Second):
 		// TODO: Find the proper timed out defined in spec, if any.
-		return errors.New("signaling request timed out")
+		return id, errSignalTimeout
+	case <-ctx.Done():
+		return id, ctx.Err()
 	}
 
-	if s.code() != req.Code() {
-		return errors.New("mismatched signaling response")
+	if s.id() != id {
+		return id, errors.New("mismatched signaling id")
 	}
-	if s.id() != c.sigID {
-		return errors.New("mismatched signaling id")
+	if s.code() == SignalCommandReject {
+		return id, errors.New("signaling request rejected")
 	}
-	c.sigID++
 	if rsp == nil {
-		return nil
+		return id, nil
+	}
+	if s.code() != rsp.Code() {
+		return id, errors.New("mismatched signaling response")
 	}
-	return rsp.Unmarshal(s.data())
+	return id, rsp.Unmarshal(s.data())
+}
+
+// nextSigID returns the identifier for the next signaling command, which is never zero.
+func (c *Conn) nextSigID() uint8 {
+	for {
+		if id := uint8(atomic.AddUint32(&c.sigID, 1)); id != 0 {
+			return id
+		}
+	}
+}
+
+// pendingResponse passes the command to the pending signaling request, if it
+// has the identifier of the request. It reports whether the command is taken.
+func (c *Conn) pendingResponse(s sigCmd) bool {
+	id := uint32(s.id())
+	if id == 0 || !atomic.CompareAndSwapUint32(&c.sigPending, id, 0) {
+		return false
+	}
+	select {
+	case c.sigSent <- s:
+	default:
+	}
+	return true
 }
 
 func (c *Conn) sendResponse(code uint8, id uint8, r Signal) (int, error) {
@@ -135,17 +190,23 @@ func (c *Conn) handleSignal(p pdu) error {
 		case SignalConnectionParameterUpdateRequest:
 			c.handleConnectionParameterUpdateRequest(s)
 		case SignalLECreditBasedConnectionRequest:
-			c.LECreditBasedConnectionRequest(s)
+			c.handleLECreditBasedConnectionRequest(s)
 		case SignalLEFlowControlCredit:
-			c.LEFlowControlCredit(s)
+			c.handleLEFlowControlCredit(s)
+		case SignalCreditBasedConnectionRequest:
+			c.handleCreditBasedConnectionRequest(s)
+		case SignalCreditBasedReconfigureRequest:
+			c.handleCreditBasedReconfigureRequest(s)
 		default:
-			// Check if it's a response to a sent command.
-			select {
-			case c.sigSent <- s:
-				continue
-			default:
+			// Check if it's the response to the pending request.
+			if c.pendingResponse(s) || c.abandonedResponse(s) {
+				break
+			}
+			// A Command Reject isn't rejected, which the peer may send for
+			// the requests timed out.
+			if s.code() == SignalCommandReject {
+				break
 			}
-
 			c.sendResponse(
 				SignalCommandReject,
 				s.id(),
@@ -166,6 +227,23 @@ func (c *Conn) handleDisconnectRequest(s sigCmd) {
 		return
 	}
 
+	// Disconnect the LE credit based channel.
+	if ch := c.channel(req.DestinationCID); ch != nil {
+		// Silently discard the request if SCID failed to find the same match.
+		if req.SourceCID != ch.dcid {
+			return
+		}
+		c.sendResponse(
+			SignalDisconnectResponse,
+			s.id(),
+			&DisconnectResponse{
+				DestinationCID: req.DestinationCID,
+				SourceCID:      req.SourceCID,
+			})
+		ch.shutdown(io.EOF)
+		return
+	}
+
 	// Send Command Reject when the DCID is unrecognized.
 	if req.DestinationCID != cidLEAtt {
 		endpoints := make([]byte, 4)
@@ -243,12 +321,41 @@ func (c *Conn) handleConnectionParameterUpdateRequest(s sigCmd) {
 		})
 }
 
-// LECreditBasedConnectionRequest ...
-func (c *Conn) LECreditBasedConnectionRequest(s sigCmd) {
-	// TODO:
+// handleLECreditBasedConnectionRequest handles LE Credit Based Connection Request (0x14) [Vol 3, Part A, 4.22].
+func (c *Conn) handleLECreditBasedConnectionRequest(s sigCmd) {
+	var req LECreditBasedConnectionRequest
+	if err := req.Unmarshal(s.data()); err != nil {
+		return
+	}
+
+	ch, err := c.acceptChannel(&req)
+	rsp := &LECreditBasedConnectionResponse{}
+	if err != nil {
+		rsp.Result = uint16(err.(ErrL2CAP))
+	} else {
+		rsp.DestinationCID = ch.scid
+		rsp.MTU = uint16(ch.rxMTU)
+		rsp.MPS = uint16(ch.rxMPS)
+		rsp.InitialCreditsCID = uint16(ch.rxCredits)
+	}
+	if _, err := c.sendResponse(SignalLECreditBasedConnectionResponse, s.id(), rsp); err != nil {
+		_ = logger.Error("send repsonse", fmt.Sprintf("%v", err))
+	}
+
+	// The channel can't send K-frames until the response has been sent.
+	if ch != nil {
+		ch.addCredits(int(req.InitialCredits))
+	}
 }
 
-// LEFlowControlCredit ...
-func (c *Conn) LEFlowControlCredit(s sigCmd) {
-	// TODO:
+// handleLEFlowControlCredit handles LE Flow Control Credit (0x16) [Vol 3, Part A, 4.24].
+func (c *Conn) handleLEFlowControlCredit(s sigCmd) {
+	var f LEFlowControlCredit
+	if err := f.Unmarshal(s.data()); err != nil {
+		return
+	}
+	// The CID is the local CID of the remote device, which sends the credits.
+	if ch := c.remoteChannel(f.CID); ch != nil {
+		ch.addCredits(int(f.Credits))
+	}
 }
@@ -0,0 +1,112 @@
+package hci
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/runtimeco/ble/linux/hci/evt"
+)
+
+// chanSkt passes each packet written to a channel.
+type chanSkt chan []byte
+
+func (s chanSkt) Write(b []byte) (int, error) {
+	s <- append([]byte(nil), b...)
+	return len(b), nil
+}
+func (s chanSkt) Read(b []byte) (int, error) { return 0, nil }
+func (s chanSkt) Close() error               { return nil }
+
+// newTestConn returns the connection 0x0040 of an HCI on the socket. Since
+// the controller doesn't complete the packets, up to 16 can be sent.
+func newTestConn(skt chanSkt) *Conn {
+	h := &HCI{
+		skt:       skt,
+		pool:      NewPool(64, 16),
+		muL2CAP:   &sync.Mutex{},
+		fixed:     make(map[uint16]FixedChannelHandler),
+		listeners: make(map[uint16]*L2CAPListener),
+	}
+	param := make(evt.LEConnectionComplete, 19)
+	param[2] = 0x40 // Connection handle 0x0040.
+	return newConn(h, param)
+}
+
+// sigPacket returns the ACL packet of the signaling command received on the
+// connection 0x0040.
+func sigPacket(code, id byte, data ...byte) packet {
+	n := 4 + len(data)
+	p := packet{0x40, 0x20, byte(n + 4), byte((n + 4) >> 8), byte(n), byte(n >> 8), 0x05, 0x00,
+		code, id, byte(len(data)), byte(len(data) >> 8)}
+	return append(p, data...)
+}
+
+// receiveSignal returns the signaling command sent on the connection.
+func receiveSignal(t *testing.T, skt chanSkt) (code, id byte, data []byte) {
+	t.Helper()
+	select {
+	case b := <-skt:
+		return b[9], b[10], b[13:]
+	case <-time.After(time.Second):
+		t.Fatal("no signaling command sent")
+		return 0, 0, nil
+	}
+}
+
+func TestSignalUnexpectedResponse(t *testing.T) {
+	skt := make(chanSkt, 1)
+	c := newTestConn(skt)
+	defer close(c.chInPkt)
+
+	// A Connection Parameter Update Response with identifier 5, while no
+	// request is pending.
+	c.chInPkt <- packet{0x40, 0x20, 0x0A, 0x00, 0x06, 0x00, 0x05, 0x00, 0x13, 0x05, 0x02, 0x00, 0x00, 0x00}
+	select {
+	case b := <-skt:
+		want := []byte{pktTypeACLData, 0x40, 0x00, 0x0A, 0x00, 0x06, 0x00, 0x05, 0x00, 0x01, 0x05, 0x02, 0x00, 0x00, 0x00}
+		if !bytes.Equal(b, want) {
+			t.Errorf("sent % X, want Command Reject % X", b, want)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no Command Reject sent")
+	}
+	if len(c.sigSent) != 0 {
+		t.Error("unexpected response queued")
+	}
+}
+
+func TestOpenL2CAPChannelAbandoned(t *testing.T) {
+	skt := make(chanSkt, 1)
+	c := newTestConn(skt)
+	defer close(c.chInPkt)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	errc := make(chan error, 1)
+	go func() {
+		_, err := c.OpenL2CAPChannel(ctx, 0x80, 100)
+		errc <- err
+	}()
+	req := <-skt
+	if err := <-errc; err != context.DeadlineExceeded {
+		t.Fatalf("OpenL2CAPChannel() = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	// The remote device accepts the channel with DCID 0x0050 after all.
+	id := req[10]
+	c.chInPkt <- packet{0x40, 0x20, 0x0E, 0x00, 0x0A, 0x00, 0x05, 0x00,
+		0x15, id, 0x0A, 0x00, 0x50, 0x00, 0x64, 0x00, 0x64, 0x00, 0x01, 0x00, 0x00, 0x00}
+	select {
+	case b := <-skt:
+		// Disconnection Request with DCID 0x0050 and the SCID of the request.
+		want := []byte{0x06, b[10], 0x04, 0x00, 0x50, 0x00, req[15], req[16]}
+		if !bytes.Equal(b[9:], want) {
+			t.Errorf("sent % X, want Disconnection Request % X", b[9:], want)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no Disconnection Request sent")
+	}
+}
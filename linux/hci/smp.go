@@ -2,8 +2,20 @@ package hci
 
 import (
 	"bytes"
+	"context"
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/subtle"
 	"encoding/binary"
 	"fmt"
+	"io"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/runtimeco/ble"
+	"github.com/runtimeco/ble/linux/hci/cmd"
 )
 
 const (
@@ -23,9 +35,212 @@ const (
 	pairingKeypress          = 0x0E // Pairing Keypress Notification LE-U
 )
 
+// smpLen is the length of each SMP command, including the code [Vol 3, Part H, 3.5 & 3.6].
+var smpLen = map[byte]int{
+	pairingRequest:           7,
+	pairingResponse:          7,
+	pairingConfirm:           17,
+	pairingRandom:            17,
+	pairingFailed:            2,
+	encryptionInformation:    17,
+	masterIdentification:     11,
+	identiInformation:        17,
+	identityAddreInformation: 8,
+	signingInformation:       17,
+	securityRequest:          2,
+	pairingPublicKey:         65,
+	pairingDHKeyCheck:        17,
+	pairingKeypress:          2,
+}
+
+// IO Capability [Vol 3, Part H, 3.5.1].
+const (
+	ioDisplayOnly     = 0x00
+	ioDisplayYesNo    = 0x01
+	ioKeyboardOnly    = 0x02
+	ioNoInputNoOutput = 0x03
+	ioKeyboardDisplay = 0x04
+)
+
+// AuthReq flags [Vol 3, Part H, 3.5.1].
+const (
+	authReqBonding  = 0x01
+	authReqMITM     = 0x04
+	authReqSC       = 0x08
+	authReqKeypress = 0x10
+)
+
+// Key Distribution flags [Vol 3, Part H, 3.6.1].
+const (
+	keyDistEnc  = 0x01 // LTK, EDIV and Rand.
+	keyDistID   = 0x02 // IRK and the identity address.
+	keyDistSign = 0x04 // CSRK.
+)
+
+// The minimum encryption key size, in octets, we accept [Vol 3, Part H, 2.3.4].
+const minKeySize = 7
+
+// smpTimeout is the timeout of the Security Manager Timer [Vol 3, Part H, 3.4].
+const smpTimeout = 30 * time.Second
+
+// Pairing methods [Vol 3, Part H, 2.3.5.1].
+const (
+	justWorks        = iota
+	passkeyInitInput // Passkey Entry: initiator inputs, responder displays.
+	passkeyRespInput // Passkey Entry: responder inputs, initiator displays.
+	passkeyBothInput // Passkey Entry: initiator and responder inputs.
+	numericComparison
+	outOfBand
+)
+
+// legacyMethods maps the IO capabilities of the responder and the initiator
+// to the pairing method used by LE legacy pairing [Vol 3, Part H, 2.3.5.1].
+var legacyMethods = [5][5]int{
+	ioDisplayOnly:     {justWorks, justWorks, passkeyInitInput, justWorks, passkeyInitInput},
+	ioDisplayYesNo:    {justWorks, justWorks, passkeyInitInput, justWorks, passkeyInitInput},
+	ioKeyboardOnly:    {passkeyRespInput, passkeyRespInput, passkeyBothInput, justWorks, passkeyRespInput},
+	ioNoInputNoOutput: {justWorks, justWorks, justWorks, justWorks, justWorks},
+	ioKeyboardDisplay: {passkeyRespInput, passkeyRespInput, passkeyInitInput, justWorks, passkeyRespInput},
+}
+
+// scMethods maps the IO capabilities of the responder and the initiator to
+// the pairing method used by LE Secure Connections [Vol 3, Part H, 2.3.5.1].
+var scMethods = [5][5]int{
+	ioDisplayOnly:     {justWorks, justWorks, passkeyInitInput, justWorks, passkeyInitInput},
+	ioDisplayYesNo:    {justWorks, numericComparison, passkeyInitInput, justWorks, numericComparison},
+	ioKeyboardOnly:    {passkeyRespInput, passkeyRespInput, passkeyBothInput, justWorks, passkeyRespInput},
+	ioNoInputNoOutput: {justWorks, justWorks, justWorks, justWorks, justWorks},
+	ioKeyboardDisplay: {passkeyRespInput, numericComparison, passkeyInitInput, justWorks, numericComparison},
+}
+
+// smpConfig is the pairing features of the local device.
+type smpConfig struct {
+	ioCap       uint8
+	authReq     uint8
+	maxKeySize  uint8
+	initKeyDist uint8
+	respKeyDist uint8
+}
+
+func (c *smpConfig) init() {
+	c.ioCap = ioNoInputNoOutput
+	c.authReq = authReqBonding | authReqSC
+	c.maxKeySize = 16
+	c.initKeyDist = keyDistEnc | keyDistID | keyDistSign
+	c.respKeyDist = keyDistEnc | keyDistID | keyDistSign
+}
+
+// keys are the keys distributed in the key distribution phase [Vol 3, Part H, 3.6].
+type keys struct {
+	ltk  []byte
+	ediv uint16
+	rand uint64
+
+	irk      []byte
+	addrType uint8
+	addr     []byte // Identity address, least significant octet first.
+
+	csrk []byte
+}
+
+type smpState int
+
+const (
+	smpIdle               smpState = iota
+	smpWaitPairingRsp              // Pairing Request sent.
+	smpWaitTK                      // Features exchanged, the TK is not available yet.
+	smpWaitPublicKey               // Waiting for the Pairing Public Key of the remote device.
+	smpWaitConfirm                 // Waiting for the Pairing Confirm of the remote device.
+	smpWaitRandom                  // Waiting for the Pairing Random of the remote device.
+	smpWaitDHKeyCheck              // Waiting for the Pairing DHKey Check of the remote device.
+	smpWaitEncryption              // Waiting for the link to be encrypted with the STK.
+	smpWaitBondEncryption          // Waiting for the link to be encrypted with the LTK of the bond.
+	smpKeyDistribution             // Distributing keys over the encrypted link.
+)
+
+// smp implements the Security Manager Protocol of a connection [Vol 3, Part H].
+type smp struct {
+	sync.Mutex
+	c *Conn
+
+	state     smpState
+	initiator bool
+	timer     *time.Timer
+	timedOut  bool
+
+	// gen identifies the ongoing pairing, and is used to discard the
+	// user inputs which complete after the pairing has ended.
+	gen int
+
+	// done is closed when the ongoing pairing completes, and err reports the result.
+	done chan struct{}
+	err  error
+
+	// ctx is canceled when the ongoing pairing completes, and is passed to the agent.
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// requested is set if the ongoing pairing is requested by the local device.
+	requested bool
+
+	preq    []byte
+	pres    []byte
+	method  int
+	bonding bool
+	keySize int
+	sc      bool // LE Secure Connections is used.
+
+	tk    []byte
+	lrand []byte // Local random number.
+	lconf []byte // Local confirm value.
+	rrand []byte // Remote random number.
+	rconf []byte // Remote confirm value.
+	stk   []byte // STK, or LTK generated by LE Secure Connections.
+
+	// LE Secure Connections.
+	priv    *ecdh.PrivateKey
+	pka     []byte // Public key of the initiator.
+	pkb     []byte // Public key of the responder.
+	dhkey   []byte
+	passkey uint32
+	hasPK   bool   // The passkey has been displayed or entered.
+	round   int    // Passkey Entry round, 0 to 19.
+	rcheck  []byte // Pending DHKey check value of the initiator.
+	macKey  []byte
+
+	// Keys remain to be distributed by the local and remote device.
+	localDist  uint8
+	remoteDist uint8
+	local      keys
+	peer       keys
+
+	// The bond with the remote device, which is looked up once per connection.
+	bond       *ble.Bond
+	bondLoaded bool
+	bondKey    bool // The link is being encrypted with the LTK of the bond.
+
+	// Security state of the link.
+	encrypted     bool
+	authenticated bool
+	encKeySize    int
+
+	// changed is closed when the security state changes, and is replaced.
+	changed chan struct{}
+}
+
+func newSMP(c *Conn) *smp {
+	return &smp{c: c, changed: make(chan struct{})}
+}
+
+// securityChanged wakes up the watchers of the security state. s must be locked.
+func (s *smp) securityChanged() {
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
 func (c *Conn) sendSMP(p pdu) error {
 	buf := bytes.NewBuffer(make([]byte, 0))
-	if err := binary.Write(buf, binary.LittleEndian, uint16(4+len(p))); err != nil {
+	if err := binary.Write(buf, binary.LittleEndian, uint16(len(p))); err != nil {
 		return err
 	}
 	if err := binary.Write(buf, binary.LittleEndian, cidSMP); err != nil {
@@ -41,27 +256,894 @@ func (c *Conn) sendSMP(p pdu) error {
 
 func (c *Conn) handleSMP(p pdu) error {
 	logger.Debug("smp", "recv", fmt.Sprintf("[%X]", p))
-	code := p[0]
-	switch code {
+	b := p.payload()
+	if len(b) == 0 {
+		return nil
+	}
+	return c.smp.handle(b)
+}
+
+// Pair starts pairing with the remote device, and waits for it to complete.
+// As a master, it sends a Pairing Request to the remote device. As a slave,
+// it sends a Security Request, asking the master to initiate the pairing.
+func (c *Conn) Pair(ctx context.Context) error {
+	done, err := c.smp.pair()
+	if err != nil {
+		return err
+	}
+	select {
+	case <-done:
+		return c.smp.result()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Security returns the current security state of the link.
+func (c *Conn) Security() ble.Security {
+	s := c.smp
+	s.Lock()
+	defer s.Unlock()
+	if !s.encrypted {
+		return ble.Security{}
+	}
+	return ble.Security{Encrypted: true, Authenticated: s.authenticated, KeySize: s.encKeySize}
+}
+
+// SecurityChanged returns a channel, which is closed when the security state
+// of the link changes, or the pairing completes.
+func (c *Conn) SecurityChanged() <-chan struct{} {
+	c.smp.Lock()
+	defer c.smp.Unlock()
+	return c.smp.changed
+}
+
+// InsufficientSecurity is called when the ATT server rejects a request for
+// insufficient security. If the device is configured with OptSecurityRequest,
+// and is the slave, it sends a Security Request to the master, which pairs or
+// encrypts the link.
+func (c *Conn) InsufficientSecurity(required ble.Security) {
+	if !c.hci.secReq || c.param.Role() != roleSlave {
+		return
+	}
+	s := c.smp
+	s.Lock()
+	defer s.Unlock()
+	if s.done != nil || s.timedOut {
+		return
+	}
+	s.initiate()
+}
+
+// SetOOBData sets the Temporary Key exchanged with the remote device a via an
+// out of band mechanism, which is used by LE legacy pairing. A nil tk removes it.
+func (h *HCI) SetOOBData(a ble.Addr, tk []byte) error {
+	if tk != nil && len(tk) != 16 {
+		return fmt.Errorf("invalid OOB data length %d", len(tk))
+	}
+	h.muSMP.Lock()
+	defer h.muSMP.Unlock()
+	k := strings.ToLower(a.String())
+	if tk == nil {
+		delete(h.oob, k)
+		return nil
+	}
+	h.oob[k] = swap(tk)
+	return nil
+}
+
+func (h *HCI) oobData(a ble.Addr) []byte {
+	h.muSMP.Lock()
+	defer h.muSMP.Unlock()
+	return h.oob[strings.ToLower(a.String())]
+}
+
+// localAddr returns the type and the address of the local device used on this link.
+func (c *Conn) localAddr() (uint8, []byte) {
+	t := c.hci.params.advParams.OwnAddressType
+	if c.param.Role() == roleMaster {
+		t = c.hci.params.connParams.OwnAddressType
+	}
+	return t & 0x01, swap(c.hci.addr)
+}
+
+// peerAddr returns the type and the address of the remote device used on this link.
+func (c *Conn) peerAddr() (uint8, []byte) {
+	a := c.param.PeerAddress()
+	return c.param.PeerAddressType() & 0x01, a[:]
+}
+
+func (s *smp) handle(b []byte) error {
+	s.Lock()
+	defer s.Unlock()
+
+	// No further SMP commands shall be sent or processed on this link
+	// once the Security Manager Timer has expired [Vol 3, Part H, 3.4].
+	if s.timedOut {
+		return nil
+	}
+
+	// If a packet is received with a reserved Code it shall be ignored. [Vol 3, Part H, 3.3]
+	n, ok := smpLen[b[0]]
+	if !ok {
+		return nil
+	}
+	if len(b) != n {
+		return s.fail(ErrSMPInvalidParameters)
+	}
+	if s.state != smpIdle {
+		s.resetTimer()
+	}
+
+	switch b[0] {
 	case pairingRequest:
+		return s.handlePairingRequest(b)
 	case pairingResponse:
+		return s.handlePairingResponse(b)
 	case pairingConfirm:
+		return s.handlePairingConfirm(b)
 	case pairingRandom:
+		return s.handlePairingRandom(b)
 	case pairingFailed:
+		return s.handlePairingFailed(b)
 	case encryptionInformation:
+		return s.handleEncryptionInformation(b)
 	case masterIdentification:
+		return s.handleMasterIdentification(b)
 	case identiInformation:
+		return s.handleIdentityInformation(b)
 	case identityAddreInformation:
+		return s.handleIdentityAddressInformation(b)
 	case signingInformation:
+		return s.handleSigningInformation(b)
 	case securityRequest:
+		return s.handleSecurityRequest(b)
 	case pairingPublicKey:
+		return s.handlePairingPublicKey(b)
 	case pairingDHKeyCheck:
+		return s.handlePairingDHKeyCheck(b)
 	case pairingKeypress:
+		// Keypress notifications are informational only.
+		return nil
+	}
+	return nil
+}
+
+// pair starts a pairing, or joins the ongoing one.
+func (s *smp) pair() (<-chan struct{}, error) {
+	s.Lock()
+	defer s.Unlock()
+	if s.timedOut {
+		return nil, ErrSMPTimeout
+	}
+	if s.done == nil {
+		s.initiate()
+		// The pairing fails immediately, if the request can't be sent.
+		if s.done == nil {
+			return nil, s.err
+		}
+	}
+	s.requested = true
+	return s.done, nil
+}
+
+// initiate starts a pairing. As a slave, it requests the master to initiate the pairing.
+func (s *smp) initiate() {
+	cfg := s.c.hci.smpConfig
+	if s.c.param.Role() == roleSlave {
+		// Security Request [Vol 3, Part H, 3.6.7]
+		s.start(false)
+		if err := s.send([]byte{securityRequest, cfg.authReq}); err != nil {
+			s.finish(err)
+		}
+		return
+	}
+
+	// The master encrypts the link with the LTK, if the remote device is bonded.
+	if !s.encrypted && s.encryptBond() {
+		return
+	}
+	s.requestPairing()
+}
+
+// requestPairing sends a Pairing Request to the slave [Vol 3, Part H, 3.5.1].
+func (s *smp) requestPairing() {
+	cfg := s.c.hci.smpConfig
+	s.start(true)
+	oob := uint8(0)
+	if s.c.hci.oobData(s.c.RemoteAddr()) != nil {
+		oob = 1
+	}
+	s.preq = []byte{pairingRequest, cfg.ioCap, oob, cfg.authReq, cfg.maxKeySize, cfg.initKeyDist, cfg.respKeyDist}
+	s.state = smpWaitPairingRsp
+	if err := s.send(s.preq); err != nil {
+		s.finish(err)
+	}
+}
+
+// result returns the result of the last pairing.
+func (s *smp) result() error {
+	s.Lock()
+	defer s.Unlock()
+	return s.err
+}
+
+// start resets the pairing state, and starts the Security Manager Timer.
+func (s *smp) start(initiator bool) {
+	if s.done == nil {
+		s.done = make(chan struct{})
+	}
+	if s.cancel != nil {
+		s.cancel()
+	}
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	s.err = nil
+	s.gen++
+	s.initiator = initiator
+	s.preq, s.pres = nil, nil
+	s.tk, s.lrand, s.lconf, s.rrand, s.rconf, s.stk = nil, nil, nil, nil, nil, nil
+	s.sc, s.priv, s.pka, s.pkb, s.dhkey, s.macKey, s.rcheck = false, nil, nil, nil, nil, nil, nil
+	s.passkey, s.hasPK, s.round = 0, false, 0
+	s.localDist, s.remoteDist = 0, 0
+	s.local, s.peer = keys{}, keys{}
+	s.resetTimer()
+}
+
+func (s *smp) resetTimer() {
+	if s.timer == nil {
+		s.timer = time.AfterFunc(smpTimeout, s.timeout)
+		return
+	}
+	s.timer.Stop()
+	s.timer.Reset(smpTimeout)
+}
+
+func (s *smp) timeout() {
+	s.Lock()
+	defer s.Unlock()
+	if s.done == nil {
+		return
+	}
+	_ = logger.Error("smp", "pairing", "timeout")
+	s.timedOut = true
+	s.finish(ErrSMPTimeout)
+}
+
+// disconnected aborts the ongoing pairing, if any.
+func (s *smp) disconnected() {
+	s.Lock()
+	defer s.Unlock()
+	if s.timer != nil {
+		s.timer.Stop()
+	}
+	if s.done != nil {
+		s.finish(io.ErrClosedPipe)
+	}
+}
+
+// finish ends the ongoing pairing with err, and wakes up the waiters.
+func (s *smp) finish(err error) {
+	if s.timer != nil {
+		s.timer.Stop()
+	}
+	s.state = smpIdle
+	s.err = err
+	if err != nil {
+		_ = logger.Error("smp", "pairing", err)
+	} else {
+		logger.Info("smp", "paired", s.c.RemoteAddr(), "keysize", s.keySize, "authenticated", s.method != justWorks)
+	}
+	if s.cancel != nil {
+		s.cancel()
+	}
+	if s.done != nil {
+		close(s.done)
+		s.done = nil
+	}
+	s.requested = false
+	s.securityChanged()
+}
+
+// fail sends Pairing Failed with the reason to the remote device, and ends the pairing.
+func (s *smp) fail(reason ErrSMP) error {
+	err := s.send([]byte{pairingFailed, byte(reason)})
+	s.finish(reason)
+	return err
+}
+
+func (s *smp) send(b []byte) error {
+	if s.state != smpIdle || s.done != nil {
+		s.resetTimer()
+	}
+	return s.c.sendSMP(b)
+}
+
+// Pairing Request [Vol 3, Part H, 3.5.1].
+func (s *smp) handlePairingRequest(b []byte) error {
+	if s.c.param.Role() != roleSlave {
+		return s.fail(ErrSMPCommandNotSupported)
+	}
+	if s.state != smpIdle {
+		return s.fail(ErrSMPUnspecifiedReason)
+	}
+	s.start(false)
+	s.preq = append([]byte(nil), b...)
+
+	cfg := s.c.hci.smpConfig
+	ioCap, authReq, maxKeySize := b[1], b[3], b[4]
+	if ioCap > ioKeyboardDisplay {
+		return s.fail(ErrSMPInvalidParameters)
+	}
+	if maxKeySize < minKeySize || maxKeySize > 16 {
+		return s.fail(ErrSMPEncryptionKeySize)
+	}
+
+	initDist, respDist := b[5]&cfg.initKeyDist, b[6]&cfg.respKeyDist
+	s.bonding = authReq&authReqBonding != 0 && cfg.authReq&authReqBonding != 0
+	if !s.bonding {
+		initDist, respDist = 0, 0
+	}
+
+	oob := uint8(0)
+	if s.c.hci.oobData(s.c.RemoteAddr()) != nil {
+		oob = 1
+	}
+	s.pres = []byte{pairingResponse, cfg.ioCap, oob, cfg.authReq, cfg.maxKeySize, initDist, respDist}
+	s.localDist, s.remoteDist = respDist, initDist
+	if reason := s.negotiate(); reason != 0 {
+		return s.fail(reason)
+	}
+	if err := s.send(s.pres); err != nil {
+		return err
+	}
+	if s.sc {
+		s.state = smpWaitPublicKey
+		return nil
+	}
+	s.state = smpWaitConfirm
+	return s.prepareTK()
+}
+
+// Pairing Response [Vol 3, Part H, 3.5.2].
+func (s *smp) handlePairingResponse(b []byte) error {
+	if s.state != smpWaitPairingRsp {
+		return s.fail(ErrSMPUnspecifiedReason)
+	}
+	s.pres = append([]byte(nil), b...)
+
+	ioCap, authReq, maxKeySize := b[1], b[3], b[4]
+	if ioCap > ioKeyboardDisplay {
+		return s.fail(ErrSMPInvalidParameters)
+	}
+	if maxKeySize < minKeySize || maxKeySize > 16 {
+		return s.fail(ErrSMPEncryptionKeySize)
+	}
+	// The responder shall not distribute keys that weren't requested.
+	initDist, respDist := b[5], b[6]
+	if initDist&^s.preq[5] != 0 || respDist&^s.preq[6] != 0 {
+		return s.fail(ErrSMPInvalidParameters)
+	}
+	s.bonding = authReq&authReqBonding != 0 && s.preq[3]&authReqBonding != 0
+	s.localDist, s.remoteDist = initDist, respDist
+	if reason := s.negotiate(); reason != 0 {
+		return s.fail(reason)
+	}
+	if s.sc {
+		return s.sendPublicKey()
+	}
+	s.state = smpWaitTK
+	return s.prepareTK()
+}
+
+// negotiate decides the key size and the pairing method from the exchanged
+// features. It returns the reason if the pairing can't proceed.
+func (s *smp) negotiate() ErrSMP {
+	s.keySize = int(s.preq[4])
+	if int(s.pres[4]) < s.keySize {
+		s.keySize = int(s.pres[4])
+	}
+	if s.keySize < minKeySize {
+		return ErrSMPEncryptionKeySize
+	}
+
+	// LE Secure Connections is used if both devices support it. The LTK is
+	// generated by both devices, instead of being distributed [Vol 3, Part H, 3.6.1].
+	s.sc = s.preq[3]&authReqSC != 0 && s.pres[3]&authReqSC != 0
+	if s.sc {
+		s.localDist &^= keyDistEnc
+		s.remoteDist &^= keyDistEnc
+	}
+
+	// Selecting Key Generation Method [Vol 3, Part H, 2.3.5.1]
+	switch {
+	case s.sc && (s.preq[2] == 1 || s.pres[2] == 1):
+		// The OOB data of LE Secure Connections is not supported.
+		return ErrSMPOOBNotAvailable
+	case s.sc && s.preq[3]&authReqMITM == 0 && s.pres[3]&authReqMITM == 0:
+		s.method = justWorks
+	case s.sc:
+		s.method = scMethods[s.pres[1]][s.preq[1]]
+	case s.preq[2] == 1 && s.pres[2] == 1:
+		s.method = outOfBand
+	case s.preq[3]&authReqMITM == 0 && s.pres[3]&authReqMITM == 0:
+		s.method = justWorks
 	default:
-		// If a packet is received with a reserved Code it shall be ignored. [Vol 3, Part H, 3.3]
+		s.method = legacyMethods[s.pres[1]][s.preq[1]]
+	}
+
+	// Fail the pairing if the local device requires MITM protection, but the
+	// IO capabilities don't allow an authenticated pairing.
+	if s.c.hci.smpConfig.authReq&authReqMITM != 0 && s.method == justWorks {
+		return ErrSMPAuthenticationRequirements
+	}
+	return 0
+}
+
+// prepareTK prepares the Temporary Key according to the pairing method.
+func (s *smp) prepareTK() error {
+	switch s.method {
+	case justWorks:
+		return s.authorizeJustWorks(func() error {
+			s.tk = make([]byte, 16)
+			return s.tkReady()
+		})
+	case outOfBand:
+		s.tk = s.c.hci.oobData(s.c.RemoteAddr())
+		if s.tk == nil {
+			return s.fail(ErrSMPOOBNotAvailable)
+		}
+	default:
+		return s.requestPasskey(func(pk uint32) error {
+			s.tk = passkeyTK(pk)
+			return s.tkReady()
+		})
+	}
+	return s.tkReady()
+}
+
+// requestPasskey displays a random passkey, or asks the user to input the
+// passkey, depending on the pairing method. Since the user may take a while
+// to input the passkey, ready is called later in another goroutine, with the
+// smp locked.
+func (s *smp) requestPasskey(ready func(pk uint32) error) error {
+	display := (s.method == passkeyInitInput && !s.initiator) ||
+		(s.method == passkeyRespInput && s.initiator)
+	if display {
+		pk, err := randomPasskey()
+		if err != nil {
+			return s.fail(ErrSMPUnspecifiedReason)
+		}
+		s.displayPasskey(pk)
+		return ready(pk)
+	}
+	gen, ctx := s.gen, s.ctx
+	go func() {
+		pk, err := s.inputPasskey(ctx)
+		s.Lock()
+		defer s.Unlock()
+		if s.gen != gen || s.done == nil {
+			return
+		}
+		if err != nil {
+			_ = s.fail(ErrSMPPasskeyEntryFailed)
+			return
+		}
+		_ = ready(pk)
+	}()
+	return nil
+}
+
+// askUser asks the user with f in another goroutine, since the user may take
+// a while to answer. If the user accepts, ok is called with the smp locked.
+// Otherwise, the pairing fails with the reason.
+func (s *smp) askUser(f func(ctx context.Context) (bool, error), reason ErrSMP, ok func() error) error {
+	gen, ctx := s.gen, s.ctx
+	go func() {
+		yes, err := f(ctx)
+		s.Lock()
+		defer s.Unlock()
+		if s.gen != gen || s.done == nil {
+			return
+		}
+		if err != nil || !yes {
+			_ = s.fail(reason)
+			return
+		}
+		_ = ok()
+	}()
+	return nil
+}
+
+// authorizeJustWorks asks the agent whether to accept the Just Works pairing
+// requested by the remote device. The pairing requested by the local device,
+// or without an agent is always accepted.
+func (s *smp) authorizeJustWorks(ok func() error) error {
+	a := s.c.hci.agent
+	if a == nil || s.requested {
+		return ok()
+	}
+	reason := ErrSMPUnspecifiedReason
+	if s.sc {
+		// Just Works of LE Secure Connections is Numeric Comparison without the display.
+		reason = ErrSMPNumericComparisonFailed
+	}
+	peer := s.c.RemoteAddr()
+	return s.askUser(func(ctx context.Context) (bool, error) {
+		return a.AuthorizeJustWorks(ctx, peer)
+	}, reason, ok)
+}
+
+// displayPasskey shows the passkey to the user, who enters it on the remote device.
+func (s *smp) displayPasskey(pk uint32) {
+	a := s.c.hci.agent
+	if a == nil {
+		logger.Info("smp", "peer", s.c.RemoteAddr(), "passkey", fmt.Sprintf("%06d", pk))
+		return
+	}
+	gen, ctx, peer := s.gen, s.ctx, s.c.RemoteAddr()
+	go func() {
+		if err := a.DisplayPasskey(ctx, peer, pk); err != nil {
+			s.Lock()
+			defer s.Unlock()
+			if s.gen == gen && s.done != nil {
+				_ = s.fail(ErrSMPPasskeyEntryFailed)
+			}
+		}
+	}()
+}
+
+// inputPasskey asks the user for the passkey displayed on the remote device.
+func (s *smp) inputPasskey(ctx context.Context) (uint32, error) {
+	a := s.c.hci.agent
+	if a == nil {
+		return 0, fmt.Errorf("no agent to input passkey")
+	}
+	pk, err := a.RequestPasskey(ctx, s.c.RemoteAddr())
+	if err != nil {
+		return 0, err
+	}
+	if pk > 999999 {
+		return 0, fmt.Errorf("invalid passkey %d", pk)
+	}
+	return pk, nil
+}
+
+// confirmNumber asks the user if the number matches the one displayed on the
+// remote device. The six least significant digits of n are displayed.
+func (s *smp) confirmNumber(ctx context.Context, n uint32) (bool, error) {
+	a := s.c.hci.agent
+	if a == nil {
+		return false, fmt.Errorf("no agent to confirm number")
+	}
+	return a.ConfirmNumber(ctx, s.c.RemoteAddr(), n%1000000)
+}
+
+// tkReady is called once the TK is available to generate the confirm value.
+// The initiator sends its confirm value first, and the responder replies its
+// confirm value after receiving the initiator's one.
+func (s *smp) tkReady() error {
+	var err error
+	if s.lrand, err = random(16); err != nil {
+		return s.fail(ErrSMPUnspecifiedReason)
+	}
+	s.lconf = s.confirm(s.lrand)
+	if s.initiator {
+		s.state = smpWaitConfirm
+		return s.send(append([]byte{pairingConfirm}, s.lconf...))
+	}
+	if s.rconf == nil {
+		return nil
+	}
+	s.state = smpWaitRandom
+	return s.send(append([]byte{pairingConfirm}, s.lconf...))
+}
+
+// confirm calculates the confirm value with the random number r.
+func (s *smp) confirm(r []byte) []byte {
+	lt, la := s.c.localAddr()
+	pt, pa := s.c.peerAddr()
+	if s.initiator {
+		return c1(s.tk, r, s.preq, s.pres, lt, pt, la, pa)
+	}
+	return c1(s.tk, r, s.preq, s.pres, pt, lt, pa, la)
+}
+
+// Pairing Confirm [Vol 3, Part H, 3.5.3].
+func (s *smp) handlePairingConfirm(b []byte) error {
+	if s.state != smpWaitConfirm {
+		return s.fail(ErrSMPUnspecifiedReason)
+	}
+	if s.sc {
+		return s.handleSCConfirm(b)
+	}
+	s.rconf = append([]byte(nil), b[1:]...)
+	if s.initiator {
+		s.state = smpWaitRandom
+		return s.send(append([]byte{pairingRandom}, s.lrand...))
+	}
+	if s.tk == nil {
+		// Reply our confirm value once the user has entered the passkey.
+		return nil
+	}
+	s.state = smpWaitRandom
+	return s.send(append([]byte{pairingConfirm}, s.lconf...))
+}
+
+// Pairing Random [Vol 3, Part H, 3.5.4].
+func (s *smp) handlePairingRandom(b []byte) error {
+	if s.state != smpWaitRandom {
+		return s.fail(ErrSMPUnspecifiedReason)
+	}
+	if s.sc {
+		return s.handleSCRandom(b)
+	}
+	s.rrand = append([]byte(nil), b[1:]...)
+	if subtle.ConstantTimeCompare(s.confirm(s.rrand), s.rconf) != 1 {
+		return s.fail(ErrSMPConfirmValueFailed)
+	}
+
+	// STK = s1(TK, Srand, Mrand), and shortened to the negotiated key size [Vol 3, Part H, 2.3.5.5].
+	s.state = smpWaitEncryption
+	if !s.initiator {
+		s.stk = maskKey(s1(s.tk, s.lrand, s.rrand), s.keySize)
+		return s.send(append([]byte{pairingRandom}, s.lrand...))
+	}
+	s.stk = maskKey(s1(s.tk, s.rrand, s.lrand), s.keySize)
+	s.startEncryption()
+	return nil
+}
+
+// startEncryption encrypts the link with the STK, or the LTK generated by LE
+// Secure Connections. EDIV and Rand are set to zero in both cases.
+func (s *smp) startEncryption() {
+	c := &cmd.LEStartEncryption{ConnectionHandle: s.c.param.ConnectionHandle()}
+	copy(c.LongTermKey[:], s.stk)
+	s.sendEncryption(c)
+}
+
+// sendEncryption sends the command to encrypt the link. The result is
+// reported later by the Encryption Change event.
+func (s *smp) sendEncryption(c *cmd.LEStartEncryption) {
+	state := s.state
+	go func() {
+		if err := s.c.hci.Send(c, nil); err != nil {
+			s.Lock()
+			defer s.Unlock()
+			if s.state == state {
+				s.finish(err)
+			}
+		}
+	}()
+}
+
+// Pairing Failed [Vol 3, Part H, 3.5.5].
+func (s *smp) handlePairingFailed(b []byte) error {
+	if s.state == smpIdle && s.done == nil {
+		return nil
+	}
+	s.finish(ErrSMP(b[1]))
+	return nil
+}
+
+// Security Request [Vol 3, Part H, 3.6.7].
+func (s *smp) handleSecurityRequest(b []byte) error {
+	if s.c.param.Role() != roleMaster {
+		return s.fail(ErrSMPCommandNotSupported)
+	}
+	if s.state != smpIdle || s.done != nil {
+		// Pairing is already in progress.
+		return nil
+	}
+	s.initiate()
+	return nil
+}
+
+// ltk returns the key to encrypt the link, which the controller requested with EDIV and Rand.
+func (s *smp) ltk(ediv uint16, rand uint64) []byte {
+	s.Lock()
+	defer s.Unlock()
+	s.bondKey = false
+	if s.state == smpWaitEncryption && ediv == 0 && rand == 0 {
+		return s.stk
+	}
+	if s.local.ltk != nil && s.local.ediv == ediv && s.local.rand == rand {
+		return s.local.ltk
+	}
+	if b := s.loadBond(); b != nil && b.LocalLTK != nil && b.LocalLTK.EDIV == ediv && b.LocalLTK.Rand == rand {
+		s.bondKey = true
+		return b.LocalLTK.Key
+	}
+	return nil
+}
+
+// encryptionChanged is called when the encryption of the link has been changed.
+// Since it's called in the HCI event loop, it must not block on sending packets.
+func (s *smp) encryptionChanged(status uint8, enabled bool) {
+	s.Lock()
+	defer s.Unlock()
+	defer s.securityChanged()
+	s.encrypted = status == 0x00 && enabled
+	if s.state == smpWaitBondEncryption {
+		s.bondEncrypted(status)
+		return
+	}
+	if s.state != smpWaitEncryption {
+		if s.encrypted && s.bondKey {
+			s.authenticated, s.encKeySize = s.bond.Authenticated, s.bond.KeySize
+		}
+		// The master may encrypt the link with a previously distributed
+		// LTK in response to our Security Request.
+		if s.done != nil && !s.initiator && s.encrypted {
+			s.finish(nil)
+		}
+		return
+	}
+	if !s.encrypted {
+		s.finish(ErrCommand(status))
+		return
+	}
+	s.authenticated = s.method != justWorks
+	s.encKeySize = s.keySize
+	s.state = smpKeyDistribution
+	if s.sc {
+		s.local.ltk, s.peer.ltk = s.stk, s.stk
+	}
+
+	// The slave distributes its keys first [Vol 3, Part H, 3.6.1].
+	if s.initiator && s.remoteDist != 0 {
+		return
+	}
+	_ = s.received(0)
+}
+
+// distribute generates the local keys to be distributed, and returns the SMP commands carrying them.
+func (s *smp) distribute() ([][]byte, error) {
+	var pdus [][]byte
+	if s.localDist&keyDistEnc != 0 {
+		ltk, err := random(16)
+		if err != nil {
+			return nil, err
+		}
+		r, err := random(10)
+		if err != nil {
+			return nil, err
+		}
+		s.local.ltk = maskKey(ltk, s.keySize)
+		s.local.ediv = binary.LittleEndian.Uint16(r[0:])
+		s.local.rand = binary.LittleEndian.Uint64(r[2:])
+		pdus = append(pdus, append([]byte{encryptionInformation}, s.local.ltk...))
+		pdus = append(pdus, append([]byte{masterIdentification}, r...))
+	}
+	if s.localDist&keyDistID != 0 {
+		t, a := s.c.localAddr()
+		s.local.irk = s.c.hci.irk
+		s.local.addrType, s.local.addr = t, a
+		pdus = append(pdus, append([]byte{identiInformation}, s.local.irk...))
+		pdus = append(pdus, append([]byte{identityAddreInformation, t}, a...))
+	}
+	if s.localDist&keyDistSign != 0 {
+		csrk, err := random(16)
+		if err != nil {
+			return nil, err
+		}
+		s.local.csrk = csrk
+		pdus = append(pdus, append([]byte{signingInformation}, csrk...))
+	}
+	s.localDist = 0
+	return pdus, nil
+}
+
+// received marks the key as distributed by the remote device. The slave
+// distributes its keys first, and the master distributes its keys once all of
+// the keys of the slave have been received. The pairing completes once the
+// remote device has distributed all of its keys.
+func (s *smp) received(dist uint8) error {
+	s.remoteDist &^= dist
+	if s.initiator && s.remoteDist != 0 {
 		return nil
 	}
-	// FIXME: work aound to the lack of SMP implementation - always return non-supported.
-	// C.5.1 Pairing Not Supported by Slave
-	return c.sendSMP([]byte{pairingFailed, 0x05})
+	pdus, err := s.distribute()
+	if err != nil {
+		return s.fail(ErrSMPUnspecifiedReason)
+	}
+	if s.remoteDist == 0 {
+		s.saveBond()
+		s.finish(nil)
+	}
+	if len(pdus) == 0 {
+		return nil
+	}
+
+	// This may be called in the HCI event loop, so send the keys in another goroutine.
+	go func() {
+		for _, p := range pdus {
+			if err := s.c.sendSMP(p); err != nil {
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// expect checks if the remote device is supposed to distribute the key now.
+func (s *smp) expect(dist uint8) bool {
+	return s.state == smpKeyDistribution && s.remoteDist&dist != 0
+}
+
+// Encryption Information [Vol 3, Part H, 3.6.2].
+func (s *smp) handleEncryptionInformation(b []byte) error {
+	if !s.expect(keyDistEnc) {
+		return s.fail(ErrSMPUnspecifiedReason)
+	}
+	s.peer.ltk = append([]byte(nil), b[1:]...)
+	return nil
+}
+
+// Master Identification [Vol 3, Part H, 3.6.3].
+func (s *smp) handleMasterIdentification(b []byte) error {
+	if !s.expect(keyDistEnc) || s.peer.ltk == nil {
+		return s.fail(ErrSMPUnspecifiedReason)
+	}
+	s.peer.ediv = binary.LittleEndian.Uint16(b[1:])
+	s.peer.rand = binary.LittleEndian.Uint64(b[3:])
+	return s.received(keyDistEnc)
+}
+
+// Identity Information [Vol 3, Part H, 3.6.4].
+func (s *smp) handleIdentityInformation(b []byte) error {
+	if !s.expect(keyDistID) {
+		return s.fail(ErrSMPUnspecifiedReason)
+	}
+	s.peer.irk = append([]byte(nil), b[1:]...)
+	return nil
+}
+
+// Identity Address Information [Vol 3, Part H, 3.6.5].
+func (s *smp) handleIdentityAddressInformation(b []byte) error {
+	if !s.expect(keyDistID) || s.peer.irk == nil {
+		return s.fail(ErrSMPUnspecifiedReason)
+	}
+	s.peer.addrType = b[1]
+	s.peer.addr = append([]byte(nil), b[2:]...)
+	return s.received(keyDistID)
+}
+
+// Signing Information [Vol 3, Part H, 3.6.6].
+func (s *smp) handleSigningInformation(b []byte) error {
+	if !s.expect(keyDistSign) {
+		return s.fail(ErrSMPUnspecifiedReason)
+	}
+	s.peer.csrk = append([]byte(nil), b[1:]...)
+	return s.received(keyDistSign)
+}
+
+// random returns n octets of random number.
+func random(n int) ([]byte, error) {
+	b := make([]byte, n)
+	_, err := rand.Read(b)
+	return b, err
+}
+
+// randomPasskey returns a random passkey in the range of 000,000 to 999,999.
+func randomPasskey() (uint32, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return 0, err
+	}
+	return uint32(n.Int64()), nil
+}
+
+// passkeyTK converts the passkey to the TK [Vol 3, Part H, 2.3.5.3].
+func passkeyTK(pk uint32) []byte {
+	tk := make([]byte, 16)
+	binary.LittleEndian.PutUint32(tk, pk)
+	return tk
+}
+
+// maskKey shortens the key to the encryption key size [Vol 3, Part H, 2.3.4].
+func maskKey(k []byte, size int) []byte {
+	for i := size; i < len(k); i++ {
+		k[i] = 0
+	}
+	return k
 }
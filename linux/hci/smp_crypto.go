@@ -0,0 +1,183 @@
+package hci
+
+import (
+	"crypto/aes"
+	"crypto/ecdh"
+	"encoding/binary"
+
+	"github.com/runtimeco/ble/linux/internal/cmac"
+)
+
+// The cryptographic toolbox of the Security Manager is defined with the most
+// significant octet first, while the values are transmitted over the air with
+// the least significant octet first [Vol 3, Part H, 3.1]. All the functions
+// below take and return values in the over-the-air (little-endian) order, and
+// swap them internally.
+
+// swap returns a copy of b with the order of the octets reversed.
+func swap(b []byte) []byte {
+	r := make([]byte, len(b))
+	for i := range b {
+		r[len(b)-1-i] = b[i]
+	}
+	return r
+}
+
+// xor returns a ^ b. Both a and b must be 16 octets.
+func xor(a, b []byte) []byte {
+	r := make([]byte, 16)
+	for i := range r {
+		r[i] = a[i] ^ b[i]
+	}
+	return r
+}
+
+// smpE implements the security function e, which is the AES-128 block cipher
+// [Vol 3, Part H, 2.2.1].
+func smpE(key, plaintext []byte) []byte {
+	blk, err := aes.NewCipher(swap(key))
+	if err != nil {
+		// Only happens when the key is not 16 octets, which is a programming error.
+		panic(err)
+	}
+	r := make([]byte, 16)
+	blk.Encrypt(r, swap(plaintext))
+	return swap(r)
+}
+
+// c1 implements the confirm value generation function c1 for LE Legacy Pairing
+// [Vol 3, Part H, 2.2.3].
+//
+// preq and pres are the 7 octets of the Pairing Request and Pairing Response
+// commands, including the command code. iat and rat are the address types,
+// and ia and ra are the addresses of the initiating and responding devices.
+func c1(k, r, preq, pres []byte, iat, rat uint8, ia, ra []byte) []byte {
+	p1 := make([]byte, 0, 16)
+	p1 = append(p1, iat, rat)
+	p1 = append(p1, preq...)
+	p1 = append(p1, pres...)
+
+	p2 := make([]byte, 0, 16)
+	p2 = append(p2, ra...)
+	p2 = append(p2, ia...)
+	p2 = append(p2, 0, 0, 0, 0)
+
+	return smpE(k, xor(smpE(k, xor(r, p1)), p2))
+}
+
+// s1 implements the key generation function s1 for LE Legacy Pairing, which is
+// used to generate the STK during the pairing process [Vol 3, Part H, 2.2.4].
+func s1(k, r1, r2 []byte) []byte {
+	r := make([]byte, 0, 16)
+	r = append(r, r2[:8]...)
+	r = append(r, r1[:8]...)
+	return smpE(k, r)
+}
+
+// ah implements the random address hash function ah, which is used to resolve
+// resolvable private addresses [Vol 3, Part H, 2.2.2]. k is the IRK, and r is
+// the 24-bit prand of the address.
+func ah(k, r []byte) []byte {
+	p := make([]byte, 16)
+	copy(p, r[:3])
+	return smpE(k, p)[:3]
+}
+
+// aesCMAC implements the AES-CMAC function defined in RFC 4493, which is used
+// by the LE Secure Connections confirm value generation functions [Vol 3, Part H, 2.2.5].
+// Unlike other functions in this file, the key and the message are in the
+// order of the spec (most significant octet first).
+func aesCMAC(key, msg []byte) []byte {
+	return cmac.Sum(key, msg)
+}
+
+// cat concatenates the values, which are in the over-the-air order, into a
+// message in the order of the spec. The first value becomes the most
+// significant octets of the message.
+func cat(vals ...[]byte) []byte {
+	var m []byte
+	for _, v := range vals {
+		m = append(m, swap(v)...)
+	}
+	return m
+}
+
+// f4 implements the confirm value generation function f4 for LE Secure
+// Connections [Vol 3, Part H, 2.2.6]. u and v are the X coordinates of the
+// public keys (32 octets), x is the random nonce, and z is 0 for Just Works
+// and Numeric Comparison, or 0x80 | ri for Passkey Entry.
+func f4(u, v, x []byte, z uint8) []byte {
+	return swap(aesCMAC(swap(x), cat(u, v, []byte{z})))
+}
+
+// f5 implements the key generation function f5 for LE Secure Connections,
+// which returns the MacKey and the LTK [Vol 3, Part H, 2.2.7]. w is the DHKey,
+// n1 and n2 are the nonces, and a1 and a2 are the device addresses (7 octets,
+// with the address type at the most significant octet).
+func f5(w, n1, n2, a1, a2 []byte) ([]byte, []byte) {
+	salt := []byte{
+		0x6C, 0x88, 0x83, 0x91, 0xAA, 0xF5, 0xA5, 0x38,
+		0x60, 0x37, 0x0B, 0xDB, 0x5A, 0x60, 0x83, 0xBE,
+	}
+	t := aesCMAC(salt, swap(w))
+	keyID := []byte{0x65, 0x6C, 0x74, 0x62} // "btle"
+	length := []byte{0x00, 0x01}            // 256
+	macKey := aesCMAC(t, cat([]byte{0}, keyID, n1, n2, a1, a2, length))
+	ltk := aesCMAC(t, cat([]byte{1}, keyID, n1, n2, a1, a2, length))
+	return swap(macKey), swap(ltk)
+}
+
+// f6 implements the check value generation function f6 for LE Secure
+// Connections [Vol 3, Part H, 2.2.8]. ioCap is the AuthReq, OOB data flag and
+// IO capability (3 octets, with the IO capability at the least significant octet).
+func f6(w, n1, n2, r, ioCap, a1, a2 []byte) []byte {
+	return swap(aesCMAC(swap(w), cat(n1, n2, r, ioCap, a1, a2)))
+}
+
+// g2 implements the numeric comparison value generation function g2 for LE
+// Secure Connections [Vol 3, Part H, 2.2.9]. The six least significant digits
+// of the returned value are displayed to the user.
+func g2(u, v, x, y []byte) uint32 {
+	r := aesCMAC(swap(x), cat(u, v, y))
+	return binary.BigEndian.Uint32(r[12:])
+}
+
+// publicKey returns the public key of k as carried by the Pairing Public Key
+// command, which is the X and Y coordinates (32 octets each) in the
+// over-the-air order [Vol 3, Part H, 3.5.6].
+func publicKey(k *ecdh.PrivateKey) []byte {
+	b := k.PublicKey().Bytes() // Uncompressed form: 0x04 || X || Y
+	return append(swap(b[1:33]), swap(b[33:65])...)
+}
+
+// dhKey computes the P-256 Diffie-Hellman key from the local private key and
+// the public key of the remote device. It fails if the remote public key is
+// not a valid point on the curve [Vol 3, Part H, 2.3.5.6.1].
+func dhKey(k *ecdh.PrivateKey, pub []byte) ([]byte, error) {
+	b := append([]byte{0x04}, swap(pub[:32])...)
+	b = append(b, swap(pub[32:64])...)
+	rk, err := ecdh.P256().NewPublicKey(b)
+	if err != nil {
+		return nil, err
+	}
+	w, err := k.ECDH(rk)
+	if err != nil {
+		return nil, err
+	}
+	return swap(w), nil
+}
+
+// sign generates the signature of the data m with the CSRK and the sign
+// counter [Vol 3, Part H, 2.4.5]. The signature consists of the sign counter,
+// and the 64 most significant bits of the MAC, least significant octet first.
+func sign(csrk, m []byte, cnt uint32) [12]byte {
+	msg := make([]byte, len(m)+4)
+	copy(msg, m)
+	binary.LittleEndian.PutUint32(msg[len(m):], cnt)
+	mac := swap(aesCMAC(swap(csrk), swap(msg)))
+
+	var sig [12]byte
+	binary.LittleEndian.PutUint32(sig[:4], cnt)
+	copy(sig[4:], mac[8:])
+	return sig
+}
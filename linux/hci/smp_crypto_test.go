@@ -0,0 +1,164 @@
+package hci
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"encoding/hex"
+	"testing"
+)
+
+// le decodes a hex string, which is written with the most significant octet
+// first as in the spec, into the over-the-air (little-endian) order.
+func le(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return swap(b)
+}
+
+// Sample data of c1 [Vol 3, Part H, 2.2.3].
+func TestC1(t *testing.T) {
+	k := make([]byte, 16)
+	r := le("5783D52156AD6F0E6388274EC6702EE0")
+	preq := le("07071000000101")
+	pres := le("05000800000302")
+	ia := le("A1A2A3A4A5A6")
+	ra := le("B1B2B3B4B5B6")
+
+	want := le("1E1E3FEF878988EAD2A74DC5BEF13B86")
+	if got := c1(k, r, preq, pres, 0x01, 0x00, ia, ra); !bytes.Equal(got, want) {
+		t.Errorf("c1 = %X, want %X", swap(got), swap(want))
+	}
+}
+
+// Sample data of s1 [Vol 3, Part H, 2.2.4].
+func TestS1(t *testing.T) {
+	k := make([]byte, 16)
+	r1 := le("000F0E0D0C0B0A091122334455667788")
+	r2 := le("010203040506070899AABBCCDDEEFF00")
+
+	want := le("9A1FE1F0E8B0F49B5B4216AE796DA062")
+	if got := s1(k, r1, r2); !bytes.Equal(got, want) {
+		t.Errorf("s1 = %X, want %X", swap(got), swap(want))
+	}
+}
+
+// Sample data of ah [Vol 3, Part H, D.7].
+func TestAH(t *testing.T) {
+	irk := le("ec0234a357c8ad05341010a60a397d9b")
+	prand := le("708194")
+	want := le("0dfbaa")
+	if got := ah(irk, prand); !bytes.Equal(got, want) {
+		t.Errorf("ah = %X, want %X", swap(got), swap(want))
+	}
+}
+
+// Sample data of AES-CMAC [RFC 4493, 4].
+func TestAESCMAC(t *testing.T) {
+	k := le("2b7e151628aed2a6abf7158809cf4f3c")
+	m := le("6bc1bee22e409f96e93d7e117393172aae2d8a571e03ac9c9eb76fac45af8e5130c81c46a35ce411")
+	tests := []struct {
+		n    int
+		want string
+	}{
+		{0, "bb1d6929e95937287fa37d129b756746"},
+		{16, "070a16b46b4d4144f79bdd9dd04a287c"},
+		{40, "dfa66747de9ae63030ca32611497c827"},
+	}
+	for _, tt := range tests {
+		got := aesCMAC(swap(k), swap(m)[:tt.n])
+		if want := swap(le(tt.want)); !bytes.Equal(got, want) {
+			t.Errorf("AES-CMAC(%d octets) = %X, want %X", tt.n, got, want)
+		}
+	}
+}
+
+// Sample data of the LE Secure Connections functions [Vol 3, Part H, D].
+var (
+	sampleU  = le("20b003d2f297be2c5e2c83a7e9f9a5b9eff49111acf4fddbcc0301480e359de6")
+	sampleV  = le("55188b3d32f6bb9a900afcfbeed4e72a59cb9ac2f19d7cfb6b4fdd49f47fc5fd")
+	sampleW  = le("ec0234a357c8ad05341010a60a397d9b99796b13b4f866f1868d34f373bfa698")
+	sampleN1 = le("d5cb8454d177733effffb2ec712baeab")
+	sampleN2 = le("a6e8e7cc25a75f6e216583f7ff3dc4cf")
+	sampleA1 = le("0056123737bfce")
+	sampleA2 = le("00a713702dcfc1")
+)
+
+// Sample data of P-256 [Vol 3, Part H, D.1].
+func TestDHKey(t *testing.T) {
+	privA, _ := hex.DecodeString("3f49f6d4a3c55f3874c9b3e3d2103f504aff607beb40b7995899b8a6cd3c1abd")
+	privB, _ := hex.DecodeString("55188b3d32f6bb9a900afcfbeed4e72a59cb9ac2f19d7cfb6b4fdd49f47fc5fd")
+	pubA := append(le("20b003d2f297be2c5e2c83a7e9f9a5b9eff49111acf4fddbcc0301480e359de6"),
+		le("dc809c49652aeb6d63329abf5a52155c766345c28fed3024741c8ed01589d28b")...)
+	pubB := append(le("1ea1f0f01faf1d9609592284f19e4c0047b58afd8615a69f559077b22faaa190"),
+		le("4c55f33e429dad377356703a9ab85160472d1130e28e36765f89aff915b1214a")...)
+
+	ka, err := ecdh.P256().NewPrivateKey(privA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kb, err := ecdh.P256().NewPrivateKey(privB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := publicKey(ka); !bytes.Equal(got, pubA) {
+		t.Errorf("public key A = %X, want %X", got, pubA)
+	}
+	if got := publicKey(kb); !bytes.Equal(got, pubB) {
+		t.Errorf("public key B = %X, want %X", got, pubB)
+	}
+	wa, err := dhKey(ka, pubB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wb, err := dhKey(kb, pubA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(wa, sampleW) || !bytes.Equal(wb, sampleW) {
+		t.Errorf("DHKey = %X, %X, want %X", swap(wa), swap(wb), swap(sampleW))
+	}
+
+	// A point not on the curve must be rejected.
+	bad := append([]byte(nil), pubB...)
+	bad[0] ^= 0x01
+	if _, err := dhKey(ka, bad); err == nil {
+		t.Errorf("DHKey with an invalid public key succeeded")
+	}
+}
+
+func TestF4(t *testing.T) {
+	want := le("f2c916f107a9bd1cf1eda1bea974872d")
+	if got := f4(sampleU, sampleV, sampleN1, 0x00); !bytes.Equal(got, want) {
+		t.Errorf("f4 = %X, want %X", swap(got), swap(want))
+	}
+}
+
+func TestF5(t *testing.T) {
+	wantMacKey := le("2965f176a1084a02fd3f6a20ce636e20")
+	wantLTK := le("6986791169d7cd23980522b594750a38")
+	macKey, ltk := f5(sampleW, sampleN1, sampleN2, sampleA1, sampleA2)
+	if !bytes.Equal(macKey, wantMacKey) {
+		t.Errorf("f5 MacKey = %X, want %X", swap(macKey), swap(wantMacKey))
+	}
+	if !bytes.Equal(ltk, wantLTK) {
+		t.Errorf("f5 LTK = %X, want %X", swap(ltk), swap(wantLTK))
+	}
+}
+
+func TestF6(t *testing.T) {
+	w := le("2965f176a1084a02fd3f6a20ce636e20")
+	r := le("12a3343bb453bb5408da42d20c2d0fc8")
+	ioCap := le("010102")
+	want := le("e3c473989cd0e8c5d26c0b09da958f61")
+	if got := f6(w, sampleN1, sampleN2, r, ioCap, sampleA1, sampleA2); !bytes.Equal(got, want) {
+		t.Errorf("f6 = %X, want %X", swap(got), swap(want))
+	}
+}
+
+func TestG2(t *testing.T) {
+	if got, want := g2(sampleU, sampleV, sampleN1, sampleN2), uint32(0x2f9ed5ba); got != want {
+		t.Errorf("g2 = %08X, want %08X", got, want)
+	}
+}
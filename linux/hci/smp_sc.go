@@ -0,0 +1,276 @@
+package hci
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/subtle"
+)
+
+// LE Secure Connections pairing [Vol 3, Part H, 2.3.5.6].
+
+// sendPublicKey generates a P-256 key pair for this pairing, and sends the
+// public key to the responder [Vol 3, Part H, 3.5.6].
+func (s *smp) sendPublicKey() error {
+	k, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return s.fail(ErrSMPUnspecifiedReason)
+	}
+	s.priv, s.pka = k, publicKey(k)
+	s.state = smpWaitPublicKey
+	return s.send(append([]byte{pairingPublicKey}, s.pka...))
+}
+
+// Pairing Public Key [Vol 3, Part H, 3.5.6].
+func (s *smp) handlePairingPublicKey(b []byte) error {
+	if !s.sc || s.state != smpWaitPublicKey {
+		return s.fail(ErrSMPUnspecifiedReason)
+	}
+	pk := append([]byte(nil), b[1:]...)
+	if s.initiator {
+		s.pkb = pk
+	} else {
+		s.pka = pk
+		k, err := ecdh.P256().GenerateKey(rand.Reader)
+		if err != nil {
+			return s.fail(ErrSMPUnspecifiedReason)
+		}
+		s.priv, s.pkb = k, publicKey(k)
+	}
+
+	// A public key reflected from the remote device, or one that is not a
+	// valid point on the curve shall fail the pairing [Vol 3, Part H, 2.3.5.6.1].
+	if bytes.Equal(s.pka, s.pkb) {
+		return s.fail(ErrSMPInvalidParameters)
+	}
+	w, err := dhKey(s.priv, pk)
+	if err != nil {
+		return s.fail(ErrSMPDHKeyCheckFailed)
+	}
+	s.dhkey = w
+
+	if !s.initiator {
+		if err := s.send(append([]byte{pairingPublicKey}, s.pkb...)); err != nil {
+			return err
+		}
+	}
+	return s.authStage1()
+}
+
+// authStage1 starts the Authentication Stage 1 [Vol 3, Part H, 2.3.5.6.2 & 2.3.5.6.3].
+func (s *smp) authStage1() error {
+	switch s.method {
+	case justWorks, numericComparison:
+		if s.initiator {
+			s.state = smpWaitConfirm
+			return nil
+		}
+		// The responder commits to its nonce first.
+		nb, err := random(16)
+		if err != nil {
+			return s.fail(ErrSMPUnspecifiedReason)
+		}
+		s.lrand = nb
+		s.lconf = f4(s.pkb[:32], s.pka[:32], nb, 0)
+		s.state = smpWaitRandom
+		return s.send(append([]byte{pairingConfirm}, s.lconf...))
+	default:
+		s.state = smpWaitConfirm
+		if s.initiator {
+			s.state = smpWaitTK
+		}
+		return s.requestPasskey(func(pk uint32) error {
+			s.passkey, s.hasPK = pk, true
+			return s.passkeyRound()
+		})
+	}
+}
+
+// passkeyBit returns the z parameter of f4 for the current round of Passkey Entry.
+func (s *smp) passkeyBit() uint8 {
+	return 0x80 | uint8(s.passkey>>uint(s.round)&0x01)
+}
+
+// passkeyRound runs a round of Passkey Entry, in which the devices commit
+// to one bit of the passkey [Vol 3, Part H, 2.3.5.6.3]. The initiator sends
+// its confirm value first, and the responder replies its confirm value after
+// receiving the initiator's one.
+func (s *smp) passkeyRound() error {
+	s.state = smpWaitConfirm
+	if !s.initiator && s.rconf == nil {
+		return nil
+	}
+	n, err := random(16)
+	if err != nil {
+		return s.fail(ErrSMPUnspecifiedReason)
+	}
+	s.lrand = n
+	if s.initiator {
+		s.lconf = f4(s.pka[:32], s.pkb[:32], n, s.passkeyBit())
+	} else {
+		s.lconf = f4(s.pkb[:32], s.pka[:32], n, s.passkeyBit())
+		s.state = smpWaitRandom
+	}
+	return s.send(append([]byte{pairingConfirm}, s.lconf...))
+}
+
+// handleSCConfirm handles the Pairing Confirm of LE Secure Connections.
+func (s *smp) handleSCConfirm(b []byte) error {
+	s.rconf = append([]byte(nil), b[1:]...)
+	if !s.initiator {
+		// Passkey Entry; reply our confirm value once the passkey is available.
+		if !s.hasPK {
+			return nil
+		}
+		return s.passkeyRound()
+	}
+	if s.method == justWorks || s.method == numericComparison {
+		na, err := random(16)
+		if err != nil {
+			return s.fail(ErrSMPUnspecifiedReason)
+		}
+		s.lrand = na
+	}
+	s.state = smpWaitRandom
+	return s.send(append([]byte{pairingRandom}, s.lrand...))
+}
+
+// handleSCRandom handles the Pairing Random of LE Secure Connections.
+func (s *smp) handleSCRandom(b []byte) error {
+	s.rrand = append([]byte(nil), b[1:]...)
+	pkax, pkbx := s.pka[:32], s.pkb[:32]
+
+	switch s.method {
+	case justWorks, numericComparison:
+		if s.initiator {
+			if subtle.ConstantTimeCompare(f4(pkbx, pkax, s.rrand, 0), s.rconf) != 1 {
+				return s.fail(ErrSMPConfirmValueFailed)
+			}
+			return s.compare(g2(pkax, pkbx, s.lrand, s.rrand))
+		}
+		if err := s.send(append([]byte{pairingRandom}, s.lrand...)); err != nil {
+			return err
+		}
+		return s.compare(g2(pkax, pkbx, s.rrand, s.lrand))
+	}
+
+	if s.initiator {
+		if subtle.ConstantTimeCompare(f4(pkbx, pkax, s.rrand, s.passkeyBit()), s.rconf) != 1 {
+			return s.fail(ErrSMPConfirmValueFailed)
+		}
+	} else {
+		if subtle.ConstantTimeCompare(f4(pkax, pkbx, s.rrand, s.passkeyBit()), s.rconf) != 1 {
+			return s.fail(ErrSMPConfirmValueFailed)
+		}
+		if err := s.send(append([]byte{pairingRandom}, s.lrand...)); err != nil {
+			return err
+		}
+	}
+	s.rconf = nil
+	s.round++
+	if s.round < 20 {
+		return s.passkeyRound()
+	}
+	return s.authStage2()
+}
+
+// compare completes the Authentication Stage 1 of Just Works and Numeric
+// Comparison. For Numeric Comparison, the user confirms if the number v
+// matches the one displayed on the remote device.
+func (s *smp) compare(v uint32) error {
+	s.state = smpWaitDHKeyCheck
+	if s.method == justWorks {
+		return s.authorizeJustWorks(s.authStage2)
+	}
+	return s.askUser(func(ctx context.Context) (bool, error) {
+		return s.confirmNumber(ctx, v)
+	}, ErrSMPNumericComparisonFailed, s.authStage2)
+}
+
+// nonces returns the nonces of the initiator and the responder.
+func (s *smp) nonces() ([]byte, []byte) {
+	if s.initiator {
+		return s.lrand, s.rrand
+	}
+	return s.rrand, s.lrand
+}
+
+// addrs returns the addresses of the initiator and the responder, as used by
+// f5 and f6, which are the address followed by the address type.
+func (s *smp) addrs() ([]byte, []byte) {
+	lt, la := s.c.localAddr()
+	pt, pa := s.c.peerAddr()
+	l := append(append([]byte(nil), la...), lt)
+	p := append(append([]byte(nil), pa...), pt)
+	if s.initiator {
+		return l, p
+	}
+	return p, l
+}
+
+// passkeyR returns the r parameter of f6, which is the passkey for Passkey Entry.
+func (s *smp) passkeyR() []byte {
+	if s.method == justWorks || s.method == numericComparison {
+		return make([]byte, 16)
+	}
+	return passkeyTK(s.passkey)
+}
+
+// authStage2 starts the Authentication Stage 2, in which the devices generate
+// the LTK, and confirm that both have completed the pairing successfully
+// [Vol 3, Part H, 2.3.5.6.5].
+func (s *smp) authStage2() error {
+	na, nb := s.nonces()
+	a, b := s.addrs()
+	macKey, ltk := f5(s.dhkey, na, nb, a, b)
+	s.macKey, s.stk = macKey, maskKey(ltk, s.keySize)
+	s.state = smpWaitDHKeyCheck
+	if s.initiator {
+		ea := f6(s.macKey, na, nb, s.passkeyR(), s.preq[1:4], a, b)
+		return s.send(append([]byte{pairingDHKeyCheck}, ea...))
+	}
+	if s.rcheck == nil {
+		return nil
+	}
+	return s.checkDHKey(s.rcheck)
+}
+
+// Pairing DHKey Check [Vol 3, Part H, 3.5.7].
+func (s *smp) handlePairingDHKeyCheck(b []byte) error {
+	if !s.sc || s.state != smpWaitDHKeyCheck {
+		return s.fail(ErrSMPUnspecifiedReason)
+	}
+	if s.macKey == nil {
+		// The responder waits for the user to confirm the numeric comparison.
+		if s.initiator {
+			return s.fail(ErrSMPUnspecifiedReason)
+		}
+		s.rcheck = append([]byte(nil), b[1:]...)
+		return nil
+	}
+	return s.checkDHKey(b[1:])
+}
+
+// checkDHKey verifies the DHKey check value e of the remote device. The
+// responder replies its DHKey check value, and the initiator encrypts the link.
+func (s *smp) checkDHKey(e []byte) error {
+	na, nb := s.nonces()
+	a, b := s.addrs()
+	r := s.passkeyR()
+	ea := f6(s.macKey, na, nb, r, s.preq[1:4], a, b)
+	eb := f6(s.macKey, nb, na, r, s.pres[1:4], b, a)
+	if s.initiator {
+		if subtle.ConstantTimeCompare(e, eb) != 1 {
+			return s.fail(ErrSMPDHKeyCheckFailed)
+		}
+		s.state = smpWaitEncryption
+		s.startEncryption()
+		return nil
+	}
+	if subtle.ConstantTimeCompare(e, ea) != 1 {
+		return s.fail(ErrSMPDHKeyCheckFailed)
+	}
+	s.state = smpWaitEncryption
+	return s.send(append([]byte{pairingDHKeyCheck}, eb...))
+}
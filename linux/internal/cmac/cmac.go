@@ -0,0 +1,62 @@
+// Package cmac implements the AES-CMAC function defined in RFC 4493, which is
+// used by the Security Manager and the GATT Database Hash.
+package cmac
+
+import "crypto/aes"
+
+// Sum returns the AES-CMAC of msg with the 16-octet key. The key, the message
+// and the result are in the order of RFC 4493 (most significant octet first).
+func Sum(key, msg []byte) []byte {
+	blk, err := aes.NewCipher(key)
+	if err != nil {
+		// Only happens when the key is not 16 octets, which is a programming error.
+		panic(err)
+	}
+
+	// Generate the subkeys K1 and K2 [RFC 4493, 2.3].
+	shift := func(b []byte) []byte {
+		r := make([]byte, 16)
+		for i := 0; i < 15; i++ {
+			r[i] = b[i]<<1 | b[i+1]>>7
+		}
+		r[15] = b[15] << 1
+		if b[0]&0x80 != 0 {
+			r[15] ^= 0x87
+		}
+		return r
+	}
+	l := make([]byte, 16)
+	blk.Encrypt(l, l)
+	k1 := shift(l)
+	k2 := shift(k1)
+
+	// Process the message in blocks, and mask the last block with K1 if it's
+	// complete, otherwise pad it and mask it with K2 [RFC 4493, 2.4].
+	n := (len(msg) + 15) / 16
+	last := make([]byte, 16)
+	if n > 0 && len(msg)%16 == 0 {
+		last = xor(msg[(n-1)*16:], k1)
+	} else {
+		if n == 0 {
+			n = 1
+		}
+		copy(last, msg[(n-1)*16:])
+		last[len(msg)-(n-1)*16] = 0x80
+		last = xor(last, k2)
+	}
+	x := make([]byte, 16)
+	for i := 0; i < n-1; i++ {
+		blk.Encrypt(x, xor(x, msg[i*16:]))
+	}
+	blk.Encrypt(x, xor(x, last))
+	return x
+}
+
+// xor returns a ^ b. Both a and b must be at least 16 octets.
+func xor(a, b []byte) []byte {
+	r := make([]byte, 16)
+	for i := range r {
+		r[i] = a[i] ^ b[i]
+	}
+	return r
+}
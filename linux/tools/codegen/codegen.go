@@ -19,6 +19,11 @@ var (
 
 var cnt = 0
 
+// tail is the length of the fixed size fields following a variable length
+// field, which are located from the end of the packet.
+var tail = 0
+var varlen = false
+
 var funcMap = template.FuncMap{
 	"esc": func(s string) string {
 		s = strings.Replace(s, " ", "", -1)
@@ -28,6 +33,7 @@ var funcMap = template.FuncMap{
 	},
 	"reset": func() string {
 		cnt = 0
+		varlen = false
 		return ""
 	},
 	"roy": func(n, c, k, v string) string {
@@ -56,10 +62,15 @@ var funcMap = template.FuncMap{
 			s += fmt.Sprintf("func (r %s) Set%s (v %s) { binary.LittleEndian.PutUint64(r[%d:], v)}", n, k, v, cnt)
 			cnt += 8
 		case "[]byte":
+			end := ""
+			if tail > 0 {
+				end = fmt.Sprintf("len(r)-%d", tail)
+				varlen = true
+			}
 			s += fmt.Sprintf("// %s ...\n", k)
-			s += fmt.Sprintf("func (r %s) %s () %s { return r[%d:]}\n", n, k, v, cnt)
+			s += fmt.Sprintf("func (r %s) %s () %s { return r[%d:%s]}\n", n, k, v, cnt, end)
 			s += fmt.Sprintf("// Set%s ...\n", k)
-			s += fmt.Sprintf("func (r %s) Set%s (v %s) { copy(r[%d:], v)}", n, k, v, cnt)
+			s += fmt.Sprintf("func (r %s) Set%s (v %s) { copy(r[%d:%s], v)}", n, k, v, cnt, end)
 		case "[6]byte":
 			s += fmt.Sprintf("// %s ...\n", k)
 			s += fmt.Sprintf(`func (r %s) %s () %s {
@@ -72,6 +83,18 @@ var funcMap = template.FuncMap{
 			s += fmt.Sprintf(`func (r %s) Set%s (v %s) { copy(r[%d:%d+6], v[:]) }`, n, k, v, cnt, cnt)
 			cnt += 6
 		case "[12]byte":
+			if varlen {
+				s += fmt.Sprintf("// %s ...\n", k)
+				s += fmt.Sprintf(`func (r %s) %s () %s {
+				 b:=[12]byte{}
+				 copy(b[:], r[len(r)-12:])
+				 return b
+				 }
+				 `, n, k, v)
+				s += fmt.Sprintf("// Set%s ...\n", k)
+				s += fmt.Sprintf(`func (r %s) Set%s (v %s) { copy(r[len(r)-12:], v[:]) }`, n, k, v)
+				break
+			}
 			s += fmt.Sprintf("// %s ...\n", k)
 			s += fmt.Sprintf(`func (r %s) %s () %s {
 				 b:=[12]byte{}
@@ -256,12 +279,31 @@ func genAtt(b []byte, w io.Writer, t *template.Template) {
 		log.Printf("failed to read spec.json, err: %s", err)
 	}
 	for _, p := range atts.Atts {
+		tail = trailing(p.Param)
 		if err := t.Execute(w, p); err != nil {
 			log.Fatalf("execution: %s", err)
 		}
 	}
 }
 
+// trailing returns the length of the fixed size fields following a variable length field.
+func trailing(params []field) int {
+	n, varlen := 0, false
+	for _, f := range params {
+		for _, v := range f {
+			switch v {
+			case "[]byte":
+				varlen = true
+			case "[12]byte":
+				if varlen {
+					n += 12
+				}
+			}
+		}
+	}
+	return n
+}
+
 func main() {
 	flag.Parse()
 
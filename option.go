@@ -19,6 +19,18 @@ type DeviceOption interface {
 	SetDisconnectedHandler(f func(evt.DisconnectionComplete)) error
 	SetPeripheralRole() error
 	SetCentralRole() error
+	SetBondStore(BondStore) error
+	SetIRK([]byte) error
+	SetIOCapability(IOCapability) error
+	SetAuthRequirements(bonding, mitm bool) error
+	SetAgent(Agent) error
+	SetSecurityRequest(bool) error
+	SetPrepareQueueSize(int) error
+	SetNotifyQueue(int, NotifyQueuePolicy) error
+	SetTransactionTimeout(time.Duration) error
+	SetAuthorizer(Authorizer) error
+	SetResponseTimeout(time.Duration) error
+	SetEATT(bool) error
 }
 
 // An Option is a configuration function, which configures the device.
@@ -101,3 +113,112 @@ func OptCentralRole() Option {
 		return nil
 	}
 }
+
+// OptBondStore sets the store which keeps the keys of bonded devices, so they
+// can reconnect and encrypt the link without pairing again.
+func OptBondStore(s BondStore) Option {
+	return func(opt DeviceOption) error {
+		return opt.SetBondStore(s)
+	}
+}
+
+// OptIRK sets the Identity Resolving Key of the device, which is distributed
+// to the bonded devices to resolve its private addresses. It shall be kept
+// with the bonds, since the bonded devices can't resolve the addresses after
+// it changes. A random key is generated by default.
+func OptIRK(irk []byte) Option {
+	return func(opt DeviceOption) error {
+		return opt.SetIRK(irk)
+	}
+}
+
+// OptIOCapability sets the input and output capabilities of the device used in pairing.
+func OptIOCapability(c IOCapability) Option {
+	return func(opt DeviceOption) error {
+		return opt.SetIOCapability(c)
+	}
+}
+
+// OptAuthRequirements sets whether the device bonds with the remote devices,
+// and whether it requires MITM protection in pairing.
+func OptAuthRequirements(bonding, mitm bool) Option {
+	return func(opt DeviceOption) error {
+		return opt.SetAuthRequirements(bonding, mitm)
+	}
+}
+
+// OptAgent sets the agent, which interacts with the user during pairing.
+func OptAgent(a Agent) Option {
+	return func(opt DeviceOption) error {
+		return opt.SetAgent(a)
+	}
+}
+
+// OptSecurityRequest sets whether the device, as a slave, sends a Security
+// Request to the master when the ATT server rejects a request for insufficient
+// security, so the master pairs or encrypts the link.
+func OptSecurityRequest(enable bool) Option {
+	return func(opt DeviceOption) error {
+		return opt.SetSecurityRequest(enable)
+	}
+}
+
+// OptPrepareQueueSize sets the number of the prepared writes the ATT server
+// queues for each connection before they are executed.
+func OptPrepareQueueSize(n int) Option {
+	return func(opt DeviceOption) error {
+		return opt.SetPrepareQueueSize(n)
+	}
+}
+
+// NotifyQueuePolicy is what the server does, when a notification is sent while
+// the queue of the notifications to the connection is full.
+type NotifyQueuePolicy int
+
+// Notification queue policies.
+const (
+	NotifyQueueBlock NotifyQueuePolicy = iota // Write blocks until the queue has room.
+	NotifyQueueDrop                           // Write drops the notification, and returns ErrNotifyQueueFull.
+)
+
+// OptNotifyQueue sets the number of the notifications the ATT server queues
+// for each connection, and what to do when the queue is full.
+func OptNotifyQueue(n int, policy NotifyQueuePolicy) Option {
+	return func(opt DeviceOption) error {
+		return opt.SetNotifyQueue(n, policy)
+	}
+}
+
+// OptTransactionTimeout sets how long the ATT client and server wait for a
+// response or a confirmation. The bearer is closed if a transaction times out.
+// The default is 30 seconds [Vol 3, Part F, 3.3.3].
+func OptTransactionTimeout(d time.Duration) Option {
+	return func(opt DeviceOption) error {
+		return opt.SetTransactionTimeout(d)
+	}
+}
+
+// OptAuthorizer sets the authorizer, which authorizes the reads and the writes
+// of the remote devices to the attributes of the ATT server.
+func OptAuthorizer(a Authorizer) Option {
+	return func(opt DeviceOption) error {
+		return opt.SetAuthorizer(a)
+	}
+}
+
+// OptResponseTimeout sets how long the ATT server waits for a handler to
+// complete a deferred response, before it responds ErrUnlikely. It should be
+// less than the transaction timeout of the clients, which is 30 seconds.
+func OptResponseTimeout(d time.Duration) Option {
+	return func(opt DeviceOption) error {
+		return opt.SetResponseTimeout(d)
+	}
+}
+
+// OptEATT sets whether the device serves the Enhanced ATT bearers, which the
+// remote devices connect on encrypted links. It's disabled by default.
+func OptEATT(enable bool) Option {
+	return func(opt DeviceOption) error {
+		return opt.SetEATT(enable)
+	}
+}
@@ -1,5 +1,7 @@
 package ble
 
+import "sync"
+
 // NewService creates and initialize a new Service using u as it's UUID.
 func NewService(u UUID) *Service {
 	return &Service{UUID: u}
@@ -30,6 +32,17 @@ const (
 	CharExtended    Property = 0x80 // supports extended properties
 )
 
+// Permission is the security required to access the value of an attribute [Vol 3, Part F, 3.2.5].
+type Permission int
+
+// Attribute permission flags
+const (
+	PermReadEncrypted      Permission = 0x01 // read requires an encrypted link
+	PermReadAuthenticated  Permission = 0x02 // read requires an encrypted link with an authenticated key
+	PermWriteEncrypted     Permission = 0x04 // write requires an encrypted link
+	PermWriteAuthenticated Permission = 0x08 // write requires an encrypted link with an authenticated key
+)
+
 // A Profile is composed of one or more services necessary to fulfill a use case.
 type Profile struct {
 	Services []*Service
@@ -91,9 +104,23 @@ type Service struct {
 	UUID            UUID
 	Characteristics []*Characteristic
 
+	// Secondary is set for a secondary service, which is only referenced by
+	// the included services of the other services [Vol 3, Part G, 3.1].
+	Secondary bool
+
+	// Includes are the services included by the service [Vol 3, Part G, 3.2].
+	// On a server, they shall be in the same database.
+	Includes []*Service
+
 	Handle    uint16
 	EndHandle uint16
 
+	// FixedHandle, if not zero, is the handle of the service declaration on
+	// a server. It keeps the handles of the service stable, regardless of the
+	// services added before it. The handles shall increase in the order of
+	// the services added.
+	FixedHandle uint16
+
 	// (macOS only) The address of the CBService.
 	ID uintptr
 }
@@ -110,6 +137,12 @@ func (s *Service) AddCharacteristic(c *Characteristic) *Characteristic {
 	return c
 }
 
+// AddInclude adds an included service to a service.
+func (s *Service) AddInclude(inc *Service) *Service {
+	s.Includes = append(s.Includes, inc)
+	return inc
+}
+
 // NewCharacteristic adds a characteristic to a service.
 // NewCharacteristic panics if the service already contains another characteristic with the same UUID.
 func (s *Service) NewCharacteristic(u UUID) *Characteristic {
@@ -120,12 +153,16 @@ func (s *Service) NewCharacteristic(u UUID) *Characteristic {
 type Characteristic struct {
 	UUID        UUID
 	Property    Property
-	Secure      Property // FIXME
 	Descriptors []*Descriptor
 	CCCD        *Descriptor
 
 	Value []byte
 
+	// Secure is the security required to read or write the value, and
+	// MinKeySize is the minimum encryption key size required by Secure.
+	Secure     Permission
+	MinKeySize int
+
 	ReadHandler     ReadHandler
 	WriteHandler    WriteHandler
 	NotifyHandler   NotifyHandler
@@ -135,6 +172,40 @@ type Characteristic struct {
 	ValueHandle uint16
 	EndHandle   uint16
 
+	// FixedHandle, if not zero, is the handle of the characteristic
+	// declaration on a server, which is followed by the value. The handles
+	// shall increase in the order of the characteristics added to the service.
+	FixedHandle uint16
+
+	// SnapshotRead makes the long reads of a dynamic value consistent on a
+	// server. The whole value is read by the ReadHandler for the Read Request,
+	// and the following Read Blob Requests of the connection are served from
+	// it, until the value is read completely, or another read starts.
+	SnapshotRead bool
+
+	// Validation, if not nil, declares the values which may be written to
+	// the value on a server.
+	Validation *Validation
+
+	// The values of the standard descriptors, which are declared by the
+	// Set and Add methods on a server, and parsed by DiscoverDescriptors
+	// on a client. AggregateFormat is the handles of the Presentation
+	// Format descriptors, which are aggregated, on a client; a server
+	// generates it from PresentationFormats. A UserDescription written by
+	// the clients is returned by Description.
+	ExtendedProperties  ExtendedProperties
+	UserDescription     string
+	PresentationFormats []PresentationFormat
+	AggregateFormat     []uint16
+	ValidRange          *ValidRange
+
+	// userDescMu guards UserDescription, which the clients may write.
+	userDescMu sync.Mutex
+
+	// The connections subscribing to the notifications and the indications.
+	notifications subscriptions
+	indications   subscriptions
+
 	// (macOS only) The address of the CBCharacteristic.
 	ID uintptr
 }
@@ -189,6 +260,7 @@ func (c *Characteristic) HandleWrite(h WriteHandler) {
 }
 
 // HandleNotify makes the characteristic support notify requests, and routes notification requests to h.
+// h may be nil, if the notifications are only sent by Notify.
 // HandleNotify must be called before the containing service is added to a server.
 func (c *Characteristic) HandleNotify(h NotifyHandler) {
 	c.Property |= CharNotify
@@ -196,6 +268,7 @@ func (c *Characteristic) HandleNotify(h NotifyHandler) {
 }
 
 // HandleIndicate makes the characteristic support indicate requests, and routes notification requests to h.
+// h may be nil, if the indications are only sent by Indicate.
 // HandleIndicate must be called before the containing service is added to a server.
 func (c *Characteristic) HandleIndicate(h NotifyHandler) {
 	c.Property |= CharIndicate
@@ -210,9 +283,18 @@ type Descriptor struct {
 	Handle uint16
 	Value  []byte
 
+	// Secure is the security required to read or write the value, and
+	// MinKeySize is the minimum encryption key size required by Secure.
+	Secure     Permission
+	MinKeySize int
+
 	ReadHandler  ReadHandler
 	WriteHandler WriteHandler
 
+	// Validation, if not nil, declares the values which may be written to
+	// the descriptor on a server.
+	Validation *Validation
+
 	// (macOS only) The address of the CBDescriptor.
 	ID uintptr
 }
@@ -0,0 +1,114 @@
+package ble
+
+// Security is the security state of a link [Vol 3, Part C, 10.2].
+type Security struct {
+	// Encrypted reports whether the link is encrypted.
+	Encrypted bool
+
+	// Authenticated reports whether the link is encrypted with a key
+	// generated with MITM protection.
+	Authenticated bool
+
+	// KeySize is the encryption key size in octets.
+	KeySize int
+}
+
+// A SecureConn is a Conn whose link can be encrypted.
+type SecureConn interface {
+	Conn
+
+	// Security returns the current security state of the link.
+	Security() Security
+
+	// InsufficientSecurity is called when an access to an attribute is
+	// rejected, since the link doesn't meet the required security. The
+	// link may ask the remote device to pair or encrypt the link.
+	InsufficientSecurity(required Security)
+
+	// SecurityChanged returns a channel, which is closed when the security
+	// state of the link changes, such as the link is encrypted or paired.
+	SecurityChanged() <-chan struct{}
+}
+
+// A SigningConn is a Conn which signs and verifies data with the Connection
+// Signature Resolving Keys distributed in pairing [Vol 3, Part H, 2.4.5].
+type SigningConn interface {
+	Conn
+
+	// Sign signs m with the local CSRK and the next sign counter, and returns
+	// the signature, which consists of the sign counter and the MAC.
+	Sign(m []byte) ([12]byte, error)
+
+	// Verify verifies the signature of m signed by the remote device with its
+	// CSRK. It rejects the sign counters which have been used.
+	Verify(m []byte, sig [12]byte) error
+}
+
+// Operation is the kind of an access to an attribute, which is the ATT
+// request or command accessing it [Vol 3, Part F, 3.4].
+type Operation int
+
+// Operations on the attributes.
+const (
+	OpRead         Operation = iota // Read Request
+	OpWrite                         // Write Request
+	OpReadBlob                      // Read Blob Request, which reads the value from an offset
+	OpReadByType                    // Read By Type Request
+	OpReadMultiple                  // Read Multiple Request, or Read Multiple Variable Request
+	OpWriteCommand                  // Write Command, which isn't responded
+	OpSignedWrite                   // Signed Write Command
+	OpPrepareWrite                  // Prepare Write Request, which queues a part of the value
+	OpExecuteWrite                  // Execute Write Request, which writes the value of the prepared writes
+)
+
+// IsWrite reports whether the operation writes the value.
+func (o Operation) IsWrite() bool {
+	switch o {
+	case OpWrite, OpWriteCommand, OpSignedWrite, OpPrepareWrite, OpExecuteWrite:
+		return true
+	}
+	return false
+}
+
+// An Access is an access of a remote device to a characteristic value or a
+// descriptor, which is authorized by an Authorizer.
+type Access struct {
+	Conn Conn
+
+	// Addr is the address of the remote device, and Identity is its identity
+	// address, if it's bonded, or nil.
+	Addr     Addr
+	Identity Addr
+
+	// Security is the current security state of the link.
+	Security Security
+
+	// Handle and UUID are the handle and the type of the attribute accessed.
+	// Characteristic is the characteristic it belongs to, and Descriptor is
+	// the descriptor accessed, or nil if it's the characteristic value.
+	Handle         uint16
+	UUID           UUID
+	Characteristic *Characteristic
+	Descriptor     *Descriptor
+
+	// Op is the operation of the access. A long write is authorized for each
+	// of the prepared writes, and again when it's executed.
+	Op Operation
+}
+
+// An Authorizer authorizes the accesses to the attributes of a server
+// [Vol 3, Part F, 3.2.7]. It's called after the security of the link is
+// checked, and before the ReadHandler or the WriteHandler. Authorize returns
+// ErrSuccess to allow the access, or the error responded to the remote
+// device, typically ErrAuthorization.
+type Authorizer interface {
+	Authorize(a Access) ATTError
+}
+
+// AuthorizerFunc is an adapter to allow the use of ordinary functions as Authorizers.
+type AuthorizerFunc func(a Access) ATTError
+
+// Authorize returns f(a).
+func (f AuthorizerFunc) Authorize(a Access) ATTError {
+	return f(a)
+}
@@ -0,0 +1,153 @@
+package ble
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrNotSubscribed means the connection doesn't subscribe to the notifications
+// or the indications of the characteristic.
+var ErrNotSubscribed = errors.New("not subscribed")
+
+// SubscriberErrors are the errors of sending a notification or an indication
+// to the subscribed devices, keyed by the connections of their links.
+type SubscriberErrors map[Conn]error
+
+func (e SubscriberErrors) Error() string {
+	for _, err := range e {
+		return fmt.Sprintf("can't send to %d subscriber(s): %s", len(e), err)
+	}
+	return "no error"
+}
+
+// subscriptions are the notifiers of the devices, which subscribe to the
+// notifications or the indications of a characteristic. They are keyed by the
+// connections of the links, so all the bearers of a device share them.
+type subscriptions struct {
+	sync.Mutex
+	m map[Conn]Notifier
+}
+
+// add adds the notifier of the connection, and removes it once it's closed.
+func (s *subscriptions) add(conn Conn, n Notifier) {
+	conn = linkOf(conn)
+	s.Lock()
+	if s.m == nil {
+		s.m = make(map[Conn]Notifier)
+	}
+	s.m[conn] = n
+	s.Unlock()
+
+	go func() {
+		<-n.Context().Done()
+		s.Lock()
+		if s.m[conn] == n {
+			delete(s.m, conn)
+		}
+		s.Unlock()
+	}()
+}
+
+func (s *subscriptions) get(conn Conn) Notifier {
+	s.Lock()
+	defer s.Unlock()
+	return s.m[linkOf(conn)]
+}
+
+func (s *subscriptions) conns() []Conn {
+	s.Lock()
+	defer s.Unlock()
+	conns := make([]Conn, 0, len(s.m))
+	for c := range s.m {
+		conns = append(conns, c)
+	}
+	return conns
+}
+
+// send writes b to all the notifiers concurrently, and waits for them.
+func (s *subscriptions) send(b []byte) error {
+	s.Lock()
+	ns := make(map[Conn]Notifier, len(s.m))
+	for c, n := range s.m {
+		ns[c] = n
+	}
+	s.Unlock()
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	errs := SubscriberErrors{}
+	for c, n := range ns {
+		wg.Add(1)
+		go func(c Conn, n Notifier) {
+			defer wg.Done()
+			if _, err := n.Write(b); err != nil {
+				mu.Lock()
+				errs[c] = err
+				mu.Unlock()
+			}
+		}(c, n)
+	}
+	wg.Wait()
+	if len(errs) != 0 {
+		return errs
+	}
+	return nil
+}
+
+// sendTo writes b to the notifier of the connection.
+func (s *subscriptions) sendTo(conn Conn, b []byte) error {
+	n := s.get(conn)
+	if n == nil {
+		return ErrNotSubscribed
+	}
+	_, err := n.Write(b)
+	return err
+}
+
+// Subscribe adds the notifier of a connection, which enables the notifications,
+// or the indications if indicate is set, in the CCCD of the characteristic.
+// It's called by the server, and the notifier is removed once it's closed.
+func (c *Characteristic) Subscribe(conn Conn, n Notifier, indicate bool) {
+	if indicate {
+		c.indications.add(conn, n)
+		return
+	}
+	c.notifications.add(conn, n)
+}
+
+// Subscribers returns the connections of the links of the devices, which enable
+// the notifications, or the indications if indicate is set.
+func (c *Characteristic) Subscribers(indicate bool) []Conn {
+	if indicate {
+		return c.indications.conns()
+	}
+	return c.notifications.conns()
+}
+
+// Notify sends a notification of the value to all the connections, which
+// enable the notifications. If some of them fail, a SubscriberErrors is returned.
+func (c *Characteristic) Notify(b []byte) error {
+	return c.notifications.send(b)
+}
+
+// Indicate sends an indication of the value to all the connections, which
+// enable the indications, and waits for their confirmations. If some of them
+// fail, a SubscriberErrors is returned.
+func (c *Characteristic) Indicate(b []byte) error {
+	return c.indications.send(b)
+}
+
+// NotifyConn sends a notification of the value to the device of the connection,
+// which may be any bearer of the device, such as the one of a request. It
+// returns ErrNotSubscribed if the device doesn't enable the notifications.
+func (c *Characteristic) NotifyConn(conn Conn, b []byte) error {
+	return c.notifications.sendTo(conn, b)
+}
+
+// IndicateConn sends an indication of the value to the device of the connection,
+// and waits for the confirmation. It returns ErrNotSubscribed if the device
+// doesn't enable the indications.
+func (c *Characteristic) IndicateConn(conn Conn, b []byte) error {
+	return c.indications.sendTo(conn, b)
+}
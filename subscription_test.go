@@ -0,0 +1,101 @@
+package ble
+
+import (
+	"bytes"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testConn is a connection, which is only compared by the subscriptions.
+type testConn struct{ Conn }
+
+// recorder is a notifier of a subscriber, which records the values sent, or
+// fails with err.
+type recorder struct {
+	Notifier
+	mu   sync.Mutex
+	vals [][]byte
+}
+
+func newRecorder(err error) *recorder {
+	r := &recorder{}
+	r.Notifier = NewNotifier(func(b []byte) (int, error) {
+		if err != nil {
+			return 0, err
+		}
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.vals = append(r.vals, append([]byte(nil), b...))
+		return len(b), nil
+	})
+	return r
+}
+
+func (r *recorder) sent() [][]byte {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.vals
+}
+
+func TestSubscriptions(t *testing.T) {
+	c := &Characteristic{}
+	c1, c2, c3 := &testConn{}, &testConn{}, &testConn{}
+	n1, n2, i3 := newRecorder(nil), newRecorder(nil), newRecorder(nil)
+	c.Subscribe(c1, n1, false)
+	c.Subscribe(c2, n2, false)
+	c.Subscribe(c3, i3, true)
+
+	// The notifications are sent to all the subscribers, and the indications
+	// to the ones enabling them.
+	if err := c.Notify([]byte{0x01}); err != nil {
+		t.Errorf("Notify() = %v", err)
+	}
+	if err := c.Indicate([]byte{0x02}); err != nil {
+		t.Errorf("Indicate() = %v", err)
+	}
+	if err := c.NotifyConn(c2, []byte{0x03}); err != nil {
+		t.Errorf("NotifyConn() = %v", err)
+	}
+	if err := c.NotifyConn(c3, []byte{0x04}); err != ErrNotSubscribed {
+		t.Errorf("NotifyConn() of an indication subscriber = %v, want ErrNotSubscribed", err)
+	}
+	for _, tt := range []struct {
+		name string
+		r    *recorder
+		want []byte
+	}{
+		{"subscriber 1", n1, []byte{0x01}},
+		{"subscriber 2", n2, []byte{0x01, 0x03}},
+		{"subscriber 3", i3, []byte{0x02}},
+	} {
+		if got := bytes.Join(tt.r.sent(), nil); !bytes.Equal(got, tt.want) {
+			t.Errorf("%s: sent % X, want % X", tt.name, got, tt.want)
+		}
+	}
+
+	// The errors of the subscribers are returned by their connections.
+	errFailed := errors.New("failed")
+	c.Subscribe(c2, newRecorder(errFailed), false)
+	err := c.Notify([]byte{0x05})
+	if errs, ok := err.(SubscriberErrors); !ok || len(errs) != 1 || errs[c2] != errFailed {
+		t.Errorf("Notify() = %v, want the error of subscriber 2", err)
+	}
+	if got := n1.sent(); len(got) != 2 {
+		t.Errorf("subscriber 1 sent %d values, want 2", len(got))
+	}
+
+	// A closed notifier is removed.
+	n1.Close()
+	deadline := time.Now().Add(time.Second)
+	for len(c.Subscribers(false)) != 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d subscribers, want 1", len(c.Subscribers(false)))
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if err := c.NotifyConn(c1, []byte{0x06}); err != ErrNotSubscribed {
+		t.Errorf("NotifyConn() of a closed notifier = %v, want ErrNotSubscribed", err)
+	}
+}
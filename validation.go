@@ -0,0 +1,121 @@
+package ble
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+)
+
+// Validation declares the values, which may be written to a characteristic or
+// a descriptor. A server rejects the writes of other values before the
+// WriteHandler is called, and the long writes once the value is reassembled.
+// The zero fields aren't checked.
+type Validation struct {
+	// Len is the exact length of the value, and MinLen and MaxLen are the
+	// inclusive bounds of the length.
+	Len    int
+	MinLen int
+	MaxLen int
+
+	// Format is the format of a numeric value, which is one of the boolean,
+	// integer and float Formats. The value shall have the length of the
+	// format, and is decoded to be within the inclusive bounds Min and Max,
+	// which aren't checked if nil. NaN is out of range. The 64-bit integers
+	// are compared with the precision of float64.
+	Format   uint8
+	Min, Max *float64
+
+	// Values are the values allowed.
+	Values [][]byte
+}
+
+// Validate checks the value b written at the offset, of which the length is
+// offset+len(b). It returns ErrInvalAttrValueLen, ErrOutOfRange or
+// ErrValueNotAllowed if the value is rejected. The numeric value and the
+// allowed values are checked on the whole value, so a write at a non-zero
+// offset is rejected with ErrInvalidOffset if they are declared. An unsupported
+// Format is reported with ErrUnlikely.
+func (v *Validation) Validate(offset int, b []byte) ATTError {
+	n := offset + len(b)
+	switch {
+	case v.Len != 0 && n != v.Len,
+		v.MinLen != 0 && n < v.MinLen,
+		v.MaxLen != 0 && n > v.MaxLen:
+		return ErrInvalAttrValueLen
+	case v.Format == 0 && len(v.Values) == 0:
+		return ErrSuccess
+	case offset != 0:
+		return ErrInvalidOffset
+	}
+	if v.Format != 0 {
+		x, e := decodeNumber(v.Format, b)
+		if e != ErrSuccess {
+			return e
+		}
+		switch {
+		case math.IsNaN(x),
+			v.Min != nil && x < *v.Min,
+			v.Max != nil && x > *v.Max:
+			return ErrOutOfRange
+		}
+	}
+	if len(v.Values) == 0 {
+		return ErrSuccess
+	}
+	for _, a := range v.Values {
+		if bytes.Equal(a, b) {
+			return ErrSuccess
+		}
+	}
+	return ErrValueNotAllowed
+}
+
+// decodeNumber decodes the little-endian value b in the numeric format f.
+func decodeNumber(f uint8, b []byte) (float64, ATTError) {
+	var size int
+	signed := false
+	switch f {
+	case FormatBoolean, FormatUint8:
+		size = 1
+	case FormatUint16:
+		size = 2
+	case FormatUint24:
+		size = 3
+	case FormatUint32, FormatFloat32:
+		size = 4
+	case FormatUint64, FormatFloat64:
+		size = 8
+	case FormatSint8:
+		size, signed = 1, true
+	case FormatSint16:
+		size, signed = 2, true
+	case FormatSint24:
+		size, signed = 3, true
+	case FormatSint32:
+		size, signed = 4, true
+	case FormatSint64:
+		size, signed = 8, true
+	default:
+		return 0, ErrUnlikely
+	}
+	if len(b) != size {
+		return 0, ErrInvalAttrValueLen
+	}
+
+	switch f {
+	case FormatFloat32:
+		return float64(math.Float32frombits(binary.LittleEndian.Uint32(b))), ErrSuccess
+	case FormatFloat64:
+		return math.Float64frombits(binary.LittleEndian.Uint64(b)), ErrSuccess
+	}
+	var u uint64
+	for i := size - 1; i >= 0; i-- {
+		u = u<<8 | uint64(b[i])
+	}
+	if !signed {
+		return float64(u), ErrSuccess
+	}
+	// Sign-extend the value to 64 bits.
+	shift := uint(64 - 8*size)
+	return float64(int64(u<<shift) >> shift), ErrSuccess
+}
@@ -0,0 +1,38 @@
+package ble
+
+import "testing"
+
+func TestValidate(t *testing.T) {
+	f := func(x float64) *float64 { return &x }
+	tests := []struct {
+		v      Validation
+		offset int
+		b      []byte
+		want   ATTError
+	}{
+		{Validation{Len: 2}, 0, []byte{1, 2}, ErrSuccess},
+		{Validation{Len: 2}, 0, []byte{1}, ErrInvalAttrValueLen},
+		{Validation{MinLen: 2, MaxLen: 3}, 1, []byte{1, 2}, ErrSuccess},
+		{Validation{MaxLen: 3}, 2, []byte{1, 2}, ErrInvalAttrValueLen},
+		{Validation{Format: FormatUint16, Min: f(1), Max: f(300)}, 0, []byte{0x2C, 0x01}, ErrSuccess},
+		{Validation{Format: FormatUint16, Min: f(1), Max: f(300)}, 0, []byte{0x2D, 0x01}, ErrOutOfRange},
+		{Validation{Format: FormatUint16, Min: f(1), Max: f(300)}, 0, []byte{0x01}, ErrInvalAttrValueLen},
+		{Validation{Format: FormatUint16, Min: f(1), Max: f(300)}, 1, []byte{0x01}, ErrInvalidOffset},
+		{Validation{Format: FormatSint24, Min: f(-2), Max: f(0)}, 0, []byte{0xFE, 0xFF, 0xFF}, ErrSuccess},
+		{Validation{Format: FormatSint8, Min: f(-2), Max: f(0)}, 0, []byte{0xFD}, ErrOutOfRange},
+		{Validation{Format: FormatFloat32, Min: f(0), Max: f(1)}, 0, []byte{0x00, 0x00, 0xC0, 0x7F}, ErrOutOfRange}, // NaN
+		{Validation{Format: FormatUint8, Min: f(10)}, 0, []byte{200}, ErrSuccess},
+		{Validation{Format: FormatUint8, Min: f(10)}, 0, []byte{9}, ErrOutOfRange},
+		{Validation{Format: FormatSint16, Max: f(-1)}, 0, []byte{0x00, 0x80}, ErrSuccess},
+		{Validation{Format: FormatUint8}, 0, []byte{0xFF}, ErrSuccess},
+		{Validation{Format: FormatFloat64}, 0, []byte{1, 0, 0, 0, 0, 0, 0xF8, 0x7F}, ErrOutOfRange}, // NaN
+		{Validation{Format: FormatUTF8}, 0, []byte("a"), ErrUnlikely},
+		{Validation{Values: [][]byte{{1}, {3}}}, 0, []byte{3}, ErrSuccess},
+		{Validation{Values: [][]byte{{1}, {3}}}, 0, []byte{2}, ErrValueNotAllowed},
+	}
+	for i, tt := range tests {
+		if got := tt.v.Validate(tt.offset, tt.b); got != tt.want {
+			t.Errorf("%d: Validate(%d, %X) = %v, want %v", i, tt.offset, tt.b, got, tt.want)
+		}
+	}
+}